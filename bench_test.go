@@ -0,0 +1,63 @@
+package ftp4go
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// benchmarkSize is the size of the file transferred by the throughput benchmarks.
+const benchmarkSize = 4 << 20
+
+var benchmarkBlockSizes = []int{1024, BLOCK_SIZE, 64 * 1024, 256 * 1024}
+
+func BenchmarkGetBytes(b *testing.B) {
+	s := newTestServer(b)
+	s.putFile("/bench.bin", bytes.Repeat([]byte{0x5a}, benchmarkSize))
+	ftp := s.dial()
+	defer ftp.Quit()
+
+	for _, bs := range benchmarkBlockSizes {
+		b.Run(fmt.Sprintf("block=%d", bs), func(b *testing.B) {
+			b.SetBytes(benchmarkSize)
+			for i := 0; i < b.N; i++ {
+				if err := ftp.GetBytes(RETR_FTP_CMD, io.Discard, bs, "bench.bin"); err != nil {
+					b.Fatalf("GetBytes error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStoreBytes(b *testing.B) {
+	s := newTestServer(b)
+	content := bytes.Repeat([]byte{0x5a}, benchmarkSize)
+	ftp := s.dial()
+	defer ftp.Quit()
+
+	for _, bs := range benchmarkBlockSizes {
+		b.Run(fmt.Sprintf("block=%d", bs), func(b *testing.B) {
+			b.SetBytes(benchmarkSize)
+			for i := 0; i < b.N; i++ {
+				if err := ftp.StoreBytes(STORE_FTP_CMD, bytes.NewReader(content), bs, "bench.bin", "", nil); err != nil {
+					b.Fatalf("StoreBytes error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCommandRoundTrip measures the overhead of a single command and its reply.
+func BenchmarkCommandRoundTrip(b *testing.B) {
+	s := newTestServer(b)
+	ftp := s.dial()
+	defer ftp.Quit()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ftp.Pwd(); err != nil {
+			b.Fatalf("Pwd error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ftp4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capabilities is a support matrix of the server: the features it advertises and the
+// ftp4go features enabled or disabled against it. It prints as a readable report and
+// marshals to JSON, support requests can ask for either.
+type Capabilities struct {
+	Greeting string           `json:"greeting"`
+	Features []string         `json:"features"`                // the FEAT reply lines
+	FeatErr  string           `json:"feat_error,omitempty"`    // set if the server refused FEAT
+	SiteCmds []string         `json:"site_commands,omitempty"` // listed by SiteHelp, if called
+	Support  []FeatureSupport `json:"support"`
+}
+
+// FeatureSupport tells whether an ftp4go feature is used with the server and why.
+type FeatureSupport struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Capabilities sends FEAT and reports the server capabilities, as of the current state
+// of the session: call it after Login, and after Negotiate or Secure if used.
+// A server refusing FEAT is reported in FeatErr rather than as an error.
+func (ftp *FTP) Capabilities() (*Capabilities, error) {
+	c := &Capabilities{Greeting: ftp.welcome}
+	fts, err := ftp.Feat()
+	if err != nil {
+		if replyCode(err) < 500 {
+			return nil, err
+		}
+		c.FeatErr = err.Error()
+		ftp.features = map[string]string{}
+	}
+	c.Features = fts
+	for name := range ftp.siteCmds {
+		c.SiteCmds = append(c.SiteCmds, name)
+	}
+	sort.Strings(c.SiteCmds)
+
+	support := func(name string, enabled bool, reason string) {
+		c.Support = append(c.Support, FeatureSupport{name, enabled, reason})
+	}
+	advertised := func(feature string) string {
+		if ftp.HasFeature(feature) {
+			return feature + " advertised"
+		}
+		return feature + " not advertised"
+	}
+
+	switch {
+	case ftp.Protection() == ProtPrivate:
+		support("TLS", true, "the session is secured")
+	case ftp.HasFeature("AUTH TLS") || ftp.HasFeature("AUTH SSL"):
+		support("TLS", false, "AUTH TLS advertised but the session is not secured, see Secure")
+	default:
+		support("TLS", false, "AUTH TLS not advertised")
+	}
+	switch {
+	case ftp.utf8:
+		support("UTF-8 file names", true, "OPTS UTF8 ON accepted")
+	case ftp.HasFeature("UTF8"):
+		support("UTF-8 file names", false, "UTF8 advertised but not enabled, see Negotiate")
+	default:
+		support("UTF-8 file names", false, "UTF8 not advertised")
+	}
+	switch {
+	case ftp.modeZ:
+		support("MODE Z compression", true, "MODE Z in use")
+	case ftp.HasFeature("MODE Z") && ftp.noCompression:
+		support("MODE Z compression", false, "MODE Z disabled by SetCompression")
+	case ftp.HasFeature("MODE Z"):
+		support("MODE Z compression", false, "MODE Z advertised but not enabled, see Negotiate")
+	default:
+		support("MODE Z compression", false, "MODE Z not advertised")
+	}
+	support("MLSD listings", ftp.HasFeature("MLST"), advertised("MLST"))
+	support("Exact modification times", ftp.HasFeature("MDTM"), advertised("MDTM"))
+	support("Resumed transfers", ftp.HasFeature("REST STREAM"), advertised("REST STREAM"))
+	switch {
+	case ftp.alloRefused:
+		support("Size announcements", false, "ALLO refused by the server")
+	case ftp.HasFeature("ALLO"):
+		support("Size announcements", true, "ALLO advertised")
+	default:
+		support("Size announcements", ftp.HasFeature("REST STREAM"), advertised("REST STREAM"))
+	}
+	support("SHA-256 verification", ftp.HasFeature("HASH SHA-256"), advertised("HASH SHA-256"))
+	if ftp.HasFeature("SITE COPY") && ftp.noSiteCopy {
+		support("Server-side copy", false, "SITE CPFR/CPTO refused by the server, copies are relayed")
+	} else {
+		support("Server-side copy", ftp.HasFeature("SITE COPY"), advertised("SITE COPY"))
+	}
+	return c, nil
+}
+
+// String returns a readable report of the capabilities, one line per feature.
+func (c *Capabilities) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Greeting: %s\n", c.Greeting)
+	if c.FeatErr != "" {
+		fmt.Fprintf(&b, "FEAT refused: %s\n", c.FeatErr)
+	} else {
+		fmt.Fprintf(&b, "Features: %s\n", strings.Join(c.Features, ", "))
+	}
+	if len(c.SiteCmds) > 0 {
+		fmt.Fprintf(&b, "SITE commands: %s\n", strings.Join(c.SiteCmds, ", "))
+	}
+	for _, s := range c.Support {
+		mark := " "
+		if s.Enabled {
+			mark = "x"
+		}
+		fmt.Fprintf(&b, "[%s] %s: %s\n", mark, s.Name, s.Reason)
+	}
+	return b.String()
+}
+
+// JSON returns the capabilities as indented JSON.
+func (c *Capabilities) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
@@ -0,0 +1,168 @@
+package ftp4go
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// CaseFolding selects whether SyncDirs, the skip policies of UploadDirTree and the listing
+// probe of Exists take remote names differing only in case for the same file.
+type CaseFolding int
+
+const (
+	// CaseSensitive compares the names exactly, the default.
+	CaseSensitive CaseFolding = iota
+	// CaseInsensitive ignores the case, as IIS and the other Windows servers do: a local file
+	// named a.txt is compared to the remote A.TXT rather than uploaded next to it.
+	CaseInsensitive
+	// CaseDetect probes the server once, see DetectCaseInsensitive.
+	CaseDetect
+)
+
+var caseFoldingNames = []string{"sensitive", "insensitive", "detect"}
+
+// String returns the lower case name of the mode, as written in partner profiles.
+func (m CaseFolding) String() string {
+	if m < 0 || int(m) >= len(caseFoldingNames) {
+		return fmt.Sprintf("CaseFolding(%d)", int(m))
+	}
+	return caseFoldingNames[m]
+}
+
+func (m CaseFolding) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *CaseFolding) UnmarshalText(b []byte) error {
+	for i, name := range caseFoldingNames {
+		if strings.EqualFold(string(b), name) {
+			*m = CaseFolding(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown case folding %q", b)
+}
+
+// SetCaseFolding sets how the local and remote names are compared, CaseSensitive by default.
+func (ftp *FTP) SetCaseFolding(mode CaseFolding) {
+	ftp.caseFolding = mode
+	ftp.caseFound = CaseDetect
+}
+
+// DetectCaseInsensitive probes whether the server ignores the case of the names: it changes
+// to the current folder spelt in the opposite case, or, if its name has no letter, asks the
+// SIZE or changes to an entry of its listing so spelt. A folder offering nothing to probe
+// is assumed case-sensitive.
+func (ftp *FTP) DetectCaseInsensitive() (bool, error) {
+	pwd, err := ftp.Pwd()
+	if err != nil {
+		return false, err
+	}
+	if swapped := swapCase(pwd); swapped != pwd {
+		return ftp.probeCwd(swapped)
+	}
+	entries, err := ftp.List()
+	if err != nil {
+		return false, err
+	}
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		names[e.Name] = true
+	}
+	for _, e := range entries {
+		swapped := swapCase(e.Name)
+		if swapped == e.Name || names[swapped] {
+			continue
+		}
+		switch e.Type {
+		case EntryTypeFolder:
+			return ftp.probeCwd(swapped)
+		case EntryTypeFile:
+			return ftp.probeSize(swapped)
+		}
+	}
+	ftp.writeInfo("No name to probe the case sensitivity with in", pwd)
+	return false, nil
+}
+
+// foldsCase resolves the case folding of the session, probing the server for CaseDetect.
+func (ftp *FTP) foldsCase() (bool, error) {
+	if ftp.caseFolding != CaseDetect {
+		return ftp.caseFolding == CaseInsensitive, nil
+	}
+	if ftp.caseFound == CaseDetect {
+		insensitive, err := ftp.DetectCaseInsensitive()
+		if err != nil {
+			return false, err
+		}
+		ftp.caseFound = CaseSensitive
+		if insensitive {
+			ftp.caseFound = CaseInsensitive
+		}
+	}
+	return ftp.caseFound == CaseInsensitive, nil
+}
+
+// nameKey returns the key comparing a name, folded if fold is set.
+func nameKey(name string, fold bool) string {
+	if fold {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// swapCase returns s with the upper case letters in lower case and the other way round.
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// foldCase renames the remote paths of t differing only in case from a local one to the local
+// spelling, unless several local paths differ only in case.
+func (t *syncTree) foldCase(local *syncTree) {
+	spelling := make(map[string]string)
+	spell := func(p string) {
+		k := strings.ToLower(p)
+		if q, ok := spelling[k]; ok && q != p {
+			spelling[k] = "" // ambiguous
+		} else {
+			spelling[k] = p
+		}
+	}
+	for p := range local.files {
+		spell(p)
+	}
+	for p := range local.dirs {
+		spell(p)
+	}
+	// the folders are respelt first, the local ones being in the tree too
+	var respell func(p string) string
+	respell = func(p string) string {
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			p = respell(p[:i]) + p[i:]
+		}
+		if q := spelling[strings.ToLower(p)]; q != "" {
+			return q
+		}
+		return p
+	}
+
+	files := make(map[string]*FileStamp, len(t.files))
+	for p, s := range t.files {
+		files[respell(p)] = s
+	}
+	dirs := make(map[string]bool, len(t.dirs))
+	for p := range t.dirs {
+		dirs[respell(p)] = true
+	}
+	truncated := make(map[string]string, len(t.truncated))
+	for p, why := range t.truncated {
+		truncated[respell(p)] = why
+	}
+	t.files, t.dirs, t.truncated = files, dirs, truncated
+}
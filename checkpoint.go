@@ -0,0 +1,299 @@
+package ftp4go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCheckpointInterval is the number of bytes between two checkpoints of a transfer.
+const DefaultCheckpointInterval = 8 << 20
+
+// Checkpoint records how far a binary transfer of DownloadFileWithOptions or
+// UploadFileWithOptions got, so that a new process can resume it.
+type Checkpoint struct {
+	Op      string    `json:"op"`     // RETR or STOR
+	Remote  string    `json:"remote"` // remote path as passed to the transfer
+	Local   string    `json:"local"`
+	Offset  int64     `json:"offset"`             // bytes known to be transferred
+	Size    int64     `json:"size"`               // size of the source file, -1 if unknown
+	ModTime time.Time `json:"mod_time,omitempty"` // modification time of the local file of an upload
+	Updated time.Time `json:"updated"`
+}
+
+// CheckpointStore persists the checkpoints of the transfers, by key. Load returns nil
+// without error if there is no checkpoint for the key. A store may be shared by several
+// sessions, which use distinct keys unless they transfer the same files.
+type CheckpointStore interface {
+	Load(key string) (*Checkpoint, error)
+	Save(key string, c *Checkpoint) error
+	Delete(key string) error
+}
+
+// SetCheckpoints sets the store of the transfer checkpoints, nil to turn them off.
+// A binary download or upload of DownloadFileWithOptions or UploadFileWithOptions without
+// explicit Offset saves a checkpoint every interval bytes, DefaultCheckpointInterval if 0,
+// and when it fails; the checkpoint is deleted once the transfer succeeds.
+// A transfer finding the checkpoint of a previous process resumes from it:
+//   - a download if the remote size is unchanged and the local file holds the checkpointed bytes,
+//   - an upload if the local file is unchanged, from the remote size if lower, and starts
+//     over if the server cannot tell the size of the remote file.
+func (ftp *FTP) SetCheckpoints(store CheckpointStore, interval int64) {
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	ftp.checkpoints = store
+	ftp.ckInterval = interval
+}
+
+// FileCheckpointStore is a CheckpointStore keeping a JSON file per checkpoint in a folder.
+type FileCheckpointStore struct {
+	Dir string
+}
+
+// NewFileCheckpointStore returns a store keeping the checkpoints in dir, which is created if needed.
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileCheckpointStore{Dir: dir}, nil
+}
+
+func (s *FileCheckpointStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Load reads the checkpoint of key.
+func (s *FileCheckpointStore) Load(key string) (*Checkpoint, error) {
+	b, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the checkpoint of key, replacing the previous one atomically.
+func (s *FileCheckpointStore) Save(key string, c *Checkpoint) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(key), b)
+}
+
+// Delete removes the checkpoint of key, if any.
+func (s *FileCheckpointStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// checkpointer saves the checkpoints of a transfer.
+type checkpointer struct {
+	ftp   *FTP
+	key   string
+	cp    Checkpoint
+	next  int64        // offset of the next checkpoint
+	lag   int64        // bytes read for an upload but maybe not sent yet
+	sync  func() error // flushes the local file of a download before a checkpoint
+	start int64        // offset the transfer started at
+	done  int64        // bytes transferred since the start
+}
+
+// checkpointDownload returns the checkpointer of a download, nil if there is none,
+// setting opts.Offset to the checkpoint of a previous download of the file.
+func (ftp *FTP) checkpointDownload(remotename string, localpath string, opts *TransferOptions) *checkpointer {
+	if ftp.checkpoints == nil || opts.Mode != Binary || opts.Offset != 0 {
+		return nil
+	}
+	size := int64(-1)
+	if n, err := ftp.Size(remotename); err == nil {
+		size = int64(n)
+	}
+	ck := ftp.newCheckpointer("RETR", remotename, localpath, size)
+	if cp := ck.load(); cp != nil {
+		fi, err := os.Stat(localpath)
+		if size >= 0 && cp.Size == size && err == nil && fi.Size() >= cp.Offset {
+			opts.Offset = cp.Offset
+		} else {
+			ftp.writeInfo("Discarding the outdated checkpoint of", remotename)
+		}
+	}
+	ck.begin(opts.Offset)
+	return ck
+}
+
+// checkpointUpload is checkpointDownload for the upload of the file fi.
+func (ftp *FTP) checkpointUpload(remotename string, localpath string, fi os.FileInfo, opts *TransferOptions) *checkpointer {
+	if ftp.checkpoints == nil || fi == nil || opts.Mode != Binary || opts.Offset != 0 {
+		return nil
+	}
+	ck := ftp.newCheckpointer("STOR", remotename, localpath, fi.Size())
+	ck.cp.ModTime = fi.ModTime()
+	ck.lag = int64(opts.blockSize(fi.Size()))
+	if cp := ck.load(); cp != nil {
+		if cp.Size != fi.Size() || !cp.ModTime.Equal(fi.ModTime()) {
+			ftp.writeInfo("Discarding the outdated checkpoint of", remotename)
+		} else if n, err := ftp.Size(remotename); err != nil {
+			ftp.writeInfo("Unable to resume the upload of", remotename, "without its remote size:", err)
+		} else {
+			opts.Offset = cp.Offset
+			if int64(n) < opts.Offset {
+				opts.Offset = int64(n)
+			}
+		}
+	}
+	ck.begin(opts.Offset)
+	return ck
+}
+
+func (ftp *FTP) newCheckpointer(op string, remotename string, localpath string, size int64) *checkpointer {
+	return &checkpointer{
+		ftp: ftp,
+		key: op + " " + remotename + " " + localpath,
+		cp:  Checkpoint{Op: op, Remote: remotename, Local: localpath, Size: size},
+	}
+}
+
+func (ck *checkpointer) load() *Checkpoint {
+	cp, err := ck.ftp.checkpoints.Load(ck.key)
+	if err != nil {
+		ck.ftp.writeInfo("Unable to load the checkpoint of", ck.cp.Remote, ":", err)
+		return nil
+	}
+	if cp != nil {
+		ck.ftp.writeInfo("Found a checkpoint of", ck.cp.Remote, "at offset", cp.Offset)
+	}
+	return cp
+}
+
+func (ck *checkpointer) begin(offset int64) {
+	ck.start = offset
+	ck.cp.Offset = offset
+	ck.next = offset + ck.ftp.ckInterval
+}
+
+// advance accounts for the transferred bytes, n in total since the start of the
+// transfer, and saves a checkpoint when one is due.
+func (ck *checkpointer) advance(n int64) {
+	ck.done = n
+	if ck.start+n < ck.next {
+		return
+	}
+	ck.next = ck.start + n + ck.ftp.ckInterval
+	ck.save(ck.start + n)
+}
+
+func (ck *checkpointer) save(offset int64) {
+	if offset -= ck.lag; offset < ck.start {
+		offset = ck.start
+	}
+	if ck.sync != nil {
+		if err := ck.sync(); err != nil {
+			ck.ftp.writeInfo("Unable to flush the local file before the checkpoint:", err)
+			return
+		}
+	}
+	ck.cp.Offset = offset
+	ck.cp.Updated = time.Now()
+	if err := ck.ftp.checkpoints.Save(ck.key, &ck.cp); err != nil {
+		ck.ftp.writeInfo("Unable to save the checkpoint of", ck.cp.Remote, ":", err)
+	}
+}
+
+// finish deletes the checkpoint of a successful transfer, or of a failed download whose
+// partial local file was removed, and saves the last one of the other failed transfers.
+// A download failing before the local file is written, e.g. refused by the server, keeps
+// the checkpoint left by a previous run.
+func (ck *checkpointer) finish(err error) {
+	if ck == nil {
+		return
+	}
+	if err == nil {
+		ck.delete()
+		return
+	}
+	offset := ck.start + ck.done
+	if ck.cp.Op == "RETR" {
+		var pe *ErrPartialTransfer
+		if !errors.As(err, &pe) {
+			return
+		}
+		if offset = keptOffset(err); offset < 0 {
+			ck.delete()
+			return
+		}
+	}
+	ck.sync = nil
+	ck.save(offset)
+}
+
+func (ck *checkpointer) delete() {
+	if err := ck.ftp.checkpoints.Delete(ck.key); err != nil {
+		ck.ftp.writeInfo("Unable to delete the checkpoint of", ck.cp.Remote, ":", err)
+	}
+}
+
+// writer returns w saving the checkpoints of a download, w itself if ck is nil.
+func (ck *checkpointer) writer(w io.Writer) io.Writer {
+	if ck == nil {
+		return w
+	}
+	return &checkpointWriter{w: w, ck: ck}
+}
+
+// reader is writer for an upload.
+func (ck *checkpointer) reader(r io.Reader) io.Reader {
+	if ck == nil {
+		return r
+	}
+	return &checkpointReader{r: r, ck: ck}
+}
+
+type checkpointWriter struct {
+	w  io.Writer
+	ck *checkpointer
+	n  int64
+}
+
+func (cw *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.ck.advance(cw.n)
+	return n, err
+}
+
+type checkpointReader struct {
+	r  io.Reader
+	ck *checkpointer
+	n  int64
+}
+
+func (cr *checkpointReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	cr.ck.advance(cr.n)
+	return n, err
+}
+
+// keptOffset returns the size of the local file kept by a failed download, -1 if removed.
+func keptOffset(err error) int64 {
+	var pe *ErrPartialTransfer
+	if errors.As(err, &pe) && pe.Kept {
+		return pe.Offset
+	}
+	return -1
+}
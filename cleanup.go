@@ -0,0 +1,132 @@
+package ftp4go
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"time"
+)
+
+// CleanupResult describes a file removed, or to be removed in a dry run, by a cleanup.
+type CleanupResult struct {
+	Path     string    // absolute path of the file
+	ModTime  time.Time // last modification time the decision was based on
+	Size     int64     // size in bytes, 0 if unknown
+	Archived string    // the path it was moved to, if archived
+	Err      error     // nil if the file was removed
+}
+
+// CleanupRemote deletes the files of a remote folder, its subfolders are left alone, which
+// have not been modified for longer than olderThan and whose name matches pattern, a
+// path.Match pattern; an empty pattern matches every file.
+// The modification times are taken from the MLSD modify facts if the server supports MLST,
+// from MDTM otherwise and as a last resort from the LIST reply, which is only accurate to the minute.
+// With dryRun nothing is deleted and the files which would be are reported.
+// The error is only set if the folder could not be examined, the failures to delete single
+// files are reported in their results.
+func (ftp *FTP) CleanupRemote(remoteDir string, olderThan time.Duration, pattern string, dryRun bool) ([]*CleanupResult, error) {
+	return ftp.cleanupRemote(remoteDir, olderThan, pattern, "", dryRun)
+}
+
+// ArchiveRemote is like CleanupRemote but moves the expired files into archiveDir,
+// a path relative to remoteDir or absolute, instead of deleting them.
+func (ftp *FTP) ArchiveRemote(remoteDir string, olderThan time.Duration, pattern string, archiveDir string, dryRun bool) ([]*CleanupResult, error) {
+	if !path.IsAbs(archiveDir) {
+		archiveDir = path.Join(remoteDir, archiveDir)
+	}
+	return ftp.cleanupRemote(remoteDir, olderThan, pattern, archiveDir, dryRun)
+}
+
+func (ftp *FTP) cleanupRemote(remoteDir string, olderThan time.Duration, pattern string, archiveDir string, dryRun bool) (results []*CleanupResult, err error) {
+	if ftp.features == nil {
+		if _, err = ftp.Feat(); err != nil {
+			return nil, err
+		}
+	}
+	var files []*CleanupResult
+	if files, err = ftp.remoteFileTimes(remoteDir); err != nil {
+		return nil, err
+	}
+
+	limit := time.Now().Add(-olderThan)
+	for _, f := range files {
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, path.Base(f.Path)); !ok {
+				continue
+			}
+		}
+		if !f.ModTime.Before(limit) {
+			continue
+		}
+		if archiveDir != "" {
+			f.Archived = path.Join(archiveDir, path.Base(f.Path))
+		}
+		results = append(results, f)
+		if dryRun {
+			ftp.writeInfo("Would remove expired file:", f.Path, "modified:", f.ModTime)
+			continue
+		}
+		if archiveDir != "" {
+			_, f.Err = ftp.Rename(f.Path, f.Archived)
+		} else {
+			_, f.Err = ftp.Delete(f.Path)
+		}
+	}
+	return results, nil
+}
+
+// remoteFileTimes returns the files of a remote folder with their modification times.
+func (ftp *FTP) remoteFileTimes(remoteDir string) (files []*CleanupResult, err error) {
+	var unavailable *ErrFeatureUnavailable
+	if ftp.HasFeature("MLST") {
+		var lines []*NameFactsLine
+		if lines, err = ftp.Mlsd(remoteDir, nil); errors.As(err, &unavailable) {
+			ftp.writeInfo("Falling back to LIST:", err)
+			return ftp.listFileTimes(remoteDir)
+		} else if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			if l.Facts["type"] != "file" {
+				continue
+			}
+			f := &CleanupResult{Path: path.Join(remoteDir, l.Name)}
+			if f.ModTime, err = parseMdtmTime(l.Facts["modify"]); err != nil {
+				return nil, err
+			}
+			f.Size, _ = strconv.ParseInt(l.Facts["size"], 10, 64)
+			files = append(files, f)
+		}
+		return files, nil
+	}
+	return ftp.listFileTimes(remoteDir)
+}
+
+// listFileTimes is remoteFileTimes without MLSD, the times being the ones of MDTM if supported.
+func (ftp *FTP) listFileTimes(remoteDir string) (files []*CleanupResult, err error) {
+	var unavailable *ErrFeatureUnavailable
+	var entries []*Entry
+	if entries, err = ftp.List(remoteDir); err != nil {
+		return nil, err
+	}
+	useMdtm := ftp.HasFeature("MDTM")
+	for _, e := range entries {
+		if e.Type != EntryTypeFile {
+			continue
+		}
+		f := &CleanupResult{Path: path.Join(remoteDir, e.Name), ModTime: e.Time, Size: e.Size}
+		if useMdtm {
+			var t time.Time
+			if t, err = ftp.Mdtm(f.Path); errors.As(err, &unavailable) {
+				ftp.writeInfo("Falling back to the LIST times:", err)
+				useMdtm = false
+			} else if err != nil {
+				return nil, err
+			} else {
+				f.ModTime = t
+			}
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
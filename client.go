@@ -3,9 +3,13 @@ package ftp4go
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"golang.org/x/net/proxy"
+	"github.com/shenshouer/ftp4go/internal/socks5"
+	"github.com/shenshouer/ftp4go/replyparse"
 	"io"
 	"log"
 	"net"
@@ -14,6 +18,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -56,8 +63,23 @@ const (
 	QUIT_FTP_CMD       FtpCmd = 24
 	MLSD_FTP_CMD       FtpCmd = 25
 	REST_FTP_CMD       FtpCmd = 26
+	ALLO_FTP_CMD       FtpCmd = 27
+	MODE_FTP_CMD       FtpCmd = 28
+	HASH_FTP_CMD       FtpCmd = 29
+	MDTM_FTP_CMD       FtpCmd = 30
+	SITE_FTP_CMD       FtpCmd = 31
+	AUTH_FTP_CMD       FtpCmd = 32
+	PBSZ_FTP_CMD       FtpCmd = 33
+	PROT_FTP_CMD       FtpCmd = 34
+	HOST_FTP_CMD       FtpCmd = 35
+	MLST_FTP_CMD       FtpCmd = 36
+	REIN_FTP_CMD       FtpCmd = 37
+	AVBL_FTP_CMD       FtpCmd = 38
 )
 
+// customFtpCmdBase is the first value handed out by RegisterFtpCmd.
+const customFtpCmdBase FtpCmd = 1000
+
 const MSG_OOB = 0x1 //Process data out of band
 
 var ftpCmdStrings = map[FtpCmd]string{
@@ -88,6 +110,63 @@ var ftpCmdStrings = map[FtpCmd]string{
 	CDUP_FTP_CMD:       "CDUP",
 	QUIT_FTP_CMD:       "QUIT",
 	REST_FTP_CMD:       "REST",
+	ALLO_FTP_CMD:       "ALLO",
+	MODE_FTP_CMD:       "MODE",
+	HASH_FTP_CMD:       "HASH",
+	MDTM_FTP_CMD:       "MDTM",
+	SITE_FTP_CMD:       "SITE",
+	AUTH_FTP_CMD:       "AUTH",
+	PBSZ_FTP_CMD:       "PBSZ",
+	PROT_FTP_CMD:       "PROT",
+	HOST_FTP_CMD:       "HOST",
+	MLST_FTP_CMD:       "MLST",
+	REIN_FTP_CMD:       "REIN",
+	AVBL_FTP_CMD:       "AVBL",
+}
+
+// ftpCmdCodes holds the reply codes accepted by registered commands.
+// Commands without an entry accept any 1xx, 2xx or 3xx reply.
+var ftpCmdCodes = map[FtpCmd][]int{}
+
+var (
+	ftpCmdMutex sync.RWMutex
+	nextFtpCmd  = customFtpCmdBase
+)
+
+// RegisterFtpCmd registers a custom command verb, for instance a proprietary
+// SITE subcommand such as "SITE DUMP", and returns the FtpCmd to be used with
+// Send, SendAndRead and the transfer methods.
+// If expectedCodes are given, any other positive reply to the command is reported
+// as a reply error; data-bearing commands need to list their 1xx replies too.
+// Registering the same verb again updates its expected codes and returns the same FtpCmd.
+func RegisterFtpCmd(verb string, expectedCodes ...int) (FtpCmd, error) {
+	verb = strings.TrimSpace(verb)
+	if len(verb) == 0 {
+		return NONE_FTP_CMD, errors.New("The command verb must be specified")
+	}
+
+	ftpCmdMutex.Lock()
+	defer ftpCmdMutex.Unlock()
+
+	cmd := NONE_FTP_CMD
+	for k, v := range ftpCmdStrings {
+		if k >= customFtpCmdBase && v == verb {
+			cmd = k
+			break
+		}
+	}
+	if cmd == NONE_FTP_CMD {
+		cmd = nextFtpCmd
+		nextFtpCmd++
+		ftpCmdStrings[cmd] = verb
+	}
+
+	if len(expectedCodes) > 0 {
+		ftpCmdCodes[cmd] = append([]int(nil), expectedCodes...)
+	} else {
+		delete(ftpCmdCodes, cmd)
+	}
+	return cmd, nil
 }
 
 // The FTP client structure containing:
@@ -102,10 +181,82 @@ type FTP struct {
 	logger        *log.Logger
 	timeoutInMsec time.Duration
 	textprotoConn *textproto.Conn
-	dialer        proxy.Dialer
+	dialer        socks5.Dialer
+	serverName    string // name of the server for TLS and HOST when Host is an address, see SetServerName
+	proxy         string // redacted URL of the proxy used by Connect, empty for none
+	proxyEnv      bool   // the proxy comes from the environment
 	conn          net.Conn
-	encoding      string
+	encoding      NameEncoding
 	stop          chan bool
+	afterCurrent  atomic.Bool       // StopAfterCurrent was called
+	running       atomic.Int32      // transfers and jobs running, which Stop interrupts
+	jobs          atomic.Int32      // tree and sync jobs running, which StopAfterCurrent winds down
+	connMutex     sync.Mutex        // guards conn against the context watchers, see interrupt
+	features      map[string]string // FEAT keywords in upper case -> parameters, nil until Feat is called
+	siteCmds      map[string]bool   // SITE subcommands listed by SITE HELP, nil until SiteHelp is called
+	probe         ProbeStrategy     // how Exists and IsDir probe paths
+	mlstFacts     []string          // MLST facts selected by OptsMLST, nil for the server's default
+	alloRefused   bool              // the server rejected ALLO, do not pre-announce sizes anymore
+	noCompression bool              // do not negotiate MODE Z
+	modeZ         bool              // data connections are deflate compressed (MODE Z)
+	zPolicy       CompressionPolicy // which transfers are compressed in MODE Z
+	zLevel        int               // deflate level set by OptsModeZLevel, 0 for the default
+	zSkipExts     map[string]bool   // extensions not compressed, DefaultIncompressibleExtensions if empty
+	negotiation   *Negotiation
+	strictness    Strictness
+	removePartial bool // remove the local file of a failed download
+	journal       *Journal
+	lastCode      int           // code of the last reply read
+	lastMsg       string        // text of the last reply read
+	listLimits    []int         // entry counts flagged by ListTruncated, DefaultListLimits if nil
+	listTrunc     string        // why the last listing looks truncated, empty if it does not
+	tzOffset      time.Duration // offset of the server's local time from UTC, see SetServerTimezone
+	greeting      GreetingPolicy
+	greetingWait  time.Duration
+	autoUTF8      bool // send OPTS UTF8 ON after login when the server lists UTF8
+	loginPolicy   LoginPolicy
+	utf8          bool // the server accepted OPTS UTF8 ON
+	replies       replyHistory
+	drainTimeout  time.Duration
+	textExts      map[string]bool // extensions transferred in ASCII by the Auto mode, DefaultTextExtensions if empty
+	treeMode      TransferMode    // mode of the files uploaded by UploadDirTree
+	permMapper    PermissionMapper
+	sec           security // RFC 2228 state of the session
+	stats         sessionStats
+	dataDeadline  time.Time        // deadline of the data connections, set by TransferOptions.MaxDuration
+	onSize        func(size int64) // receives the size announced by the 150 or 125 reply of a download
+	skipPolicy    SkipPolicy
+	onSkip        SkipFunc
+	flatten       FlattenMode
+	receiptOpts   *ReceiptOptions
+	receipt       *Receipt // of the running or last UploadDirTree
+	timeouts      adaptiveTimeout
+	onUnsolicited UnsolicitedFunc
+	unsolicited   time.Duration // wait for unsolicited replies before sending a command
+	transferLog   bool
+	idle          int // idle timeout honored by SITE IDLE, in seconds
+	dedup         DedupMode
+	dups          *dupIndex     // files uploaded by the running UploadDirTree, if deduplicating
+	noSiteCopy    bool          // SITE CPFR/CPTO is not supported
+	finalWait     time.Duration // bounds the wait for the final reply of a transfer, 0 for none
+	lateReply     time.Duration // how long the final reply of the last transfer, still due, is awaited
+	pacer         commandPacer
+	dirStack      []string   // working directories saved by PushD
+	upGroup       *RateGroup // shared limit of the uploads, see SetRateGroups
+	downGroup     *RateGroup
+	dialFunc      func(ctx context.Context, network, addr string) (net.Conn, error)
+	checkpoints   CheckpointStore
+	ckInterval    int64 // bytes between two checkpoints
+	treeRetries   int   // retries of the files of the tree operations
+	treeRetryWait time.Duration
+	onRetry       RetryFunc
+	onMutation    MutationFunc
+	heartbeatOpts *HeartbeatOptions
+	heartbeat     *heartbeat // of the running tree or sync job
+	caseFolding   CaseFolding
+	caseFound     CaseFolding // resolution of CaseDetect, CaseDetect until probed
+	hashCache     HashCache
+	blockTuning   bool // tune the block size of the binary transfers
 }
 
 type NameFactsLine struct {
@@ -117,11 +268,42 @@ func getTimeoutInMsec(msec int64) time.Time {
 	return time.Now().Add(time.Duration(msec) * time.Millisecond)
 }
 
+// String returns the command verb, or FtpCmd(n) for values which are neither
+// built in nor registered via RegisterFtpCmd.
 func (i FtpCmd) String() string {
-	if cmd, ok := ftpCmdStrings[i]; ok {
+	if cmd, ok := i.lookup(); ok {
 		return cmd
 	}
-	panic("No cmd found")
+	return "FtpCmd(" + strconv.Itoa(int(i)) + ")"
+}
+
+// IsValid reports whether the command is built in or has been registered.
+func (i FtpCmd) IsValid() bool {
+	_, ok := i.lookup()
+	return ok
+}
+
+func (i FtpCmd) lookup() (string, bool) {
+	ftpCmdMutex.RLock()
+	defer ftpCmdMutex.RUnlock()
+	cmd, ok := ftpCmdStrings[i]
+	return cmd, ok
+}
+
+// accepts reports whether code is an expected positive reply for the command.
+func (i FtpCmd) accepts(code int) bool {
+	ftpCmdMutex.RLock()
+	defer ftpCmdMutex.RUnlock()
+	codes, ok := ftpCmdCodes[i]
+	if !ok {
+		return true
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
 }
 
 func (i FtpCmd) AppendParameters(pars ...string) string {
@@ -143,9 +325,67 @@ func (ftp *FTP) writeInfo(params ...interface{}) {
 	}
 }
 
+// traceLevel is the debug level logging the hot loops, every block transferred.
+const traceLevel = 3
+
+// writeTrace logs at the trace level, the callers in hot loops check ftp.tracing()
+// first so as not to pay for building the parameters.
+func (ftp *FTP) writeTrace(params ...interface{}) {
+	if ftp.tracing() {
+		log.Println(params...)
+	}
+}
+
+func (ftp *FTP) tracing() bool {
+	return ftp.debugging >= traceLevel
+}
+
+// SetTransferLog sets whether a single line is logged for every data transfer ended,
+// whatever the debug level, e.g. "Transfer RETR /f.bin: 10000 bytes in 12ms, ok".
+func (ftp *FTP) SetTransferLog(on bool) {
+	ftp.transferLog = on
+}
+
+// logTransfer logs a transfer ended, if SetTransferLog is on.
+func (ftp *FTP) logTransfer(ts *TransferStats) {
+	if !ftp.transferLog || ts == nil {
+		return
+	}
+	result := "ok"
+	if ts.Err != nil {
+		result = "failed: " + ts.Err.Error()
+	}
+	log.Printf("Transfer %s: %d bytes in %v, %s", ts.Command, ts.Bytes, ts.Duration.Round(time.Millisecond), result)
+}
+
+// Stop interrupts the running download from another goroutine; the download
+// returns NewErrStop, DownloadFileWithOptions an *ErrPartialTransfer.
+// Called while no transfer runs, it has no effect.
 func (ftp *FTP) Stop() {
-	ftp.stop = make(chan bool)
-	ftp.stop <- true
+	if ftp.running.Load() == 0 {
+		return
+	}
+	select {
+	case ftp.stop <- true:
+	default: // already requested
+	}
+}
+
+// stopped reports whether Stop has been called.
+func (ftp *FTP) stopped() bool {
+	select {
+	case <-ftp.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetKeepPartialDownloads sets whether DownloadFileWithOptions keeps the partial local file
+// when a download fails or is stopped, so that it can be resumed with the Offset of ErrPartialTransfer.
+// Partial files are kept by default.
+func (ftp *FTP) SetKeepPartialDownloads(keep bool) {
+	ftp.removePartial = !keep
 }
 
 // NewFTP creates a new FTP client using a debug level, default is 0, which is disabled.
@@ -155,6 +395,9 @@ func (ftp *FTP) Stop() {
 // 		0 -> disabled
 // 		1 -> information
 // 		2 -> verbose
+// 		3 -> trace, every block transferred included
+//
+// Below the trace level transfers log the bytes and blocks read once they end.
 //
 func NewFTP(debuglevel int) *FTP {
 	logger := log.New(os.Stdout, "", log.LstdFlags) //syslog.NewLogger(syslog.LOG_ERR, 999)
@@ -164,6 +407,7 @@ func NewFTP(debuglevel int) *FTP {
 		logger:    logger,
 		//timeoutInMsec: DefaultTimeoutInMsec,
 		passiveserver: true,
+		stop:          make(chan bool, 1),
 	}
 	return ftp
 }
@@ -181,7 +425,15 @@ func (ftp *FTP) SetFTPTimeout(timeout time.Duration) error {
 }
 
 // Connect connects to the host by using the specified port or the default one if the value is <=0.
+// Failures are reported as *ErrConnect, classified by their Kind.
 func (ftp *FTP) Connect(host string, port int, socks5ProxyUrl string) (resp *Response, err error) {
+	return ftp.ConnectContext(context.Background(), host, port, socks5ProxyUrl)
+}
+
+// ConnectContext is Connect bounded by ctx: cancelling it interrupts the name resolution,
+// the proxy handshake and the wait for the greeting, and fails with an ErrConnect
+// of kind ConnectCanceled, or ConnectTimeout when its deadline passed.
+func (ftp *FTP) ConnectContext(ctx context.Context, host string, port int, socks5ProxyUrl string) (resp *Response, err error) {
 
 	if len(host) == 0 {
 		return nil, errors.New("The host must be specified")
@@ -199,37 +451,193 @@ func (ftp *FTP) Connect(host string, port int, socks5ProxyUrl string) (resp *Res
 	// use the system proxy if emtpy
 	if socks5ProxyUrl == "" {
 		ftp.writeInfo("using environment proxy, url: ", os.Getenv("all_proxy"))
-		ftp.dialer = proxy.FromEnvironment()
+		ftp.dialer = socks5.FromEnvironment()
 	} else {
-		ftp.dialer = proxy.Direct
-
-		if u, err1 := url.Parse(socks5ProxyUrl); err1 == nil {
-			p, err2 := proxy.FromURL(u, proxy.Direct)
-			if err2 == nil {
-				ftp.dialer = p
-			}
+		// an invalid proxy is an error rather than a direct connection bypassing it
+		u, err1 := url.Parse(socks5ProxyUrl)
+		if err1 == nil {
+			ftp.dialer, err1 = socks5.FromURL(u, socks5.Direct)
+		}
+		if err1 != nil {
+			return nil, &ErrConnect{Kind: ConnectProxy, Addr: addr, Err: err1}
 		}
-
 	}
 
-	err = ftp.NewConn(addr)
-	if err != nil {
-		return
+	ftp.resolveProxy(socks5ProxyUrl, ftp.Host)
+
+	if err = ftp.newConn(ctx, addr); err != nil {
+		return nil, classifyDialError(addr, ftp.timeoutInMsec <= 0 && ftp.dialer != socks5.Direct, err)
 	}
 
-	ftp.writeInfo("host:", ftp.Host, " port:", strconv.Itoa(ftp.Port), " proxy enabled:", ftp.dialer != proxy.Direct)
+	ftp.writeInfo("host:", ftp.Host, " port:", strconv.Itoa(ftp.Port), " proxy enabled:", ftp.dialer != socks5.Direct)
 
 	// NOTE: this is an absolute time that needs refreshing after each READ/WRITE net operation
 	//ftp.conn.conn.SetDeadline(getTimeoutInMsec(ftp.timeoutInMsec))
 
-	if resp, err = ftp.Read(NONE_FTP_CMD); err != nil {
-		return
+	return ftp.greet(ctx, addr)
+}
+
+// ConnectConn starts a session over conn, a connection to the server established by the
+// caller, e.g. through a custom tunnel or an in-memory pipe in tests: it reads the greeting
+// like Connect, without dialing. The Host and Port are taken from the remote address of conn
+// if it has one, they address the data connections of the passive mode unless SetDialer
+// opens them otherwise. conn is closed if the greeting fails.
+func (ftp *FTP) ConnectConn(conn net.Conn) (resp *Response, err error) {
+	addr := conn.RemoteAddr().String()
+	if host, port, err1 := net.SplitHostPort(addr); err1 == nil {
+		ftp.Host = host
+		ftp.Port, _ = strconv.Atoi(port)
+	}
+	ftp.useConn(conn)
+	return ftp.greet(context.Background(), addr)
+}
+
+// NewFTPFromConn returns a client driving the FTP protocol over conn, see ConnectConn.
+func NewFTPFromConn(conn net.Conn) (*FTP, *Response, error) {
+	ftp := NewFTP(0)
+	resp, err := ftp.ConnectConn(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ftp, resp, nil
+}
+
+// greet reads the greeting of the server at addr on the new control connection.
+func (ftp *FTP) greet(ctx context.Context, addr string) (resp *Response, err error) {
+	stop := watchContext(ctx, ftp.interrupt)
+	resp, err = ftp.readGreeting()
+	stop()
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		kind := ConnectBanner
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			kind = ConnectTimeout
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+			kind = classifyDialError(addr, false, err).Kind
+		}
+		ftp.conn.Close()
+		ftp.setConn(nil)
+		return nil, &ErrConnect{Kind: kind, Addr: addr, Err: err}
 	}
 	ftp.welcome = resp.Message
+	ftp.stats.connect(ftp.Host)
 	ftp.writeInfo("Successfully connected on local address:", ftp.conn.LocalAddr())
+	ftp.sendHost()
+	if ftp.loginPolicy == LoginSkip {
+		ftp.loggedIn()
+	}
 	return
 }
 
+// GreetingPolicy defines how the greeting of the server is validated by Connect.
+type GreetingPolicy int
+
+const (
+	// GreetingDefault accepts any positive greeting, a code other than 220 is a
+	// protocol deviation handled according to the Strictness.
+	GreetingDefault GreetingPolicy = iota
+	// GreetingStrict only accepts a 220 greeting, optionally preceded by 120.
+	GreetingStrict
+	// GreetingIgnore skips whatever the server sends first, up to a "220 " line or until
+	// the greeting timeout, for appliances sending broken multi-line greetings.
+	GreetingIgnore
+)
+
+// DefaultGreetingTimeout is how long GreetingIgnore waits for a greeting by default.
+const DefaultGreetingTimeout = 5 * time.Second
+
+// SetGreetingPolicy sets how Connect validates the greeting, timeout only applies
+// to GreetingIgnore and defaults to DefaultGreetingTimeout if <= 0.
+func (ftp *FTP) SetGreetingPolicy(policy GreetingPolicy, timeout time.Duration) {
+	ftp.greeting = policy
+	ftp.greetingWait = timeout
+}
+
+// readGreeting reads the greeting of the server according to the greeting policy.
+func (ftp *FTP) readGreeting() (resp *Response, err error) {
+	if ftp.greeting == GreetingIgnore {
+		return ftp.skipGreeting()
+	}
+	if resp, err = ftp.Read(NONE_FTP_CMD); err != nil {
+		return nil, err
+	}
+	if resp.Code == 120 {
+		// service ready in nnn minutes, the 220 follows
+		ftp.writeInfo("Waiting for the server:", resp.Message)
+		if resp, err = ftp.Read(NONE_FTP_CMD); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Code != StatusReady {
+		if ftp.greeting == GreetingStrict {
+			return nil, NewErrProto(fmt.Errorf("Invalid greeting %d %s", resp.Code, resp.Message))
+		}
+		if err = ftp.quirk("greeting answered with %d instead of 220", resp.Code); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// skipGreeting discards the lines sent by the server until a "220 " line or the greeting timeout.
+func (ftp *FTP) skipGreeting() (*Response, error) {
+	wait := ftp.greetingWait
+	if wait <= 0 {
+		wait = DefaultGreetingTimeout
+	}
+	ftp.conn.SetReadDeadline(time.Now().Add(wait))
+	defer ftp.conn.SetReadDeadline(time.Time{})
+
+	var lines []string
+	for {
+		line, err := ftp.textprotoConn.ReadLine()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				ftp.writeInfo("No valid greeting before the timeout, going on with:", lines)
+				return &Response{Code: StatusReady, Message: strings.Join(lines, "\n")}, nil
+			}
+			return nil, err
+		}
+		if strings.HasPrefix(line, "220 ") {
+			resp := &Response{Code: StatusReady, Message: line[4:]}
+			ftp.replies.add(resp)
+			return resp, nil
+		}
+		ftp.replies.add(&Response{Message: line})
+		lines = append(lines, line)
+	}
+}
+
+// Strictness defines how deviations of the server from the protocol are handled.
+type Strictness int
+
+const (
+	// Lenient applies the known workarounds for misbehaving servers, the default.
+	Lenient Strictness = iota
+	// Strict returns a protocol error for any deviation, useful in tests and conformance tools.
+	Strict
+)
+
+// SetStrictness sets how protocol deviations are handled for the session.
+func (ftp *FTP) SetStrictness(strictness Strictness) {
+	ftp.strictness = strictness
+}
+
+// quirk reports a protocol deviation of the server: a protocol error in Strict mode,
+// otherwise it is only logged and the caller applies its workaround.
+func (ftp *FTP) quirk(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if ftp.strictness == Strict {
+		return NewErrProto(errors.New(msg))
+	}
+	ftp.writeInfo("Working around a protocol deviation:", msg)
+	return nil
+}
+
 // SetPassive sets the mode to passive or active for data transfers.
 // With a false statement use the normal PORT mode.
 // With a true statement use the PASV command.
@@ -237,8 +645,31 @@ func (ftp *FTP) SetPassive(ispassive bool) {
 	ftp.passiveserver = ispassive
 }
 
-// Login logs on to the server.
+// LoginPolicy defines how Login authenticates, for gateways which authenticate their
+// clients otherwise and accept commands without USER/PASS.
+type LoginPolicy int
+
+const (
+	// LoginRequired sends USER, PASS and ACCT as needed, any refusal fails Login.
+	LoginRequired LoginPolicy = iota
+	// LoginOptional sends USER, but a 530 or 502 reply to it means that the session
+	// needs no login: Login then succeeds and returns the greeting.
+	LoginOptional
+	// LoginSkip sends nothing: Login returns the greeting and Connect already prepares
+	// the session as Login would, so that Login need not be called at all.
+	LoginSkip
+)
+
+// SetLoginPolicy sets how Login authenticates, LoginRequired by default.
+func (ftp *FTP) SetLoginPolicy(policy LoginPolicy) {
+	ftp.loginPolicy = policy
+}
+
+// Login logs on to the server, as configured by SetLoginPolicy.
 func (ftp *FTP) Login(username, password string, acct string) (response *Response, err error) {
+	if ftp.loginPolicy == LoginSkip {
+		return &Response{Code: StatusReady, Message: ftp.welcome}, nil
+	}
 
 	//Login, default anonymous.
 	if len(username) == 0 {
@@ -262,6 +693,11 @@ func (ftp *FTP) Login(username, password string, acct string) (response *Respons
 	ftp.writeInfo("username:", username)
 	tempResponse, err := ftp.SendAndRead(USER_FTP_CMD, username)
 	if err != nil {
+		if code := replyCode(err); ftp.loginPolicy == LoginOptional && (code == StatusNotLoggedIn || code == StatusNotImplemented) {
+			ftp.writeInfo("USER refused, the session needs no login:", err)
+			ftp.loggedIn()
+			return &Response{Code: StatusReady, Message: ftp.welcome}, nil
+		}
 		return
 	}
 
@@ -272,7 +708,7 @@ func (ftp *FTP) Login(username, password string, acct string) (response *Respons
 			return
 		}
 	}
-	if tempResponse.getFirstChar() == "3" {
+	if tempResponse.IsPositiveIntermediate() {
 		tempResponse, err = ftp.SendAndRead(ACCT_FTP_CMD, acct)
 		if err != nil {
 			return
@@ -283,9 +719,83 @@ func (ftp *FTP) Login(username, password string, acct string) (response *Respons
 		err = NewErrReply(errors.New(tempResponse.Message))
 		return
 	}
+	ftp.loggedIn()
 	return tempResponse, err
 }
 
+// Relogin logs on to the server again on the same connection, with REIN then Login, e.g.
+// with credentials rotated since the first login. REIN resets the session to its state
+// after the greeting, the transfer parameters included, and so does the client with what
+// it learnt of the previous user: the features, the refused commands, the folder stack and
+// the detected case folding. A protected control connection stays so, PBSZ and PROT are
+// negotiated again. Servers not implementing REIN fail, the session needs to be reconnected then.
+func (ftp *FTP) Relogin(username, password string, acct string) (response *Response, err error) {
+	if response, err = ftp.SendAndRead(REIN_FTP_CMD); err != nil {
+		return
+	}
+	if response.Code != StatusReady {
+		return response, ftp.quirk("REIN answered with %d instead of 220", response.Code)
+	}
+	sec := ftp.sec
+	ftp.resetSession()
+	ftp.features, ftp.siteCmds = nil, nil
+	ftp.alloRefused = false
+	ftp.caseFound = CaseDetect
+	ftp.utf8, ftp.modeZ = false, false
+	ftp.mlstFacts, ftp.zLevel = nil, 0
+	if sec.state >= secAuth {
+		ftp.sec.state, ftp.sec.config = secAuth, sec.config
+		if _, err = ftp.negotiatePbsz(); err != nil {
+			return nil, err
+		}
+		prot := sec.prot
+		if prot == 0 {
+			prot = ProtPrivate
+		}
+		if err = ftp.Prot(prot); err != nil {
+			return nil, err
+		}
+	}
+	return ftp.Login(username, password, acct)
+}
+
+// loggedIn prepares the session once logged in.
+func (ftp *FTP) loggedIn() {
+	if ftp.autoUTF8 {
+		ftp.enableUTF8()
+	}
+}
+
+// SetAutoUTF8 makes Login switch the session to UTF-8 file names with OPTS UTF8 ON
+// when the server lists UTF8 in its FEAT reply, which is then requested if needed.
+// A refusal does not fail the login, UTF8Enabled tells the outcome.
+func (ftp *FTP) SetAutoUTF8(enabled bool) {
+	ftp.autoUTF8 = enabled
+}
+
+// UTF8Enabled reports whether the server accepted OPTS UTF8 ON, sent by Login or Negotiate.
+func (ftp *FTP) UTF8Enabled() bool {
+	return ftp.utf8
+}
+
+// enableUTF8 sends OPTS UTF8 ON if the server supports it and records the outcome.
+func (ftp *FTP) enableUTF8() error {
+	if ftp.features == nil {
+		if _, err := ftp.Feat(); err != nil {
+			ftp.writeInfo("FEAT failed, not enabling UTF-8:", err)
+			return err
+		}
+	}
+	if ftp.utf8 || !ftp.HasFeature("UTF8") {
+		return nil
+	}
+	if _, err := ftp.OptsUTF8(true); err != nil {
+		ftp.writeInfo("OPTS UTF8 ON refused:", err)
+		return err
+	}
+	return nil
+}
+
 // Abort interrupts a file transfer, which uses out-of-band data.
 // This does not follow the procedure from the RFC to send Telnet IP and Synch;
 // that does not seem to work with all servers. Instead just send the ABOR command as OOB data.
@@ -308,7 +818,7 @@ func (ftp *FTP) makePasv() (host string, port int, err error) {
 	if err != nil {
 		return
 	}
-	return parse227(resp)
+	return ftp.parse227(resp)
 }
 
 // Acct sends an ACCT command.
@@ -328,32 +838,58 @@ func (ftp *FTP) Acct() (response *Response, err error) {
 func (ftp *FTP) Mlsd(path string, facts []string) (ls []*NameFactsLine, err error) {
 
 	if len(facts) > 0 {
-		if _, err = ftp.Opts("MLST", strings.Join(facts, ";")+";"); err != nil {
+		if _, err = ftp.OptsMLST(facts...); err != nil {
 			return nil, err
 		}
 	}
 
 	sw := &stringSliceWriter{make([]string, 0, 50)}
 	if err = ftp.GetLines(MLSD_FTP_CMD, sw, path); err != nil {
-		return nil, err
+		return nil, ftp.unavailable(err, "MLST", "Listing with MLSD", "list with LIST")
 	}
 
-	ls = make([]*NameFactsLine, len(sw.s))
+	ls = make([]*NameFactsLine, 0, len(sw.s))
 	for _, l := range sw.s {
-		tkns := strings.Split(strings.TrimSpace(l), " ")
-		name := tkns[0]
-		facts := strings.Split(tkns[1], ";")
+		// "fact1=val1;fact2=val2; name", the name may contain blanks
+		i := strings.Index(l, " ")
+		if i < 0 {
+			ftp.writeInfo("Skipping MLSD line:", l)
+			continue
+		}
+		facts := strings.Split(l[:i], ";")
 		ftp.writeInfo("Found facts:", facts)
-		vals := make(map[string]string, len(facts)-1)
-		for i := 0; i < len(facts)-1; i++ {
-			fpair := strings.Split(facts[i], "=")
-			vals[fpair[0]] = fpair[1]
+		vals := make(map[string]string, len(facts))
+		for _, f := range facts {
+			if fpair := strings.SplitN(f, "=", 2); len(fpair) == 2 {
+				vals[strings.ToLower(fpair[0])] = fpair[1]
+			}
 		}
-		ls = append(ls, &NameFactsLine{strings.ToLower(name), vals})
+		ls = append(ls, &NameFactsLine{strings.TrimRight(l[i+1:], "\r\n"), vals})
 	}
 	return
 }
 
+// Mdtm returns the last modification time of a file, in UTC.
+func (ftp *FTP) Mdtm(filename string) (t time.Time, err error) {
+	var response *Response
+	if response, err = ftp.SendAndRead(MDTM_FTP_CMD, filename); err != nil {
+		return t, ftp.unavailable(err, "MDTM", "Querying a modification time", "read it from a LIST of the folder")
+	}
+	if response.Code != StatusFile {
+		return t, NewErrReply(errors.New(response.Message))
+	}
+	return parseMdtmTime(response.Message)
+}
+
+// parseMdtmTime parses the YYYYMMDDHHMMSS[.sss] time values of MDTM replies and MLSD modify facts.
+func parseMdtmTime(s string) (time.Time, error) {
+	t, err := replyparse.ModTime(s)
+	if err != nil {
+		return t, NewErrProto(err)
+	}
+	return t, nil
+}
+
 // Feat lists all new FTP features that the server supports beyond those described in RFC 959.
 func (ftp *FTP) Feat(params ...string) (fts []string, err error) {
 	var r *Response
@@ -361,7 +897,65 @@ func (ftp *FTP) Feat(params ...string) (fts []string, err error) {
 		return
 	}
 
-	return parse211(r)
+	if fts, err = parse211(r); err != nil {
+		return
+	}
+	ftp.features = make(map[string]string, len(fts))
+	for _, ft := range fts {
+		name, params := ft, ""
+		if i := strings.IndexByte(ft, ' '); i > 0 {
+			name, params = ft[:i], strings.TrimSpace(ft[i+1:])
+		}
+		name = strings.ToUpper(name)
+		if p, ok := ftp.features[name]; ok && p != "" {
+			// repeated keywords such as SITE MKDIR and SITE SYMLINK of ProFTPD
+			params = p + ";" + params
+		}
+		ftp.features[name] = params
+	}
+	return fts, nil
+}
+
+// HasFeature reports whether the server listed the feature in its FEAT reply,
+// for instance "MDTM" or "REST STREAM". It is always false before Feat has been called.
+// A "SITE name" feature is also reported for a subcommand listed by SiteHelp.
+func (ftp *FTP) HasFeature(feature string) bool {
+	name, params := feature, ""
+	if i := strings.IndexByte(feature, ' '); i > 0 {
+		name, params = feature[:i], strings.TrimSpace(feature[i+1:])
+	}
+	if strings.EqualFold(name, "SITE") && ftp.hasSiteCommand(params) {
+		return true
+	}
+	p, ok := ftp.features[strings.ToUpper(name)]
+	if !ok || params == "" {
+		return ok
+	}
+	for _, f := range strings.FieldsFunc(strings.ToUpper(p), func(r rune) bool { return r == ' ' || r == ';' }) {
+		// a trailing * marks the selected option, e.g. HASH SHA-1;SHA-256*
+		if strings.TrimSuffix(f, "*") == strings.ToUpper(params) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allo sends an ALLO command announcing the size of the next file to be stored.
+func (ftp *FTP) Allo(size int64) (response *Response, err error) {
+	return ftp.SendAndRead(ALLO_FTP_CMD, strconv.FormatInt(size, 10))
+}
+
+// preAnnounce sends ALLO before uploading size bytes when the server advertises
+// ALLO or REST STREAM. A refused ALLO is remembered and not an error, since the
+// command is only advisory.
+func (ftp *FTP) preAnnounce(size int64) {
+	if size <= 0 || ftp.alloRefused || !(ftp.HasFeature("ALLO") || ftp.HasFeature("REST STREAM")) {
+		return
+	}
+	if r, err := ftp.Allo(size); err != nil || r.Code == StatusCommandNotImplemented {
+		ftp.writeInfo("ALLO is not supported, not announcing sizes anymore:", err)
+		ftp.alloRefused = true
+	}
 }
 
 // Nlst returns a list of file in a directory, by default the current.
@@ -385,11 +979,12 @@ func (ftp *FTP) getList(cmd FtpCmd, params ...string) (filelist []string, err er
 
 // Rename renames a file.
 func (ftp *FTP) Rename(fromname string, toname string) (response *Response, err error) {
+	defer ftp.record(&JournalEntry{Op: "RENAME", Path: fromname, Target: toname}, time.Now(), &err)
 	tempResponse, err := ftp.SendAndRead(RENAMEFROM_FTP_CMD, fromname)
 	if err != nil {
 		return nil, err
 	}
-	if tempResponse.getFirstChar() != "3" {
+	if !tempResponse.IsPositiveIntermediate() {
 		err = NewErrReply(errors.New(tempResponse.Message))
 		return nil, err
 	}
@@ -398,44 +993,60 @@ func (ftp *FTP) Rename(fromname string, toname string) (response *Response, err
 
 // Delete deletes a file.
 func (ftp *FTP) Delete(filename string) (response *Response, err error) {
+	defer ftp.record(&JournalEntry{Op: "DELE", Path: filename}, time.Now(), &err)
 	tempResponse, err := ftp.SendAndRead(DELETE_FTP_CMD, filename)
 	if err != nil {
 		return nil, err
 	}
-	if c := tempResponse.Code; c == StatusRequestedFileActionOK || c == StatusCommandOK {
+	switch tempResponse.Code {
+	case StatusRequestedFileActionOK:
+		return tempResponse, nil
+	case StatusCommandOK:
+		if err = ftp.quirk("DELE answered with %d instead of 250", tempResponse.Code); err != nil {
+			return nil, err
+		}
 		return tempResponse, nil
-	} else {
-		return nil, NewErrReply(errors.New(tempResponse.Message))
 	}
-	return
+	return nil, NewErrReply(errors.New(tempResponse.Message))
 }
 
 // Cwd changes to current directory.
+// The directory the server reports in its reply, if any, is set as the Path of the response,
+// so that callers can check how a name with spaces or odd characters was understood; many
+// servers name none, Pwd then tells.
 func (ftp *FTP) Cwd(dirname string) (response *Response, err error) {
 	if dirname == ".." {
-		return ftp.SendAndRead(CDUP_FTP_CMD)
-	} else if dirname == "" {
-		dirname = "."
+		response, err = ftp.SendAndRead(CDUP_FTP_CMD)
+	} else {
+		if dirname == "" {
+			dirname = "."
+		}
+		response, err = ftp.SendAndRead(CWD_FTP_CMD, dirname)
+	}
+	if err == nil {
+		response.Path, _ = replyparse.CwdDirname(response.Message)
 	}
-	return ftp.SendAndRead(CWD_FTP_CMD, dirname)
+	return
 }
 
 // Size retrieves the size of a file.
 func (ftp *FTP) Size(filename string) (size int, err error) {
 	response, err := ftp.SendAndRead(SIZE_FTP_CMD, filename)
 	if err != nil {
-		return
+		return 0, ftp.unavailable(err, "SIZE", "Querying a file size", "read it from a LIST of the file")
 	}
-	if response.Code == StatusFile {
-		//size, _ = strconv.Atoi(strings.TrimSpace(response.Message[3:]))
-		size, _ = strconv.Atoi(response.Message)
-		return size, err
+	if response.Code != StatusFile {
+		return 0, ftp.quirk("SIZE answered with %d instead of 213", response.Code)
 	}
-	return
+	if size, err = strconv.Atoi(strings.TrimSpace(response.Message)); err != nil {
+		return 0, NewErrProto(fmt.Errorf("Invalid SIZE reply: %s", response.Message))
+	}
+	return size, nil
 }
 
 // Mkd creates a directory and returns its full pathname.
 func (ftp *FTP) Mkd(dirname string) (dname string, err error) {
+	defer ftp.record(&JournalEntry{Op: "MKD", Path: dirname}, time.Now(), &err)
 	var response *Response
 	response, err = ftp.SendAndRead(MKDIR_FTP_CMD, dirname)
 	if err != nil {
@@ -444,13 +1055,14 @@ func (ftp *FTP) Mkd(dirname string) (dname string, err error) {
 	// fix around non-compliant implementations such as IIS shipped
 	// with Windows server 2003
 	if response.Code != StatusPathCreated {
-		return "", nil
+		return "", ftp.quirk("MKD answered with %d instead of 257", response.Code)
 	}
-	return parse257(response)
+	return ftp.parse257(response)
 }
 
 // Rmd removes a directory.
 func (ftp *FTP) Rmd(dirname string) (response *Response, err error) {
+	defer ftp.record(&JournalEntry{Op: "RMD", Path: dirname}, time.Now(), &err)
 	return ftp.SendAndRead(RMDIR_FTP_CMD, dirname)
 }
 
@@ -463,80 +1075,66 @@ func (ftp *FTP) Pwd() (dirname string, err error) {
 		return "", err
 	}
 	if response.Code != 257 {
-		return "", nil
+		return "", ftp.quirk("PWD answered with %d instead of 257", response.Code)
 	}
-	return parse257(response)
+	return ftp.parse257(response)
 }
 
 // Quits sends a QUIT command and closes the connection.
+// The client starts no goroutine outliving the call that spawned it, except the dial
+// through a proxy without DialContext abandoned by ConnectContext, which ends with the dial.
 func (ftp *FTP) Quit() (response *Response, err error) {
 	response, err = ftp.SendAndRead(QUIT_FTP_CMD)
 	if ftp.conn != nil {
 		ftp.conn.Close()
-		ftp.conn = nil
+		ftp.setConn(nil)
 	}
 
 	return
 }
 
-// DownloadFile downloads a file and stores it locally.
-// There are two modes:
-// - binary, 				useLineMode = false
-// - line by line (text), 	useLineMode = true
-func (ftp *FTP) DownloadFile(remotename string, localpath string, useLineMode bool) (err error) {
-	// remove local file
-	os.Remove(localpath)
-	var f *os.File
-	f, err = os.OpenFile(localpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	defer f.Close()
+// DefaultQuitTimeout bounds the wait for the reply to QUIT of the sessions ended by WithSession and Pool.
+const DefaultQuitTimeout = 5 * time.Second
 
-	if err != nil {
+// QuitTimeout is Quit waiting at most timeout for the server to answer, after which the
+// connection is closed anyway, so that a shutdown does not hang on a dead server. forced
+// reports that the connection was closed before the reply arrived, err then tells so.
+// A timeout <= 0 waits as long as Quit.
+func (ftp *FTP) QuitTimeout(timeout time.Duration) (response *Response, forced bool, err error) {
+	if ftp.conn == nil || timeout <= 0 {
+		response, err = ftp.Quit()
 		return
 	}
-
-	if useLineMode {
-		w := newTextFileWriter(f)
-		defer w.bw.Flush() // remember to flush
-		if err = ftp.GetLines(RETR_FTP_CMD, w, remotename); err != nil {
-			return err
-		}
-	} else {
-		if err = ftp.GetBytes(RETR_FTP_CMD, f, BLOCK_SIZE, remotename); err != nil {
-			return err
-		}
+	conn := ftp.conn
+	timer := time.AfterFunc(timeout, func() { conn.Close() })
+	response, err = ftp.Quit()
+	if forced = !timer.Stop() && err != nil; forced {
+		ftp.writeInfo("QUIT not answered within", timeout, ", connection closed")
+		err = fmt.Errorf("QUIT not answered within %v, connection closed: %w", timeout, err)
 	}
-
-	return err
+	return
 }
 
-// UploadFile uploads a file from a local path to the current folder (see Cwd too) on the FTP server.
-// A remotename needs to be specified.
-// There are two modes set via the useLineMode flag:
-// - binary, 				useLineMode = false
-// - line by line (text), 	useLineMode = true
-func (ftp *FTP) UploadFile(remotename string, localpath string, useLineMode bool, callback Callback) (err error) {
-	var f *os.File
-	f, err = os.Open(localpath)
-	defer f.Close()
-
-	if err != nil {
-		return
-	}
-
-	if useLineMode {
-		if err = ftp.StoreLines(STORE_FTP_CMD, f, remotename, localpath, callback); err != nil {
-			return err
-		}
+// partialDownload closes the local file of a failed download, removes it unless
+// partial files are kept, and returns the *ErrPartialTransfer describing it.
+func (ftp *FTP) partialDownload(f *os.File, remotename string, localpath string, written int64, cause error) error {
+	e := &ErrPartialTransfer{Remotename: remotename, Localpath: localpath, BytesWritten: written, Err: cause}
+	f.Close()
+	if fi, err := os.Stat(localpath); err == nil {
+		e.Offset = fi.Size()
+	}
+	if !ftp.removePartial {
+		e.Kept = true
+	} else if err := os.Remove(localpath); err != nil && !os.IsNotExist(err) {
+		e.Kept = true // could not be removed
 	} else {
-		if err = ftp.StoreBytes(STORE_FTP_CMD, f, BLOCK_SIZE, remotename, localpath, callback); err != nil {
-			return err
-		}
+		e.Offset = 0
 	}
-
-	return err
+	return e
 }
 
-// Opts returns a list of file in a directory in long form, by default the current.
+// Opts sends an OPTS command with free-form parameters. OptsUTF8, OptsMLST and
+// OptsModeZLevel validate theirs and keep the state of the session in step.
 func (ftp *FTP) Opts(params ...string) (response *Response, err error) {
 	return ftp.SendAndRead(OPTS_FTP_CMD, params...)
 }
@@ -549,19 +1147,37 @@ func (ftp *FTP) Opts(params ...string) (response *Response, err error) {
 // returns:
 //        The response code.
 func (ftp *FTP) GetLines(cmd FtpCmd, writer io.Writer, params ...string) (err error) {
+	if !cmd.IsValid() {
+		return fmt.Errorf("%w: %s", ErrUnknownCmd, cmd)
+	}
+	return ftp.getLines(cmd, cmd.AppendParameters(params...), writer, DataConnSession)
+}
+
+// GetLinesRaw retrieves data in line mode for an arbitrary command line,
+// for instance a nonstandard data-bearing command such as "SITE DUMP".
+func (ftp *FTP) GetLinesRaw(command string, writer io.Writer) (err error) {
+	return ftp.getLines(NONE_FTP_CMD, command, writer, DataConnSession)
+}
+
+func (ftp *FTP) getLines(cmd FtpCmd, line string, writer io.Writer, mode DataConnMode) (err error) {
 	var conn net.Conn
+	var lc *lastByteConn
+	entries := 0
+	if isListing(cmd) {
+		ftp.listTrunc = ""
+	}
 	if _, err = ftp.SendAndRead(TYPE_A_FTP_CMD); err != nil {
 		return
 	}
 
-	// wrap this code up to guarantee the connection disposal via a defer
+	// the data connection is closed by finishTransfer
 	separateCall := func() error {
-		if conn, _, err = ftp.transferCmd(cmd, params...); err != nil {
+		if conn, _, err = ftp.transferLine(cmd, line, mode); err != nil {
 			return err
 		}
-		defer conn.Close() // close the connection on exit
 
-		ftpReader := textproto.NewConn(conn)
+		lc = &lastByteConn{Conn: conn}
+		ftpReader := textproto.NewConn(lc)
 		ftp.writeInfo("Try and get lines via connection for remote address:", conn.RemoteAddr().String())
 
 		for {
@@ -572,9 +1188,15 @@ func (ftp *FTP) GetLines(cmd FtpCmd, writer io.Writer, params ...string) (err er
 					ftp.writeInfo("Reached end of buffer with line:", line)
 					break
 				}
-				return err
+				return dataReadError(err)
 			}
 
+			if isListing(cmd) {
+				line = ftp.decode(line)
+				if len(line) > 0 && !bytes.HasPrefix(line, []byte("total ")) {
+					entries++
+				}
+			}
 			if _, err1 := writer.Write(line); err1 != nil {
 				return err1
 			}
@@ -584,14 +1206,11 @@ func (ftp *FTP) GetLines(cmd FtpCmd, writer io.Writer, params ...string) (err er
 
 	}
 
-	if err := separateCall(); err != nil {
-		return err
+	err = separateCall()
+	if err = ftp.finishTransfer(cmd, conn, true, err); err == nil && lc != nil && isListing(cmd) {
+		ftp.checkListing(entries, lc.last)
 	}
-
-	ftp.writeInfo("Reading final empty line")
-	_, err = ftp.Read(cmd)
-	return
-
+	return err
 }
 
 // GetBytes retrieves data in binary mode.
@@ -605,42 +1224,82 @@ func (ftp *FTP) GetLines(cmd FtpCmd, writer io.Writer, params ...string) (err er
 //Returns:
 //        The response code.
 func (ftp *FTP) GetBytes(cmd FtpCmd, writer io.Writer, blocksize int, params ...string) (err error) {
+	if !cmd.IsValid() {
+		return fmt.Errorf("%w: %s", ErrUnknownCmd, cmd)
+	}
+	return ftp.getBytes(cmd, cmd.AppendParameters(params...), writer, blocksize, 0, DataConnSession)
+}
+
+// GetBytesRaw retrieves data in binary mode for an arbitrary command line,
+// for instance a nonstandard data-bearing command such as "SITE DUMP".
+func (ftp *FTP) GetBytesRaw(command string, writer io.Writer, blocksize int) (err error) {
+	return ftp.getBytes(NONE_FTP_CMD, command, writer, blocksize, 0, DataConnSession)
+}
+
+// getBytes retrieves data in binary mode, restarting at offset if it is not 0, over a data
+// connection opened as mode selects.
+func (ftp *FTP) getBytes(cmd FtpCmd, line string, writer io.Writer, blocksize int, offset int64, mode DataConnMode) (err error) {
+	defer ftp.beginStoppable()()
 	var conn net.Conn
 	if _, err = ftp.SendAndRead(TYPE_I_FTP_CMD); err != nil {
 		return
 	}
+	if err = ftp.restart(offset); err != nil {
+		return
+	}
 
-	// wrap this code up to guarantee the connection disposal via a defer
+	// the data connection is closed by finishTransfer
 	separateCall := func() error {
-		if conn, _, err = ftp.transferCmd(cmd, params...); err != nil {
+		if conn, _, err = ftp.transferLine(cmd, line, mode); err != nil {
 			return err
 		}
-		defer conn.Close() // close the connection on exit
 
+		tuner := ftp.newBlockTuner(blocksize)
+		if tuner != nil {
+			blocksize = tuner.size
+			defer tuner.done()
+		}
+		ftp.stats.setBlockSize(blocksize)
 		bufReader := bufio.NewReaderSize(conn, blocksize)
 
 		ftp.writeInfo("Try and get bytes via connection for remote address:", conn.RemoteAddr().String())
 
-		s := make([]byte, blocksize)
+		buf := getBuffer(blocksize)
+		defer func() { putBuffer(buf) }()
+		s := *buf
 		var n int
+		var blocks, total int64
+		defer func() { ftp.writeInfo("GETBYTES: bytes read:", total, "blocks:", blocks) }()
 
 		for {
-
 			n, err = bufReader.Read(s)
-			ftp.writeInfo("GETBYTES: Number of bytes read:", n)
+			blocks, total = blocks+1, total+int64(n)
+			if ftp.tracing() {
+				ftp.writeTrace("GETBYTES: Number of bytes read:", n)
+			}
 			if _, err1 := writer.Write(s[:n]); err1 != nil {
 				return err1
 			}
+			if tuner != nil {
+				buf, s = ftp.tuneBuffer(buf, tuner.next(n))
+			}
+
+			if err == nil && ftp.stopped() {
+				return NewErrStop
+			}
 
 			if tmpfile, ok := writer.(*os.File); ok {
-				tmpfile.Sync()
+				// not an error for pipes and terminals, which cannot be synced
+				if err1 := tmpfile.Sync(); err1 != nil && ftp.tracing() {
+					ftp.writeTrace("GETBYTES: unable to sync", tmpfile.Name(), err1)
+				}
 			}
 
 			if err != nil {
 				if err == io.EOF {
 					break
 				}
-				return err
+				return dataReadError(err)
 			}
 
 		}
@@ -648,69 +1307,40 @@ func (ftp *FTP) GetBytes(cmd FtpCmd, writer io.Writer, blocksize int, params ...
 		return nil
 	}
 
-	if err := separateCall(); err != nil {
-		return err
-	}
-
-	_, err = ftp.Read(cmd)
-	return
+	err = separateCall()
+	return ftp.finishTransfer(cmd, conn, true, err)
 }
 
-func (ftp *FTP) DownloadResumeFile(remotename string, localpath string, useLineMode bool) (err error) {
-	// remove local file
-	//	os.Remove(localpath)
-	var f *os.File
-	f, err = os.OpenFile(localpath, os.O_WRONLY|os.O_CREATE, 0644)
-	defer f.Close()
-
-	if err != nil {
-		return
+// restart sends REST for a transfer restarting at offset, nothing if offset is 0.
+func (ftp *FTP) restart(offset int64) error {
+	if offset == 0 {
+		return nil
 	}
-
-	if useLineMode {
-		w := newTextFileWriter(f)
-		defer w.bw.Flush() // remember to flush
-		if err = ftp.GetLines(RETR_FTP_CMD, w, remotename); err != nil {
-			return err
-		}
-	} else {
-		var stat os.FileInfo
-		stat, err = f.Stat()
-		if err != nil {
-			return
-		}
-
-		offset := stat.Size()
-		if err = ftp.ResumeFile(RETR_FTP_CMD, f, offset, BLOCK_SIZE, remotename); err != nil {
-			return err
-		}
+	res, err := ftp.SendAndRead(REST_FTP_CMD, strconv.FormatInt(offset, 10))
+	if err != nil {
+		return ftp.unavailable(err, "REST STREAM", "Restarting a transfer", "transfer the whole file")
 	}
-
-	return err
+	ftp.writeInfo("Restarting the transfer:", res.Message)
+	return nil
 }
 
 func (ftp *FTP) ResumeFile(cmd FtpCmd, writer *os.File, offset int64, blocksize int, params ...string) (err error) {
+	defer ftp.beginStoppable()()
 	var conn net.Conn
 	if _, err = ftp.SendAndRead(TYPE_I_FTP_CMD); err != nil {
 		return
 	}
 
-	// wrap this code up to guarantee the connection disposal via a defer
+	// the data connection is closed by finishTransfer
 	separateCall := func() error {
 
-		if offset != 0 {
-			if res, err := ftp.SendAndRead(REST_FTP_CMD, fmt.Sprintf("%d", offset)); err != nil {
-				return err
-			} else {
-				fmt.Println(res)
-			}
-
+		if err := ftp.restart(offset); err != nil {
+			return err
 		}
 
 		if conn, _, err = ftp.transferCmd(cmd, params...); err != nil {
 			return err
 		}
-		defer conn.Close() // close the connection on exit
 
 		bufReader := bufio.NewReaderSize(conn, blocksize)
 
@@ -718,62 +1348,40 @@ func (ftp *FTP) ResumeFile(cmd FtpCmd, writer *os.File, offset int64, blocksize
 
 		s := make([]byte, blocksize)
 		var n int
+		var blocks, total int64
+		defer func() { ftp.writeInfo("GETBYTES: bytes read:", total, "blocks:", blocks) }()
 
 		for {
-			if ftp.stop != nil {
-				select {
-				case <-ftp.stop:
-					return NewErrStop
-				default:
-					n, err = bufReader.Read(s)
-					ftp.writeInfo("GETBYTES: Number of bytes read:", n)
-
-					if _, err1 := writer.WriteAt(s[:n], offset); err1 != nil {
-						return err1
-					}
-					if err2 := writer.Sync(); err2 != nil {
-						return err2
-					}
-
-					offset += int64(n)
-					if err != nil {
-						if err == io.EOF {
-							break
-						}
-						return err
-					}
-				}
-			} else {
-				n, err = bufReader.Read(s)
-				ftp.writeInfo("GETBYTES: Number of bytes read:", n)
+			n, err = bufReader.Read(s)
+			blocks, total = blocks+1, total+int64(n)
+			if ftp.tracing() {
+				ftp.writeTrace("GETBYTES: Number of bytes read:", n)
+			}
 
-				if _, err1 := writer.WriteAt(s[:n], offset); err1 != nil {
-					return err1
-				}
-				if err2 := writer.Sync(); err2 != nil {
-					return err2
-				}
+			if _, err1 := writer.WriteAt(s[:n], offset); err1 != nil {
+				return err1
+			}
+			if err2 := writer.Sync(); err2 != nil {
+				return err2
+			}
 
-				offset += int64(n)
-				if err != nil {
-					if err == io.EOF {
-						break
-					}
-					return err
+			offset += int64(n)
+			if err != nil {
+				if err == io.EOF {
+					break
 				}
+				return err
+			}
+			if ftp.stopped() {
+				return NewErrStop
 			}
-
 		}
 
 		return nil
 	}
 
-	if err := separateCall(); err != nil {
-		return err
-	}
-
-	_, err = ftp.Read(cmd)
-	return
+	err = separateCall()
+	return ftp.finishTransfer(cmd, conn, true, err)
 }
 
 // StoreLines stores a file in line mode.
@@ -787,123 +1395,268 @@ func (ftp *FTP) ResumeFile(cmd FtpCmd, writer *os.File, offset int64, blocksize
 //      Returns:
 //        The response code.
 func (ftp *FTP) StoreLines(cmd FtpCmd, reader io.Reader, remotename string, filename string, callback Callback) (err error) {
+	if !cmd.IsValid() {
+		return fmt.Errorf("%w: %s", ErrUnknownCmd, cmd)
+	}
+	return ftp.storeLines(cmd, reader, remotename, filename, callback, DataConnSession)
+}
+
+func (ftp *FTP) storeLines(cmd FtpCmd, reader io.Reader, remotename string, filename string, callback Callback, mode DataConnMode) (err error) {
 	var conn net.Conn
+	var cw *CountingWriter
 	if _, err = ftp.SendAndRead(TYPE_A_FTP_CMD); err != nil {
 		return
 	}
 
-	// wrap this code up to guarantee the connection disposal via a defer
+	// the data connection is closed by finishTransfer
 	separateCall := func() error {
-		if conn, _, err = ftp.transferCmd(cmd, remotename); err != nil {
+		if conn, _, err = ftp.transferLine(cmd, cmd.AppendParameters(remotename), mode); err != nil {
 			return err
 		}
-		defer conn.Close() // close the connection on exit
 
 		ftp.writeInfo("Try and write lines via connection for remote address:", conn.RemoteAddr().String())
 
 		//lineReader := bufio.NewReader(reader)
 		lineReader := bufio.NewReader(reader)
-
-		var tot int64
+		cw = NewCountingWriter(conn, remotename, filename, callback)
 
 		for {
-			var n int
-			var eof bool
 			line, _, err := lineReader.ReadLine()
 			if err != nil {
-				eof = err == io.EOF
-				if !eof {
-					return err
+				if err == io.EOF {
+					break
 				}
+				return err
 			}
 
 			// !Remember to convert to string (UTF-8 encoding)
-			if !eof {
-				n, err = fmt.Fprintln(conn, string(line))
-				if err != nil {
-					return err
-				}
-			}
-			if callback != nil {
-				tot += int64(n)
-				callback(&CallbackInfo{remotename, filename, tot, eof})
-			}
-
-			if eof {
-				break
+			if _, err = fmt.Fprintln(cw, string(line)); err != nil {
+				return err
 			}
 		}
+		cw.Done()
 		return nil
 
 	}
 
-	if err := separateCall(); err != nil {
-		return err
+	err = separateCall()
+	if err = ftp.finishTransfer(cmd, conn, false, err); err != nil && cw != nil {
+		cw.fail(err)
 	}
-
-	ftp.writeInfo("Reading final empty line")
-
-	_, err = ftp.Read(cmd)
-	return
-
+	return err
 }
 
 // StoreBytes uploads bytes in chunks defined by the blocksize parameter.
 // It uses an io.Reader to read the input data.
 func (ftp *FTP) StoreBytes(cmd FtpCmd, reader io.Reader, blocksize int, remotename string, filename string, callback Callback) (err error) {
+	if !cmd.IsValid() {
+		return fmt.Errorf("%w: %s", ErrUnknownCmd, cmd)
+	}
+	return ftp.storeBytes(cmd, cmd.AppendParameters(remotename), reader, blocksize, 0, DataConnSession, remotename, filename, callback)
+}
+
+// StoreBytesRaw uploads bytes in binary mode for an arbitrary command line,
+// for instance a nonstandard data-bearing command exposed by an appliance.
+// The command line is reported as the resource name to the callback.
+func (ftp *FTP) StoreBytesRaw(command string, reader io.Reader, blocksize int, callback Callback) (err error) {
+	return ftp.storeBytes(NONE_FTP_CMD, command, reader, blocksize, 0, DataConnSession, command, "", callback)
+}
+
+// storeBytes stores data in binary mode, restarting at offset if it is not 0, over a data
+// connection opened as mode selects.
+func (ftp *FTP) storeBytes(cmd FtpCmd, line string, reader io.Reader, blocksize int, offset int64, mode DataConnMode, remotename string, filename string, callback Callback) (err error) {
+	defer ftp.beginStoppable()()
 	var conn net.Conn
+	var cw *CountingWriter
 	if _, err = ftp.SendAndRead(TYPE_I_FTP_CMD); err != nil {
 		return
 	}
+	if err = ftp.restart(offset); err != nil {
+		return
+	}
 
-	// wrap this code up to guarantee the connection disposal via a defer
+	// the data connection is closed by finishTransfer
 	separateCall := func() error {
-		if conn, _, err = ftp.transferCmd(cmd, remotename); err != nil {
+		if conn, _, err = ftp.transferLine(cmd, line, mode); err != nil {
 			return err
 		}
-		defer conn.Close() // close the connection on exit
-
-		bufReader := bufio.NewReaderSize(reader, blocksize)
 
 		ftp.writeInfo("Try and store bytes via connection for remote address:", conn.RemoteAddr().String())
 
-		s := make([]byte, blocksize)
-
-		var tot int64
+		tuner := ftp.newBlockTuner(blocksize)
+		if tuner != nil {
+			blocksize = tuner.size
+			defer tuner.done()
+		}
+		ftp.stats.setBlockSize(blocksize)
+		buf := getBuffer(blocksize)
+		defer func() { putBuffer(buf) }()
+		s := *buf
+		cw = NewCountingWriter(conn, remotename, filename, callback)
 
 		for {
-			var nr, nw int
+			var nr int
 			var eof bool
 
-			nr, err = bufReader.Read(s)
+			nr, err = io.ReadFull(reader, s)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
 
 			eof = err == io.EOF
 			if err != nil && !eof {
 				return err
 			}
 
-			if nw, err = conn.Write(s[:nr]); err != nil {
+			start := time.Now()
+			if _, err = cw.Write(s[:nr]); err != nil {
 				return err
 			}
 
-			if callback != nil {
-				tot += int64(nw)
-				callback(&CallbackInfo{remotename, filename, tot, eof})
-			}
-
 			if eof {
 				break
 			}
+			if tuner != nil {
+				buf, s = ftp.tuneBuffer(buf, tuner.wrote(nr, time.Since(start)))
+			}
 		}
+		cw.Done()
 		return nil
 	}
 
-	if err := separateCall(); err != nil {
-		return err
+	err = separateCall()
+	if err = ftp.finishTransfer(cmd, conn, false, err); err != nil && cw != nil {
+		cw.fail(err)
 	}
+	return err
+}
 
-	_, err = ftp.Read(cmd)
-	return
+// DefaultDrainTimeout bounds by default how long a transfer ended early waits for the data and the final reply.
+const DefaultDrainTimeout = 5 * time.Second
+
+// SetDrainTimeout sets how long a transfer ended early, by an error or Stop, keeps discarding
+// the remaining data and then waits for the final reply, DefaultDrainTimeout if <= 0.
+func (ftp *FTP) SetDrainTimeout(timeout time.Duration) {
+	ftp.drainTimeout = timeout
+}
+
+// SetFinalReplyTimeout bounds how long a transfer waits for its final reply once the data
+// connection is closed, 0 to wait as long as the reply timeouts allow, the default.
+// Some servers, old IIS versions notably, delay that reply. When it does not arrive in time,
+// a download is still successful if it received the size announced by the server; other
+// transfers fail with ErrNoFinalReply. Either way the late reply is awaited, for as long
+// again, before the next command is sent, so that it is not taken for the reply to the latter.
+func (ftp *FTP) SetFinalReplyTimeout(timeout time.Duration) {
+	ftp.finalWait = timeout
+}
+
+// ErrNoFinalReply is returned for a transfer whose final reply did not arrive in time, see SetFinalReplyTimeout.
+var ErrNoFinalReply = errors.New("no final reply to the transfer")
+
+// errDataClosed is a download cut by the server with a reset instead of a clean close of
+// the data connection, which some servers do after sending all the data: the final reply
+// decides of the outcome then.
+type errDataClosed struct{ err error }
+
+func (e *errDataClosed) Error() string { return e.err.Error() }
+func (e *errDataClosed) Unwrap() error { return e.err }
+
+// dataReadError marks the read errors of a download that a final reply may overrule.
+func dataReadError(err error) error {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &errDataClosed{err}
+	}
+	return err
+}
+
+// transferComplete reports whether the last transfer moved the size announced by the server.
+func (ftp *FTP) transferComplete() bool {
+	ts := ftp.LastTransfer()
+	return ts != nil && ts.TotalBytes >= 0 && ts.Bytes == ts.TotalBytes
+}
+
+// finishTransfer closes the data connection of a transfer and reads its final reply.
+// When the transfer ended early with err, the data still sent by the server is first
+// discarded, if drain is set, so that the final reply can be read and the control
+// connection stays in sync; both steps are bounded by the drain timeout and err is returned,
+// unless a positive final reply was already pending and the announced size was received.
+// A final reply not read by then is awaited before the next command instead.
+// An upload, a transfer not drained other than a listing, fails on an error closing the
+// data connection even if the server answered positively.
+// Nothing is done if the data connection was not opened, the reply has been read then.
+func (ftp *FTP) finishTransfer(cmd FtpCmd, conn net.Conn, drain bool, err error) error {
+	if conn == nil {
+		// the transfer was refused before the data connection opened
+		ftp.stats.transfer(err)
+		return err
+	}
+	var cut *errDataClosed
+	if errors.As(err, &cut) {
+		ftp.writeInfo("The server cut the data connection, waiting for the final reply:", cut.err)
+		err = nil
+	}
+	// some servers send the final reply before closing the data connection, which then
+	// times out; the reply is held until the data is drained and only then matched
+	var stalled net.Error
+	timedOut := errors.Is(err, ErrDeadlineExceeded) || errors.As(err, &stalled) && stalled.Timeout()
+	early := timedOut && ftp.replyPending()
+	timeout := ftp.drainTimeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	if err != nil {
+		deadline := time.Now().Add(timeout)
+		// a transfer over its maximum duration is abandoned without draining it
+		if drain && (ftp.dataDeadline.IsZero() || time.Now().Before(ftp.dataDeadline)) {
+			conn.SetReadDeadline(deadline)
+			n, _ := io.Copy(io.Discard, conn)
+			ftp.writeInfo("Discarded the remaining data of the transfer, bytes:", n)
+		}
+		ftp.conn.SetReadDeadline(deadline)
+		defer ftp.conn.SetReadDeadline(time.Time{})
+	} else if ftp.finalWait > 0 {
+		ftp.conn.SetReadDeadline(time.Now().Add(ftp.finalWait))
+		defer ftp.conn.SetReadDeadline(time.Time{})
+	}
+	closeErr := conn.Close()
+	ftp.timeouts.untimed = true
+	_, err1 := ftp.Read(cmd)
+	if netErr, ok := err1.(net.Error); ok && netErr.Timeout() && err != nil {
+		// the reply may still come, it must not be taken for the reply to the next command
+		ftp.lateReply = timeout
+	} else if ok && netErr.Timeout() && ftp.finalWait > 0 {
+		ftp.lateReply = ftp.finalWait
+		if drain && cut == nil && ftp.transferComplete() {
+			ftp.writeInfo("No final reply after", ftp.finalWait, "but the transfer is complete")
+			err1 = nil
+		} else {
+			err1 = fmt.Errorf("%w within %v", ErrNoFinalReply, ftp.finalWait)
+		}
+	}
+	if early && err1 == nil && ftp.transferComplete() {
+		ftp.writeInfo("The final reply came before the data connection drained, the transfer is complete:", err)
+		err = nil
+	}
+	fromReply := err == nil && err1 != nil
+	if err == nil {
+		// the server answers a stopped transfer with 426 or 226, only the cause matters
+		err = err1
+	}
+	if err == nil && cut != nil && ftp.LastTransfer().TotalBytes >= 0 && !ftp.transferComplete() {
+		// a positive reply does not make up for missing data
+		err = cut
+	}
+	if err == nil && closeErr != nil && !drain && !isListing(cmd) {
+		// nor for an upload whose last data failed to go out as the connection closed,
+		// e.g. the final flush of MODE Z
+		err = closeErr
+	}
+	if err != nil {
+		err = ftp.transferStopped(err, fromReply)
+	}
+	ftp.stats.transfer(err)
+	ftp.logTransfer(ftp.stats.end(err))
+	return err
 }
 
 // transferCmd initializes a tranfer over the data connection.
@@ -913,43 +1666,69 @@ func (ftp *FTP) StoreBytes(cmd FtpCmd, reader io.Reader, blocksize int, remotena
 // and start the tranfer command. Either way return the connection and the expected size of the transfer.
 // The expected size may be none if it could be not be determined.
 func (ftp *FTP) transferCmd(cmd FtpCmd, params ...string) (conn net.Conn, size int, err error) {
+	if !cmd.IsValid() {
+		return nil, -1, fmt.Errorf("%w: %s", ErrUnknownCmd, cmd)
+	}
+	return ftp.transferLine(cmd, cmd.AppendParameters(params...), DataConnSession)
+}
 
+// transferLine is transferCmd for an already formatted command line, so that any
+// command verb can drive a data connection. The cmd is only used to check the replies,
+// NONE_FTP_CMD accepts any positive reply. The data connection is opened as mode selects.
+func (ftp *FTP) transferLine(cmd FtpCmd, line string, mode DataConnMode) (conn net.Conn, size int, err error) {
 	var listener net.Listener
+	defer func() {
+		if err == nil {
+			return
+		}
+		// do not leak the data connection when the command fails
+		if conn != nil {
+			conn.Close()
+			conn = nil
+		}
+		ftp.logTransfer(&TransferStats{Command: line, TotalBytes: -1, Err: err})
+	}()
 
-	ftp.writeInfo("Server is passive:", ftp.passiveserver)
-	if ftp.passiveserver {
+	passive := ftp.passive(mode)
+	ftp.writeInfo("Server is passive:", passive)
+	if passive {
 		host, port, error := ftp.makePasv()
-		if ftp.conn.LocalAddr().Network() != host {
-			ftp.writeInfo("The remote server answered with a different host address, which is", host, ", using the orginal host instead:", ftp.Host)
-			host = ftp.Host
-		}
 		if error != nil {
 			return nil, -1, error
 		}
-
-		addr := fmt.Sprintf("%s:%d", host, port)
-		if ftp.timeoutInMsec > 0 {
-			if conn, err = net.DialTimeout("tcp", addr, ftp.timeoutInMsec); err != nil {
-				ftp.writeInfo("Dial error, address:", addr, "error:", err)
-				return
-			}
-		} else {
-			if conn, err = ftp.dialer.Dial("tcp", addr); err != nil {
-				ftp.writeInfo("Dial error, address:", addr, "error:", err, "proxy enabled:", ftp.dialer != proxy.Direct)
-				return
+		if remote, _, err1 := net.SplitHostPort(ftp.conn.RemoteAddr().String()); err1 != nil {
+			ftp.writeInfo("Unable to compare the PASV address to the server address:", err1)
+		} else if remote != host {
+			if err = ftp.quirk("PASV answered with the host address %s instead of %s", host, remote); err != nil {
+				return nil, -1, err
 			}
+			ftp.writeInfo("The remote server answered with a different host address, which is", host, ", using the orginal host instead:", ftp.Host)
+		}
+		if ftp.Host != "" {
+			host = ftp.Host
+		}
+
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		if conn, err = ftp.dial(context.Background(), addr); err != nil {
+			ftp.writeInfo("Dial error, address:", addr, "error:", err, "proxy enabled:", ftp.timeoutInMsec <= 0 && ftp.dialer != socks5.Direct)
+			return
 		}
 
 	} else {
 		if listener, err = ftp.makePort(); err != nil {
 			return
 		}
+		// closed whatever happens, the accepted connection outlives it
+		defer listener.Close()
 		ftp.writeInfo("Listener created for non-passive mode")
 
 	}
 
 	var resp *Response
-	if resp, err = ftp.SendAndRead(cmd, params...); err != nil {
+	if err = ftp.sendLine(line); err != nil {
+		return
+	}
+	if resp, err = ftp.Read(cmd); err != nil {
 		resp = nil
 		return
 	}
@@ -960,10 +1739,15 @@ func (ftp *FTP) transferCmd(cmd FtpCmd, params ...string) (conn net.Conn, size i
 	// be in violation of the protocol (which only allows
 	// 1xx or error messages for LIST), so we just discard
 	// this response.
-	if resp.getFirstChar() == "2" {
-		resp, err = ftp.Read(cmd)
+	if resp.IsPositiveCompletion() {
+		if err = ftp.quirk("%s answered with %d before the preliminary reply", line, resp.Code); err != nil {
+			return
+		}
+		if resp, err = ftp.Read(cmd); err != nil {
+			return
+		}
 	}
-	if resp.getFirstChar() != "1" {
+	if !resp.IsPositivePreliminary() {
 		err = NewErrReply(errors.New(resp.Message))
 		return
 	}
@@ -971,20 +1755,43 @@ func (ftp *FTP) transferCmd(cmd FtpCmd, params ...string) (conn net.Conn, size i
 	// not passive, open connection and close it then
 	if listener != nil {
 		ftp.writeInfo("Preparing to listen for non-passive mode.")
+		if tl, ok := listener.(*net.TCPListener); ok {
+			// a server which never connects must not block the session forever
+			if !ftp.dataDeadline.IsZero() {
+				tl.SetDeadline(ftp.dataDeadline)
+			} else if ftp.timeoutInMsec > 0 {
+				tl.SetDeadline(time.Now().Add(ftp.timeoutInMsec))
+			}
+		}
 		if conn, err = listener.Accept(); err != nil {
 			conn = nil
 			return
 		}
 		ftp.writeInfo("Trying to communicate with local host: ", conn.LocalAddr())
-		defer listener.Close() // close after getting the connection
 	}
 
-	if resp.Code == 150 {
-		// this is conditional in case we received a 125
-		ftp.writeInfo("Parsing return code 150")
-		size, err = parse150ForSize(resp)
+	// both the 150 reply and the 125 reply of a server reusing an open data connection
+	// may announce the size, as may any other preliminary reply of an odd server
+	size64, ok := parse150ForSize(resp)
+	if !ok {
+		ftp.writeInfo("No valid size announced by the preliminary reply:", resp.Message)
+	}
+	size = int(size64)
+	ftp.writeInfo("Transfer started with reply", resp.Code, "announced size:", size)
+	ts := ftp.stats.begin(line, size)
+	if size >= 0 && ftp.onSize != nil {
+		ftp.onSize(int64(size))
+	}
+	if !ftp.dataDeadline.IsZero() {
+		conn.SetDeadline(ftp.dataDeadline)
+	}
+	if ftp.sec.prot == ProtPrivate {
+		conn = tls.Client(conn, ftp.sec.config)
+	}
+	if ftp.modeZ {
+		conn = &zlibConn{Conn: conn, level: ftp.zLevel}
 	}
-	return conn, size, err
+	return &statsConn{Conn: conn, st: &ftp.stats, ts: ts, host: ftp.stats.host}, size, err
 }
 
 // makePort creates a new communication port and return a listener for this.
@@ -1002,30 +1809,21 @@ func (ftp *FTP) makePort() (listener net.Listener, err error) {
 
 	ftp.writeInfo("The new local address in makePort is:", newad)
 
-	listening := runServer(newad, network)
-	list := <-listening // wait for server to start and accept
-	if list == nil {
-		return nil, errors.New("Unable to create listener")
+	list, err := net.Listen(network, newad)
+	if err != nil {
+		return nil, err
 	}
 
-	la, _ = net.ResolveTCPAddr(list.Addr().Network(), list.Addr().String())
+	if la, err = net.ResolveTCPAddr(list.Addr().Network(), list.Addr().String()); err != nil {
+		list.Close()
+		return nil, err
+	}
 	ftp.writeInfo("Trying to listen locally at: ", la.IP.String(), " on new port:", la.Port)
 
-	_, err = ftp.SendPort(la.IP.String(), la.Port)
-
-	return list, err
+	if _, err = ftp.SendPort(la.IP.String(), la.Port); err != nil {
+		list.Close()
+		return nil, err
+	}
+	return list, nil
 }
 
-func runServer(laddr string, network string) chan net.Listener {
-	listening := make(chan net.Listener)
-	go func() {
-		l, err := net.Listen(network, laddr)
-		if err != nil {
-			log.Fatalf("net.Listen(%q, %q) = _, %v", network, laddr, err)
-			listening <- nil
-			return
-		}
-		listening <- l
-	}()
-	return listening
-}
@@ -2,27 +2,86 @@ package ftp4go
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"github.com/shenshouer/ftp4go/replyparse"
 	"io"
 	"net"
 	"net/textproto"
-	"os"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const (
-	BYTE_BLK = 1024
+	BYTE_BLK       = 1024
+	MAX_BLOCK_SIZE = 1 << 20 // upper bound of the adaptive upload block size
 )
 
+// bufferPools recycles the transfer buffers per size class, a power of two up to
+// MAX_BLOCK_SIZE, so that uploading millions of small files does not allocate a new
+// buffer for each of them, whatever block sizes are set.
+var bufferPools sync.Map // int -> *sync.Pool
+
+// bufferClass returns the capacity of the pooled buffers holding size bytes, or 0 when
+// size exceeds MAX_BLOCK_SIZE and is not pooled.
+func bufferClass(size int) int {
+	if size > MAX_BLOCK_SIZE {
+		return 0
+	}
+	c := 1
+	for c < size {
+		c <<= 1
+	}
+	return c
+}
+
+// getBuffer returns a buffer of size bytes, to be given back with putBuffer.
+func getBuffer(size int) *[]byte {
+	class := bufferClass(size)
+	if class == 0 {
+		b := make([]byte, size)
+		return &b
+	}
+	p, ok := bufferPools.Load(class)
+	if !ok {
+		p, _ = bufferPools.LoadOrStore(class, &sync.Pool{New: func() interface{} {
+			b := make([]byte, class)
+			return &b
+		}})
+	}
+	b := p.(*sync.Pool).Get().(*[]byte)
+	*b = (*b)[:size]
+	return b
+}
+
+func putBuffer(b *[]byte) {
+	if p, ok := bufferPools.Load(cap(*b)); ok {
+		p.(*sync.Pool).Put(b)
+	}
+}
+
+// adaptiveBlockSize returns the block size for transferring size bytes:
+// BLOCK_SIZE for small or unknown sizes, doubling with the size up to MAX_BLOCK_SIZE.
+func adaptiveBlockSize(size int64) int {
+	bs := BLOCK_SIZE
+	for bs < MAX_BLOCK_SIZE && int64(bs)*128 < size {
+		bs <<= 1
+	}
+	return bs
+}
+
 var (
 	NewErrReply = func(error error) error { return errors.New("Reply error: " + error.Error()) }
 	NewErrTemp  = func(error error) error { return errors.New("Temporary error: " + error.Error()) }
 	NewErrPerm  = func(error error) error { return errors.New("Permanent error: " + error.Error()) }
 	NewErrProto = func(error error) error { return errors.New("Protocol error: " + error.Error()) }
 	NewErrStop  = fmt.Errorf("Stop by human behavior: call FTP.Stop()")
+
+	// ErrUnknownCmd is returned when sending an FtpCmd which is neither built in nor registered.
+	ErrUnknownCmd = errors.New("Unknown FTP command")
 )
 
 // string writer
@@ -43,7 +102,7 @@ type textFileWriter struct {
 	bw *bufio.Writer
 }
 
-func newTextFileWriter(f *os.File) *textFileWriter {
+func newTextFileWriter(f io.Writer) *textFileWriter {
 	return &textFileWriter{bufio.NewWriter(f)}
 }
 
@@ -64,30 +123,182 @@ type CallbackInfo struct {
 	Filename         string
 	BytesTransmitted int64
 	Eof              bool
+	TotalBytes       int64 // size announced by the server in its 150 or 125 reply to a download, -1 if unknown
+
+	// Err is set in the final event of a transfer which stopped early, along with the Reason.
+	Err    error
+	Reason StopReason
 }
 
 type Callback func(info *CallbackInfo)
 
+// progress counts the transmitted bytes and reports them to a Callback.
+type progress struct {
+	resourcename string
+	filename     string
+	callback     Callback
+	n            int64
+	total        int64 // expected size, 0 or -1 if unknown
+}
+
+func (p *progress) add(n int) {
+	p.n += int64(n)
+	if p.callback != nil {
+		p.callback(p.info(false))
+	}
+}
+
+func (p *progress) info(eof bool) *CallbackInfo {
+	total := p.total
+	if total <= 0 {
+		total = -1
+	}
+	return &CallbackInfo{Resourcename: p.resourcename, Filename: p.filename, BytesTransmitted: p.n, Eof: eof, TotalBytes: total}
+}
+
+// expect sets the expected size of the transfer, reported as TotalBytes.
+func (p *progress) expect(size int64) {
+	p.total = size
+}
+
+// Count returns the number of bytes transmitted so far.
+func (p *progress) Count() int64 {
+	return p.n
+}
+
+// Done reports the end of the transfer to the callback, with Eof set.
+func (p *progress) Done() {
+	if p.callback != nil {
+		p.callback(p.info(true))
+	}
+}
+
+// fail reports the early end of the transfer to the callback, with Err and Reason set.
+func (p *progress) fail(err error) {
+	if p.callback != nil {
+		info := p.info(false)
+		info.Err, info.Reason = err, StopReasonOf(err)
+		p.callback(info)
+	}
+}
+
+// CountingReader wraps an io.Reader and reports the number of bytes read to a Callback
+// after each Read, the same way the upload methods do. Call Done at the end of the
+// stream to deliver the final CallbackInfo with Eof set.
+type CountingReader struct {
+	progress
+	r io.Reader
+}
+
+// NewCountingReader returns a CountingReader for r; resourcename and filename are
+// passed through to the CallbackInfo, callback may be nil to only count bytes.
+func NewCountingReader(r io.Reader, resourcename string, filename string, callback Callback) *CountingReader {
+	return &CountingReader{progress{resourcename: resourcename, filename: filename, callback: callback}, r}
+}
+
+func (cr *CountingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	if n > 0 {
+		cr.add(n)
+	}
+	return
+}
+
+// CountingWriter wraps an io.Writer and reports the number of bytes written to a Callback
+// after each Write. Call Done at the end of the stream to deliver the final CallbackInfo with Eof set.
+type CountingWriter struct {
+	progress
+	w io.Writer
+}
+
+// NewCountingWriter returns a CountingWriter for w; resourcename and filename are
+// passed through to the CallbackInfo, callback may be nil to only count bytes.
+func NewCountingWriter(w io.Writer, resourcename string, filename string, callback Callback) *CountingWriter {
+	return &CountingWriter{progress{resourcename: resourcename, filename: filename, callback: callback}, w}
+}
+
+func (cw *CountingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	if n > 0 {
+		cw.add(n)
+	}
+	return
+}
+
 type Response struct {
 	Code    int
 	Message string
 	Stream  []byte
+	Path    string // the directory the server reports in its reply to Cwd, empty if it names none
 }
 
-func (r *Response) getFirstChar() string {
-	if r == nil {
-		return ""
+// DefaultReplyHistory is the number of replies kept for LastReplies by default.
+const DefaultReplyHistory = 16
+
+// replyHistory is a ring buffer of the last replies read.
+type replyHistory struct {
+	size    int // 0 means DefaultReplyHistory
+	replies []*Response
+	next    int
+}
+
+func (h *replyHistory) add(r *Response) {
+	size := h.size
+	if size == 0 {
+		size = DefaultReplyHistory
+	}
+	if size < 0 {
+		return
 	}
-	return strconv.Itoa(r.Code)[0:1]
+	if len(h.replies) < size {
+		h.replies = append(h.replies, r)
+		return
+	}
+	h.replies[h.next] = r
+	h.next = (h.next + 1) % size
+}
+
+func (h *replyHistory) last() []*Response {
+	l := make([]*Response, 0, len(h.replies))
+	l = append(l, h.replies[h.next:]...)
+	return append(l, h.replies[:h.next]...)
+}
+
+// SetReplyHistory sets how many raw replies are kept for LastReplies, a negative value keeps none.
+// The replies kept so far are dropped.
+func (ftp *FTP) SetReplyHistory(n int) {
+	ftp.replies = replyHistory{size: n}
 }
 
-var re227, re150 *regexp.Regexp
+// LastReplies returns the last replies read from the server, oldest first, including
+// the negative ones and those discarded as protocol deviations, for troubleshooting.
+func (ftp *FTP) LastReplies() []*Response {
+	return ftp.replies.last()
+}
 
-func init() {
-	re227, _ = regexp.Compile("([0-9]+),([0-9]+),([0-9]+),([0-9]+),([0-9]+),([0-9]+)")
-	re150, _ = regexp.Compile("150 .* \\(([0-9]+) bytes\\)")
+// replyClass returns the first digit of the reply code, 0 for a nil response.
+func (r *Response) replyClass() int {
+	if r == nil {
+		return 0
+	}
+	return r.Code / 100
 }
 
+// IsPositivePreliminary reports a 1yz reply, the action is being started.
+func (r *Response) IsPositivePreliminary() bool { return r.replyClass() == 1 }
+
+// IsPositiveCompletion reports a 2yz reply, the action has been completed.
+func (r *Response) IsPositiveCompletion() bool { return r.replyClass() == 2 }
+
+// IsPositiveIntermediate reports a 3yz reply, the command needs another one to complete.
+func (r *Response) IsPositiveIntermediate() bool { return r.replyClass() == 3 }
+
+// IsTransientNegative reports a 4yz reply, the command may succeed if sent again.
+func (r *Response) IsTransientNegative() bool { return r.replyClass() == 4 }
+
+// IsPermanentNegative reports a 5yz reply, the command failed.
+func (r *Response) IsPermanentNegative() bool { return r.replyClass() == 5 }
+
 // Dial connects to the given address on the given network using net.Dial
 // and then returns a new Conn for the connection.
 func Dial(network, addr string) (net.Conn, error) {
@@ -99,29 +310,50 @@ func Dial(network, addr string) (net.Conn, error) {
 }
 
 func (ftp *FTP) NewConn(addr string) error {
+	return ftp.newConn(context.Background(), addr)
+}
 
-	var (
-		c   net.Conn
-		err error
-	)
-	if ftp.timeoutInMsec > 0 {
-		c, err = net.DialTimeout("tcp", addr, ftp.timeoutInMsec)
+func (ftp *FTP) newConn(ctx context.Context, addr string) error {
+	c, err := ftp.dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	ftp.useConn(c)
+	return nil
+}
 
-		if err != nil {
-			return err
-		}
-	} else {
-		c, err = ftp.dialer.Dial("tcp", addr)
+// setConn replaces the control connection, see interrupt.
+func (ftp *FTP) setConn(c net.Conn) {
+	ftp.connMutex.Lock()
+	ftp.conn = c
+	ftp.connMutex.Unlock()
+}
 
-		if err != nil {
-			return err
-		}
+// interrupt closes the current control connection from another goroutine, which fails
+// the pending command of the session.
+func (ftp *FTP) interrupt() {
+	ftp.connMutex.Lock()
+	defer ftp.connMutex.Unlock()
+	if ftp.conn != nil {
+		ftp.conn.Close()
 	}
+}
 
+// useConn makes c the control connection of a new session.
+func (ftp *FTP) useConn(c net.Conn) {
 	// use textproto for parsing
-	ftp.conn = c
+	ftp.setConn(c)
+	ftp.resetSession()
 	ftp.textprotoConn = textproto.NewConn(c)
-	return nil
+}
+
+// resetSession forgets the state of the previous session on the control connection.
+func (ftp *FTP) resetSession() {
+	ftp.sec = security{fallback: ftp.sec.fallback}
+	ftp.idle = 0
+	ftp.noSiteCopy = false
+	ftp.lateReply = 0
+	ftp.dirStack = nil
 }
 
 // SendAndRead sends a command to the server and reads the response.
@@ -134,17 +366,33 @@ func (ftp *FTP) SendAndRead(cmd FtpCmd, params ...string) (response *Response, e
 
 // Send sends a command to the server.
 func (ftp *FTP) Send(cmd FtpCmd, params ...string) (err error) {
+	if !cmd.IsValid() {
+		return fmt.Errorf("%w: %s", ErrUnknownCmd, cmd)
+	}
 	fullCmd := cmd.String()
 	//ftp.writeInfo(fmt.Sprintf("Sending to server partial command '%s'", fullCmd))
 	if len(params) > 0 {
 		fullCmd = cmd.AppendParameters(params...)
 	}
+	return ftp.sendLine(fullCmd)
+}
 
-	ftp.writeInfo(fmt.Sprintf("Sending to server command '%s'", fullCmd))
+// sendLine sends an already formatted command line to the server.
+func (ftp *FTP) sendLine(line string) (err error) {
+	if err = ftp.readUnsolicited(); err != nil {
+		return err
+	}
+	ftp.writeInfo(fmt.Sprintf("Sending to server command '%s'", line))
+	if line, err = ftp.encodeLine(line); err != nil {
+		return err
+	}
+	ftp.pacer.wait()
+	ftp.stats.update(func(s *Stats) { s.Commands++ })
+	if ftp.timeouts.max > 0 {
+		ftp.timeouts.sent = time.Now()
+	}
 	//_, err = ftp.textprotoConn.Cmd(fullCmd)
-	err = ftp.textprotoConn.PrintfLine(fullCmd)
-
-	return
+	return ftp.textprotoConn.PrintfLine("%s", line)
 }
 
 // Read reads the response along with the response code from the server
@@ -153,93 +401,93 @@ func (ftp *FTP) Read(cmd FtpCmd) (resp *Response, err error) {
 	var msg string
 	var code int
 
-	if code, msg, err = ftp.textprotoConn.ReadResponse(-1); err != nil {
+	ftp.beginRead()
+	code, msg, err = ftp.textprotoConn.ReadResponse(-1)
+	ftp.endRead(err)
+	if err != nil {
 		return nil, err
 	}
+	msg = string(ftp.decode([]byte(msg)))
+	ftp.lastCode = code
+	ftp.lastMsg = msg
+	ftp.replies.add(&Response{Code: code, Message: msg})
 
 	ftp.writeInfo(fmt.Sprintf("The message returned by the server was: code=%d, message=%s", code, msg))
 
-	c := strconv.Itoa(code)[0:1]
+	resp = &Response{Code: code, Message: msg}
+	ftp.stats.reply(resp)
 
-	switch {
-	//valid
-	case strings.IndexAny(c, "123") >= 0:
-		return &Response{Code: code, Message: msg}, nil
-	//wrong
-	case c == "4":
-		err = errors.New("Temporary error: " + msg)
-	case c == "5":
-		err = errors.New("Permanent error: " + msg)
-	default:
-		err = errors.New("Protocol error: " + msg)
+	if err = ReplyError(code, msg); err == nil {
+		if !cmd.accepts(code) {
+			ftp.writeInfo("Unexpected reply code for command", cmd, ":", code)
+			return nil, NewErrReply(errors.New(msg))
+		}
+		return resp, nil
 	}
 
 	ftp.writeInfo("Response error")
 	return nil, err
 }
 
+// parse227 is parse227 reporting an address not in the RFC 959 form, e.g. without
+// parentheses or with spaces, as a quirk.
+func (ftp *FTP) parse227(resp *Response) (host string, port int, err error) {
+	if resp.Code == 227 {
+		if _, _, err := replyparse.PasvStrict(resp.Message); err != nil {
+			if err := ftp.quirk("227 reply without a parenthesized address: %s", resp.Message); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+	return parse227(resp)
+}
+
 // parse227 parses the 227 response for PASV request.
-// Raises a protocol error if it does not contain {h1,h2,h3,h4,p1,p2}.
+// Raises a protocol error if it does not contain {h1,h2,h3,h4,p1,p2}, see replyparse.Pasv
+// for the forms accepted.
 // Returns the host and port.
 func parse227(resp *Response) (host string, port int, err error) {
 	if resp.Code != 227 {
 		err = NewErrProto(errors.New(resp.Message))
 		return
 	}
-
-	matches := re227.FindStringSubmatch(resp.Message)
-	if matches == nil {
-		err = NewErrProto(errors.New("No matching pattern for message:" + resp.Message))
-		return
+	if host, port, err = replyparse.Pasv(resp.Message); err != nil {
+		err = NewErrProto(err)
 	}
-	numbers := matches[1:] // get the groups
-	host = strings.Join(numbers[:4], ".")
-	p1, _ := strconv.Atoi(numbers[4])
-	p2, _ := strconv.Atoi(numbers[5])
-	port = (p1 << 8) + p2
 	return
 }
 
-// parse150ForSize parses the '150' response for a RETR request.
-// Returns the expected transfer size or None; size is not guaranteed to
-// be present in the 150 message.
-func parse150ForSize(resp *Response) (int, error) {
-	if resp.Code != 150 {
-		return -1, NewErrReply(errors.New(resp.Message))
+// parse150ForSize parses the preliminary '150' or '125' response for a RETR request.
+// Returns the expected transfer size, or -1 and false if the message holds none or a
+// malformed one; size is not guaranteed to be present in the message.
+func parse150ForSize(resp *Response) (int64, bool) {
+	if !resp.IsPositivePreliminary() {
+		return -1, false
 	}
+	return replyparse.TransferSize(resp.Message)
+}
 
-	matches := re150.FindStringSubmatch(resp.Message)
-	if len(matches) < 2 {
-		return -1, nil
+// parse257 is parse257 reporting a reply without a quoted directory name as a quirk.
+func (ftp *FTP) parse257(resp *Response) (dirname string, err error) {
+	if resp.Code == 257 && !strings.HasPrefix(strings.TrimLeft(resp.Message, " "), "\"") {
+		return "", ftp.quirk("257 reply without a quoted directory name: %s", resp.Message)
 	}
-
-	return strconv.Atoi(string(matches[1]))
-
+	return parse257(resp)
 }
 
 // parse257 parses the 257 response for a MKD or PWD request, the response is a directory name.
-// Return the directory name in the 257 reply.
+// A reply without a quoted name yields an empty name, see replyparse.Dirname.
 func parse257(resp *Response) (dirname string, err error) {
 	if resp.Code != 257 {
 		err = NewErrProto(errors.New(resp.Message))
 		return "", err
 	}
-	if resp.Message[0:1] != "\"" {
+	dirname, err = replyparse.Dirname(resp.Message)
+	switch {
+	case errors.Is(err, replyparse.ErrUnquoted):
 		return "", nil // Not compliant to RFC 959, but UNIX ftpd does this
-	}
-	dirname = ""
-	i := 1
-	n := len(resp.Message)
-	for i < n {
-		c := resp.Message[i]
-		i++
-		if c == '"' {
-			if i >= n || resp.Message[i] != '"' {
-				break
-			}
-			i++
-		}
-		dirname = dirname + string(c)
+	case err != nil:
+		return "", NewErrProto(err)
 	}
 	return dirname, nil
 }
@@ -251,31 +499,7 @@ func parse211(resp *Response) (list []string, err error) {
 		err = NewErrProto(errors.New(resp.Message))
 		return nil, err
 	}
-
-	list = make([]string, 0, 20)
-	var no int
-
-	r := bufio.NewReader(strings.NewReader(resp.Message))
-
-	for {
-		line, _, err1 := r.ReadLine()
-
-		if err1 != nil {
-			if err1 == io.EOF {
-				break
-			}
-			return list, err1
-		}
-
-		l := strings.TrimSpace(string(line))
-
-		if !strings.HasPrefix(l, strconv.Itoa(resp.Code)) && len(l) > 0 {
-			list = append(list, l)
-			no++
-		}
-	}
-	return list[:no], nil
-
+	return replyparse.Features(resp.Message), nil
 }
 
 // TrimString returns s without leading and trailing ASCII space.
@@ -316,9 +540,158 @@ type Error struct {
 }
 
 func (e *Error) Error() string {
+	switch e.Code / 100 {
+	case 4:
+		return "Temporary error: " + e.Msg
+	case 5:
+		return "Permanent error: " + e.Msg
+	}
 	return fmt.Sprintf("%03d %s", e.Code, e.Msg)
 }
 
+// replyCode returns the code of the negative reply reported by err, 0 if err does not come
+// from a reply.
+func replyCode(err error) int {
+	var (
+		replyErr    *Error
+		storageErr  *ErrStorage
+		fileNameErr *ErrFileName
+	)
+	switch {
+	case errors.As(err, &replyErr):
+		return replyErr.Code
+	case errors.As(err, &storageErr):
+		return storageErr.Code
+	case errors.As(err, &fileNameErr):
+		return StatusBadFileName
+	}
+	return 0
+}
+
+// An ErrPartialTransfer is returned when a download stops before completion,
+// because it failed or was stopped via FTP.Stop.
+type ErrPartialTransfer struct {
+	Remotename   string
+	Localpath    string
+	BytesWritten int64 // bytes written to the local file by the failed attempt
+	Offset       int64 // size of the kept local file, where a resume would start
+	Kept         bool  // the partial local file was kept and can be resumed with DownloadFileWithOptions and Offset
+	Err          error // the cause, NewErrStop if the download was stopped
+}
+
+func (e *ErrPartialTransfer) Error() string {
+	state := "removed"
+	if e.Kept {
+		state = "kept"
+	}
+	return fmt.Sprintf("Partial transfer of %s: %d bytes written, local file %s %s: %v", e.Remotename, e.BytesWritten, e.Localpath, state, e.Err)
+}
+
+func (e *ErrPartialTransfer) Unwrap() error {
+	return e.Err
+}
+
+// An ErrStorage is returned for the replies 452, insufficient storage space, and 552,
+// exceeded storage allocation, typically a full disk or quota on the server, so that
+// uploads can report it apart from other failures.
+type ErrStorage struct {
+	Code int // 452 or 552
+	Msg  string
+}
+
+func (e *ErrStorage) Error() string {
+	if e.Temporary() {
+		return "Temporary error: " + e.Msg
+	}
+	return "Permanent error: " + e.Msg
+}
+
+// Temporary reports whether the server considers the condition transient, for a 452.
+func (e *ErrStorage) Temporary() bool {
+	return e.Code == Status452
+}
+
+// An ErrFileName is returned for the reply 553, the file name is not allowed by the server.
+type ErrFileName struct {
+	Msg string
+}
+
+func (e *ErrFileName) Error() string {
+	return "Permanent error: " + e.Msg
+}
+
+// ConnectFailure classifies the reason of a failed Connect.
+type ConnectFailure int
+
+const (
+	ConnectResolve  ConnectFailure = iota + 1 // the host name could not be resolved
+	ConnectRefused                            // nothing listens on the port
+	ConnectProxy                              // the proxy failed or refused the connection
+	ConnectTimeout                            // the connection or the greeting timed out
+	ConnectBanner                             // the server sent an invalid or negative greeting
+	ConnectNetwork                            // any other network failure
+	ConnectCanceled                           // the context of ConnectContext was canceled
+)
+
+func (f ConnectFailure) String() string {
+	switch f {
+	case ConnectResolve:
+		return "resolution failure"
+	case ConnectRefused:
+		return "connection refused"
+	case ConnectProxy:
+		return "proxy failure"
+	case ConnectTimeout:
+		return "timeout"
+	case ConnectBanner:
+		return "invalid greeting"
+	case ConnectCanceled:
+		return "canceled"
+	}
+	return "network failure"
+}
+
+// An ErrConnect is returned by Connect, its Kind tells orchestration code whether
+// retrying, alerting or failing over makes sense without parsing error strings.
+type ErrConnect struct {
+	Kind ConnectFailure
+	Addr string // the address of the server
+	Err  error  // the underlying error
+}
+
+func (e *ErrConnect) Error() string {
+	return fmt.Sprintf("Connecting to %s failed, %s: %v", e.Addr, e.Kind, e.Err)
+}
+
+func (e *ErrConnect) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether retrying later may succeed.
+func (e *ErrConnect) Temporary() bool {
+	return e.Kind == ConnectRefused || e.Kind == ConnectTimeout || e.Kind == ConnectNetwork
+}
+
+// classifyDialError wraps the error of dialing addr, possibly via a proxy, into an ErrConnect.
+func classifyDialError(addr string, viaProxy bool, err error) *ErrConnect {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	kind := ConnectNetwork
+	switch {
+	case errors.Is(err, context.Canceled):
+		kind = ConnectCanceled
+	case errors.As(err, &netErr) && netErr.Timeout():
+		kind = ConnectTimeout
+	case viaProxy:
+		kind = ConnectProxy
+	case errors.As(err, &dnsErr):
+		kind = ConnectResolve
+	case errors.Is(err, syscall.ECONNREFUSED):
+		kind = ConnectRefused
+	}
+	return &ErrConnect{Kind: kind, Addr: addr, Err: err}
+}
+
 // A ProtocolError describes a protocol violation such
 // as an invalid response or a hung-up connection.
 type ProtocolError string
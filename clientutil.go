@@ -2,12 +2,16 @@
 package ftp4go
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 var DIRECTORY_NON_EXISTENT = errors.New("The folder does not exist and can not be removed")
@@ -16,13 +20,12 @@ var DIRECTORY_NON_EXISTENT = errors.New("The folder does not exist and can not b
 // The current directory is then set to the orginal one before the operation or to the root of the deleted folder if it fails.
 func (ftp *FTP) RemoveRemoteDirTree(remoteDir string) (err error) {
 
-	var pwd string
-	if pwd, err = ftp.Pwd(); err != nil {
+	if err = ftp.PushD(""); err != nil {
 		return
 	}
 
-	// go back to original wd in a separate routine, if this fails stay where we are, onle level before the folder
-	defer ftp.Cwd(pwd)
+	// go back to original wd, if this fails stay where we are, one level before the folder
+	defer ftp.PopD()
 
 	return ftp.removeRemoteDirTree(remoteDir)
 }
@@ -52,14 +55,18 @@ func (ftp *FTP) removeRemoteDirTree(remoteDir string) (err error) {
 			continue
 		case perm[0] != 'd':
 			// file, delete
-			ftp.Delete(fname)
+			if _, err = ftp.Delete(fname); err != nil {
+				return err
+			}
 		case perm[0] == 'd': // directory
 			if err = ftp.RemoveRemoteDirTree(fname); err != nil {
 				return err
 			}
 		}
 	}
-	ftp.Cwd("..")
+	if _, err = ftp.Cwd(".."); err != nil {
+		return err
+	}
 	if _, err = ftp.Rmd(remoteDir); err != nil {
 		return err
 	}
@@ -67,6 +74,173 @@ func (ftp *FTP) removeRemoteDirTree(remoteDir string) (err error) {
 
 }
 
+// MkdirAll creates a remote folder along with its missing parents, like os.MkdirAll.
+// Folders which exist already are not an error. The working directory is not changed.
+func (ftp *FTP) MkdirAll(remoteDir string) error {
+	remoteDir = path.Clean(remoteDir)
+	if remoteDir == "/" || remoteDir == "." {
+		return nil
+	}
+	_, err := ftp.Mkd(remoteDir)
+	if err == nil || ftp.mkdExisted(remoteDir, err) {
+		return nil
+	}
+	// the parent is missing, or the folder can not be created at all
+	if err1 := ftp.MkdirAll(path.Dir(remoteDir)); err1 != nil {
+		return err1
+	}
+	if _, err = ftp.Mkd(remoteDir); err != nil && !ftp.mkdExisted(remoteDir, err) {
+		return err
+	}
+	return nil
+}
+
+// mkTempAttempts bounds the names MkTempRemote tries.
+const mkTempAttempts = 100
+
+// MkTempRemote creates a new remote folder in parent, named prefix followed by a random string,
+// and returns its path, like os.MkdirTemp. A name taken already, by another client for
+// instance, is retried with another one. The folder serves to stage a multi-file delivery
+// renamed into place as a unit once complete; removing it is up to the caller.
+func (ftp *FTP) MkTempRemote(parent string, prefix string) (string, error) {
+	var err error
+	for i := 0; i < mkTempAttempts; i++ {
+		b := make([]byte, 6)
+		if _, err = rand.Read(b); err != nil {
+			return "", err
+		}
+		dir := path.Join(parent, prefix+hex.EncodeToString(b))
+		if _, err = ftp.Mkd(dir); err == nil {
+			return dir, nil
+		}
+		if replyCode(err) != StatusFileUnavailable {
+			return "", err
+		}
+		// a 550 reply may also be a missing parent or a denied permission
+		if exists, err1 := ftp.Exists(dir); err1 != nil || !exists {
+			return "", err
+		}
+		ftp.writeInfo("Remote temporary folder exists already:", dir)
+	}
+	return "", fmt.Errorf("No unused temporary folder name found in %s: %w", parent, err)
+}
+
+// isDir reports whether a remote folder exists, by listing its parent.
+func (ftp *FTP) isDir(remoteDir string) bool {
+	fi, err := NewFS(ftp).Stat(remoteDir)
+	return err == nil && fi.IsDir()
+}
+
+// RemoveOptions configures RemoveRemoteTree, the zero value removes as fast as possible without feedback.
+type RemoveOptions struct {
+	Pace     time.Duration                                   // pause before each DELE or RMD, to spare the server
+	Progress func(remotepath string, summary *RemoveSummary) // called after each removal attempt, synchronously
+	// VerifyListing cross-checks the LIST of every folder with its NLST before deleting its
+	// contents, and stops the removal with *ErrListingMismatch if they disagree: a safety
+	// net against a listing format the client misparses. It costs a command per folder.
+	VerifyListing bool
+}
+
+// RemoveSummary counts the outcome of RemoveRemoteTree.
+type RemoveSummary struct {
+	Files   int   // files and links deleted
+	Dirs    int   // folders removed
+	Skipped int   // folders left in place because some of their contents could not be removed
+	Failed  int   // entries which could not be deleted
+	Err     error // the first failure, if any
+
+	Failures []*ErrFileFailed // every entry which could not be deleted
+}
+
+// RemoveRemoteTree removes a remote folder and its contents like RemoveRemoteDirTree, for large trees:
+// it goes on past the entries it fails to delete, paces its commands and reports its progress.
+// remoteDir should be an absolute path, the working directory is never changed.
+// The returned error is set if the walk had to be interrupted, because a folder could not be
+// listed or Stop was called; the single failures are counted in the summary.
+func (ftp *FTP) RemoveRemoteTree(remoteDir string, opts *RemoveOptions) (summary *RemoveSummary, err error) {
+	defer ftp.beginJob()()
+	if opts == nil {
+		opts = &RemoveOptions{}
+	}
+	summary = &RemoveSummary{}
+	_, err = ftp.removeRemoteTree(remoteDir, opts, summary)
+	return summary, err
+}
+
+// removeRemoteTree removes a folder depth first, it returns false if the folder is left in place.
+func (ftp *FTP) removeRemoteTree(dir string, opts *RemoveOptions, summary *RemoveSummary) (removed bool, err error) {
+	var entries []*Entry
+	if entries, err = ftp.List(dir); err != nil {
+		return false, err
+	}
+	if opts.VerifyListing {
+		if err = ftp.verifyListing(dir, entries); err != nil {
+			return false, err
+		}
+	}
+
+	complete := true
+	for _, e := range entries {
+		p := path.Join(dir, e.Name)
+		if e.Type == EntryTypeFolder {
+			var ok bool
+			if ok, err = ftp.removeRemoteTree(p, opts, summary); err != nil {
+				return false, err
+			}
+			complete = complete && ok
+			continue
+		}
+
+		if ftp.stopped() {
+			return false, NewErrStop
+		}
+		time.Sleep(opts.Pace)
+		if err1 := ftp.treeAttempt(p, func() error { _, err := ftp.Delete(p); return err }); errors.Is(err1, ErrStoppedAfterCurrent) {
+			return false, err1
+		} else if err1 != nil {
+			summary.fail(err1)
+			complete = false
+		} else {
+			summary.Files++
+		}
+		opts.progress(p, summary)
+	}
+
+	if !complete {
+		ftp.writeInfo("Leaving the folder in place:", dir)
+		summary.Skipped++
+		return false, nil
+	}
+	time.Sleep(opts.Pace)
+	if err1 := ftp.treeAttempt(dir, func() error { _, err := ftp.Rmd(dir); return err }); errors.Is(err1, ErrStoppedAfterCurrent) {
+		return false, err1
+	} else if err1 != nil {
+		summary.fail(err1)
+	} else {
+		summary.Dirs++
+		removed = true
+	}
+	opts.progress(dir, summary)
+	return removed, nil
+}
+
+func (s *RemoveSummary) fail(err error) {
+	var fe *ErrFileFailed
+	if errors.As(err, &fe) {
+		s.Failures = append(s.Failures, fe)
+	}
+	s.Failed++
+	if s.Err == nil {
+		s.Err = err
+	}
+}
+
+func (o *RemoveOptions) progress(remotepath string, summary *RemoveSummary) {
+	if o.Progress != nil {
+		o.Progress(remotepath, summary)
+	}
+}
+
 // UploadDirTree uploads a local directory and all of its subfolders
 // localDir 		-> path to the local folder to upload along with all of its subfolders.
 // remoteRootDir 	-> the root folder on the FTP server where to store the localDir tree.
@@ -74,47 +248,70 @@ func (ftp *FTP) removeRemoteDirTree(remoteDir string) (err error) {
 // callback			-> a callback function, which is called synchronously. Do remember to collect data in a go routine for instance if you do not want the upload to block.
 // Returns the number of files uploaded and an error if any.
 //
+// Every local folder is created remotely, empty ones included.
+// The files are uploaded in binary mode unless another one is set with SetTreeTransferMode.
+// With a skip policy set by SetTreeSkipPolicy the remote folders may exist already, and the
+// files skipped by it or by excludedDirs are reported to the SetSkipCallback function.
+// A receipt of the delivered files is produced if configured with SetUploadReceipt.
 // The current workding directory is set back to the initial value at the end.
 func (ftp *FTP) UploadDirTree(localDir string, remoteRootDir string, maxSimultaneousConns int, excludedDirs []string, callback Callback) (n int, err error) {
+	defer ftp.beginJob()()
 
 	if len(remoteRootDir) == 0 {
 		return n, errors.New("A valid remote root folder with write permission needs specifying.")
 	}
 
-	var pwd string
-	if pwd, err = ftp.Pwd(); err != nil {
-		return
-	}
-
-	if _, err = ftp.Cwd(remoteRootDir); err != nil {
-		return n, nil
+	if err = ftp.PushD(remoteRootDir); err != nil {
+		return n, err
 	}
 	//go back to original wd
-	defer ftp.Cwd(pwd)
+	defer ftp.PopD()
 
 	//all lower case
 	var exDirs sort.StringSlice
 	if len(excludedDirs) > 0 {
-		exDirs = sort.StringSlice(excludedDirs)
-		for _, v := range exDirs {
-			v = strings.ToLower(v)
+		exDirs = make(sort.StringSlice, len(excludedDirs))
+		for i, v := range excludedDirs {
+			exDirs[i] = strings.ToLower(v)
 		}
 		exDirs.Sort()
 	}
 
+	ftp.receipt = nil
+	if ftp.receiptOpts != nil {
+		ftp.receipt = &Receipt{LocalRoot: localDir, RemoteRoot: remoteRootDir, Started: time.Now().UTC(), Files: []*ReceiptFile{}}
+	}
+	ftp.dups = nil
+	if ftp.dedup != DedupNone {
+		ftp.dups = &dupIndex{bySize: make(map[int64][]*dupFile), checksum: ftp.fileChecksum}
+		defer func() { ftp.dups = nil }()
+	}
+	if ftp.heartbeatOpts != nil {
+		var pwd string
+		if pwd, err = ftp.Pwd(); err != nil {
+			return n, err
+		}
+		defer ftp.startHeartbeat("upload", pwd)()
+	}
 	err = ftp.uploadDirTree(localDir, exDirs, callback, &n)
 	if err != nil {
 		ftp.writeInfo(fmt.Sprintf("An error while uploading the folder %s occurred.", localDir))
 	}
 
-	return n, err
+	return n, ftp.finishReceipt(err)
+}
+
+// SetTreeTransferMode sets the mode UploadDirTree uploads the files with, Binary by default.
+// AutoType picks it per file by sniffing its contents, Auto by its extension.
+func (ftp *FTP) SetTreeTransferMode(mode TransferMode) {
+	ftp.treeMode = mode
 }
 
 func (ftp *FTP) uploadDirTree(localDir string, excludedDirs sort.StringSlice, callback Callback, n *int) (err error) {
 
 	_, dir := filepath.Split(localDir)
 	ftp.writeInfo("The directory where to upload is:", dir)
-	if _, err = ftp.Mkd(dir); err != nil {
+	if _, err = ftp.Mkd(dir); err != nil && ftp.skipPolicy == 0 {
 		return
 	}
 
@@ -123,7 +320,34 @@ func (ftp *FTP) uploadDirTree(localDir string, excludedDirs sort.StringSlice, ca
 		ftp.writeInfo(fmt.Sprintf("An error occurred while CWD, err: %s.", err))
 		return
 	}
-	defer ftp.Cwd("..")
+	defer func() {
+		// carrying on in the wrong folder would upload the next files there
+		if _, err1 := ftp.Cwd(".."); err == nil {
+			err = err1
+		}
+	}()
+
+	// the remote files the skip policy compares to
+	remote := make(map[string]os.FileInfo)
+	var fold bool
+	if ftp.skipPolicy&compareSkips != 0 {
+		if fold, err = ftp.foldsCase(); err != nil {
+			return
+		}
+		var entries []*Entry
+		if entries, err = ftp.List(); err != nil {
+			return
+		}
+		for _, e := range entries {
+			remote[nameKey(e.Name, fold)] = &fileInfo{e}
+		}
+	}
+	var pwd string
+	if ftp.onSkip != nil || ftp.receipt != nil || ftp.dups != nil {
+		if pwd, err = ftp.Pwd(); err != nil {
+			return
+		}
+	}
 	globSearch := filepath.Join(localDir, "*")
 	ftp.writeInfo("Looking up files in", globSearch)
 	var files []string
@@ -140,11 +364,43 @@ func (ftp *FTP) uploadDirTree(localDir string, excludedDirs sort.StringSlice, ca
 		ftp.writeInfo("Uploading file or dir:", localPath)
 		var f os.FileInfo
 		if f, err = os.Stat(localPath); err != nil {
+			if ftp.skipUnreadable(localPath, path.Join(pwd, fname), err) {
+				err = nil
+				continue
+			}
 			return
 		}
 		if !f.IsDir() {
-			err = ftp.UploadFile(fname, localPath, false, callback) // always binary upload
+			if reason, skip := ftp.skipReason(f.Size(), f.ModTime(), remote[nameKey(fname, fold)]); skip {
+				ftp.skipped("upload", localPath, path.Join(pwd, fname), reason, nil)
+				continue
+			}
+			if ftp.dups != nil {
+				var orig string
+				if orig, err = ftp.dups.find(localPath, path.Join(pwd, fname), f.Size()); err != nil {
+					return
+				}
+				if orig != "" {
+					var done bool
+					if done, err = ftp.uploadDuplicate(orig, path.Join(pwd, fname), localPath, n); err != nil {
+						return
+					}
+					if done {
+						continue
+					}
+				}
+			}
+			err = ftp.treeAttempt(localPath, func() error {
+				return ftp.UploadFileWithOptions(fname, localPath, &TransferOptions{Mode: ftp.treeMode, Callback: callback})
+			})
 			if err != nil {
+				if ftp.skipUnreadable(localPath, path.Join(pwd, fname), err) {
+					err = nil
+					continue
+				}
+				return
+			}
+			if err = ftp.addToReceipt(path.Join(pwd, fname), localPath, ""); err != nil {
 				return
 			}
 			*n += 1 // increment
@@ -154,7 +410,7 @@ func (ftp *FTP) uploadDirTree(localDir string, excludedDirs sort.StringSlice, ca
 				lfname := strings.ToLower(fname)
 				idx := sort.SearchStrings(excludedDirs, lfname)
 				if idx < len(excludedDirs) && excludedDirs[idx] == lfname {
-					ftp.writeInfo("Excluding folder:", s)
+					ftp.skipped("upload", localPath, path.Join(pwd, fname), SkipExcluded, nil)
 					continue
 				}
 			}
@@ -167,3 +423,226 @@ func (ftp *FTP) uploadDirTree(localDir string, excludedDirs sort.StringSlice, ca
 
 	return
 }
+
+// FlattenMode selects whether DownloadDirTree recreates the remote folders locally,
+// and how the files of different folders sharing a name are told apart when it does not.
+type FlattenMode int
+
+const (
+	FlattenNone      FlattenMode = iota // recreate the folder structure, the default
+	FlattenPrefix                       // rename colliding files with their folder path as prefix, e.g. 2024_05_01_data.csv
+	FlattenError                        // fail with ErrFlattenCollision on the first collision
+	FlattenOverwrite                    // the last file downloaded wins
+)
+
+// ErrFlattenCollision is returned when two remote files flatten to the same local name with FlattenError.
+var ErrFlattenCollision = errors.New("Files from different folders share a name")
+
+// SetTreeFlatten sets whether DownloadDirTree downloads every file directly into the local
+// folder, FlattenNone by default. Only the files of the same run collide with each other,
+// the first one keeps its name.
+func (ftp *FTP) SetTreeFlatten(mode FlattenMode) {
+	ftp.flatten = mode
+}
+
+// flattenName returns the local name of the file at rel, relative to the downloaded root,
+// recording it in used, which maps the local names to the relative paths.
+// On a collision the file of a subfolder is renamed, a file at the root keeps its name.
+func (ftp *FTP) flattenName(localDir string, rel string, used map[string]string) (string, error) {
+	name := path.Base(rel)
+	prev, ok := used[name]
+	switch {
+	case !ok || ftp.flatten == FlattenOverwrite:
+		used[name] = rel
+		return name, nil
+	case ftp.flatten != FlattenPrefix:
+		return "", fmt.Errorf("%w: %s and %s", ErrFlattenCollision, prev, rel)
+	}
+
+	moved := rel
+	if rel == name {
+		moved = prev // downloaded already, make room at the root
+	}
+	prefixed := strings.Replace(moved, "/", "_", -1)
+	if other, ok := used[prefixed]; ok {
+		return "", fmt.Errorf("%w: %s and %s", ErrFlattenCollision, other, moved)
+	}
+	used[prefixed] = moved
+	if moved == rel {
+		return prefixed, nil
+	}
+	if err := os.Rename(filepath.Join(localDir, name), filepath.Join(localDir, prefixed)); err != nil {
+		return "", err
+	}
+	used[name] = rel
+	return name, nil
+}
+
+// RemoteWalkFunc is called by WalkRemote for each entry below the root, with its absolute path.
+// If listing a folder fails, it is called once more for that folder with the error.
+// Returning filepath.SkipDir for a folder skips its contents, any other error stops the walk.
+type RemoteWalkFunc func(remotepath string, entry *Entry, err error) error
+
+// WalkRemote walks the remote tree rooted at root, which should be an absolute path.
+// It only lists absolute paths and never changes the working directory, so it also works on
+// servers which jail users and reject a CWD to their own home written as "/".
+// Entries are visited in listing order, a folder before its contents.
+func (ftp *FTP) WalkRemote(root string, fn RemoteWalkFunc) error {
+	return ftp.walkRemoteWith(root, ftp.listDir, fn)
+}
+
+// listDir lists a single folder, the lister used by WalkRemote.
+func (ftp *FTP) listDir(p string) ([]*Entry, error) {
+	return ftp.List(p)
+}
+
+// walkRemoteWith is WalkRemote listing the folders with list.
+func (ftp *FTP) walkRemoteWith(root string, list func(p string) ([]*Entry, error), fn RemoteWalkFunc) error {
+	entries, err := list(root)
+	if err != nil {
+		return err
+	}
+	return ftp.walkRemote(root, entries, list, fn)
+}
+
+func (ftp *FTP) walkRemote(dir string, entries []*Entry, list func(p string) ([]*Entry, error), fn RemoteWalkFunc) error {
+	for _, e := range entries {
+		p := path.Join(dir, e.Name)
+		if err := fn(p, e, nil); err != nil {
+			if err == filepath.SkipDir && e.Type == EntryTypeFolder {
+				continue
+			}
+			return err
+		}
+		if e.Type != EntryTypeFolder {
+			continue
+		}
+		children, err := list(p)
+		if err != nil {
+			if err = fn(p, e, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err = ftp.walkRemote(p, children, list, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DownloadDirTree downloads the contents of a remote folder and all of its subfolders
+// into a local folder, which is created if needed.
+// remoteDir 		-> absolute path of the remote folder, e.g. "/" for the home of a jailed user.
+// localDir 		-> path to the local folder receiving the tree.
+// excludedDirs		-> a slice of folder names to exclude from the downloaded directory tree.
+// Returns the number of files downloaded and an error if any.
+//
+// Every remote folder is created locally, empty ones included, unless flattened.
+// Only absolute paths are used, the working directory is never changed.
+// Compare DuRemote with CheckLocalSpace beforehand to fail fast when the tree does not fit.
+// The files skipped by the SetTreeSkipPolicy policy or by excludedDirs are reported to the SetSkipCallback function.
+// With SetTreeFlatten all the files land directly in localDir.
+func (ftp *FTP) DownloadDirTree(remoteDir string, localDir string, excludedDirs []string) (n int, err error) {
+	defer ftp.beginJob()()
+	if len(remoteDir) == 0 {
+		return n, errors.New("A valid remote folder needs specifying.")
+	}
+	defer ftp.startHeartbeat("download", remoteDir)()
+	err = ftp.downloadDirTree(remoteDir, localDir, excludedSet(excludedDirs), ftp.listDir, &n)
+	return n, err
+}
+
+// excludedSet returns the lower case names of the excluded folders.
+func excludedSet(excludedDirs []string) map[string]bool {
+	exDirs := make(map[string]bool, len(excludedDirs))
+	for _, v := range excludedDirs {
+		exDirs[strings.ToLower(v)] = true
+	}
+	return exDirs
+}
+
+// ErrUnsafePath is returned for a listed entry whose local path would land outside the local
+// folder, its name being a path or "..", as a hostile or broken server may list.
+var ErrUnsafePath = errors.New("Remote entry escapes the local folder")
+
+// plainName reports whether a listed name is a plain file name, neither a path nor "..".
+func plainName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// localPathIn returns the path in localDir of rel, a slash separated path relative to it,
+// ErrUnsafePath if it lands outside of localDir.
+func localPathIn(localDir string, rel string) (string, error) {
+	p := filepath.Join(localDir, filepath.FromSlash(rel))
+	r, err := filepath.Rel(localDir, p)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, rel)
+	}
+	return p, nil
+}
+
+// downloadDirTree downloads the tree at remoteDir into localDir, listing the folders with list.
+func (ftp *FTP) downloadDirTree(remoteDir string, localDir string, exDirs map[string]bool, list func(p string) ([]*Entry, error), n *int) (err error) {
+	if err = os.MkdirAll(localDir, 0755); err != nil {
+		return
+	}
+	remoteDir = path.Clean(remoteDir)
+	flat := make(map[string]string) // flattened name -> relative path
+
+	err = ftp.walkRemoteWith(remoteDir, list, func(remotepath string, e *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ftp.isHeartbeat(remotepath) {
+			return nil
+		}
+		if !plainName(e.Name) || !strings.HasPrefix(remotepath, remoteDir) {
+			return fmt.Errorf("%w: %q", ErrUnsafePath, e.Name)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(remotepath, remoteDir), "/")
+		localPath, err := localPathIn(localDir, rel)
+		if err != nil {
+			return err
+		}
+		switch e.Type {
+		case EntryTypeFolder:
+			if exDirs[strings.ToLower(e.Name)] {
+				ftp.skipped("download", remotepath, localPath, SkipExcluded, nil)
+				return filepath.SkipDir
+			}
+			if ftp.flatten != FlattenNone {
+				return nil
+			}
+			return os.MkdirAll(localPath, 0755)
+		case EntryTypeFile:
+			if ftp.flatten != FlattenNone {
+				name, err := ftp.flattenName(localDir, rel, flat)
+				if err != nil {
+					return err
+				}
+				if localPath, err = localPathIn(localDir, name); err != nil {
+					return err
+				}
+			}
+			if ftp.skipPolicy&compareSkips != 0 {
+				if fi, err := os.Stat(localPath); err == nil {
+					if reason, skip := ftp.skipReason(e.Size, e.Time, fi); skip {
+						ftp.skipped("download", remotepath, localPath, reason, nil)
+						return nil
+					}
+				}
+			}
+			ftp.writeInfo("Downloading file:", remotepath)
+			if err := ftp.treeAttempt(remotepath, func() error { return ftp.DownloadFileWithOptions(remotepath, localPath, nil) }); err != nil {
+				return err
+			}
+			*n++
+		}
+		return nil
+	})
+	if err != nil {
+		ftp.writeInfo(fmt.Sprintf("An error while downloading the folder %s occurred.", remoteDir))
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package ftp4go
+
+import (
+	"compress/flate"
+	"io"
+	"path"
+	"strings"
+)
+
+// CompressionPolicy decides, for each transfer of a session in MODE Z, whether compressing
+// the data is worth its CPU cost; the others are transferred in MODE S.
+type CompressionPolicy int
+
+const (
+	// CompressSkipKnown transfers the files with an incompressible extension, see
+	// SetIncompressibleExtensions, in MODE S. The default.
+	CompressSkipKnown CompressionPolicy = iota
+	// CompressSample also deflates a sample of the first bytes of each upload and transfers
+	// it in MODE S unless the sample shrinks by a tenth. Downloads are decided by extension.
+	CompressSample
+	// CompressAll compresses every transfer.
+	CompressAll
+)
+
+// compressionSample is the number of leading bytes of an upload deflated by CompressSample.
+const compressionSample = 32 * 1024
+
+// DefaultIncompressibleExtensions are the extensions of compressed archives, images, audio and
+// video transferred in MODE S by default.
+var DefaultIncompressibleExtensions = []string{".7z", ".avi", ".bz2", ".docx", ".flac", ".gif", ".gz", ".jar", ".jpeg", ".jpg", ".mkv", ".mov", ".mp3", ".mp4", ".ogg", ".png", ".rar", ".tgz", ".webm", ".webp", ".xlsx", ".xz", ".zip", ".zst"}
+
+// SetCompressionPolicy sets which transfers of a session in MODE Z, see Negotiate, are compressed.
+func (ftp *FTP) SetCompressionPolicy(policy CompressionPolicy) {
+	ftp.zPolicy = policy
+}
+
+// SetIncompressibleExtensions sets the file extensions, such as ".zip", never worth compressing,
+// compared case insensitively. No extensions means DefaultIncompressibleExtensions.
+func (ftp *FTP) SetIncompressibleExtensions(exts ...string) {
+	ftp.zSkipExts = make(map[string]bool, len(exts))
+	for _, e := range exts {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		ftp.zSkipExts[strings.ToLower(e)] = true
+	}
+}
+
+// worthCompressing applies the compression policy to the file name and, for an upload
+// sampled by CompressSample, its leading bytes.
+func (ftp *FTP) worthCompressing(name string, sample []byte) bool {
+	if ftp.zPolicy == CompressAll {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if len(ftp.zSkipExts) == 0 {
+		for _, e := range DefaultIncompressibleExtensions {
+			if e == ext {
+				return false
+			}
+		}
+	} else if ftp.zSkipExts[ext] {
+		return false
+	}
+	if ftp.zPolicy == CompressSample && len(sample) > 0 {
+		return deflatedSize(sample)*10 < int64(len(sample))*9
+	}
+	return true
+}
+
+// deflatedSize returns the size of b compressed the fastest way.
+func deflatedSize(b []byte) int64 {
+	cw := NewCountingWriter(io.Discard, "", "", nil)
+	zw, _ := flate.NewWriter(cw, flate.BestSpeed)
+	zw.Write(b)
+	zw.Close()
+	return cw.Count()
+}
+
+// useCompression switches a session in MODE Z to MODE S for a transfer not worth compressing,
+// until the returned function is called.
+func (ftp *FTP) useCompression(name string, sample []byte) (restore func(), err error) {
+	if !ftp.modeZ || ftp.worthCompressing(name, sample) {
+		return func() {}, nil
+	}
+	if _, err = ftp.SendAndRead(MODE_FTP_CMD, "S"); err != nil {
+		return nil, err
+	}
+	ftp.writeInfo("Transferring", name, "uncompressed")
+	ftp.modeZ = false
+	return func() {
+		if _, err := ftp.SendAndRead(MODE_FTP_CMD, "Z"); err != nil {
+			ftp.writeInfo("Unable to switch back to MODE Z:", err)
+			return
+		}
+		ftp.modeZ = true
+	}, nil
+}
@@ -0,0 +1,298 @@
+package ftp4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shenshouer/ftp4go/internal/socks5"
+)
+
+// Config is the effective configuration of a session: the settings as the library resolved
+// them, after the defaults, the proxy of the environment and what the server turned out to
+// support. It prints as a readable report and marshals to JSON, for bug reports to tell what
+// the library decided to do rather than what the caller meant to configure.
+type Config struct {
+	Host         string         `json:"host"`
+	Port         int            `json:"port"`
+	Proxy        string         `json:"proxy,omitempty"`             // URL of the SOCKS5 proxy, password redacted, empty for a direct connection
+	ProxyFromEnv bool           `json:"proxy_from_env,omitempty"`    // the proxy comes from ALL_PROXY, see Connect
+	DialTimeout  ConfigDuration `json:"dial_timeout,omitempty"`      // see SetFTPTimeout, 0 for none
+	ReplyTimeout string         `json:"reply_timeout,omitempty"`     // bounds of the adaptive timeout, see SetAdaptiveTimeout
+	CommandDelay string         `json:"command_delay,omitempty"`     // see SetCommandDelay
+	Greeting     string         `json:"greeting_policy"`             // see SetGreetingPolicy
+	Login        string         `json:"login_policy"`                // see SetLoginPolicy
+	Strictness   string         `json:"strictness"`                  // see SetStrictness
+	DataConn     string         `json:"data_connections"`            // "passive" or "active", see SetPassive
+	Protection   string         `json:"protection"`                  // "clear" or "private", see Secure
+	UTF8         bool           `json:"utf8"`                        // the file names are UTF-8, OPTS UTF8 ON accepted
+	AutoUTF8     bool           `json:"auto_utf8,omitempty"`         // see SetAutoUTF8
+	Encoding     string         `json:"name_encoding,omitempty"`     // see SetNameEncoding, empty for none
+	Compression  string         `json:"compression"`                 // "MODE Z" or "MODE S", with the reason
+	ZPolicy      string         `json:"compression_policy"`          // see SetCompressionPolicy
+	ZLevel       int            `json:"compression_level,omitempty"` // see OptsModeZLevel, 0 for the default
+	MlstFacts    []string       `json:"mlst_facts,omitempty"`        // see OptsMLST
+	Probe        ProbeStrategy  `json:"probe"`                       // ProbeAuto resolved once FEAT is known
+	CaseFolding  CaseFolding    `json:"case_folding"`                // CaseDetect resolved once probed
+	Timezone     ConfigDuration `json:"timezone,omitempty"`          // see SetServerTimezone
+	Drain        ConfigDuration `json:"drain_timeout"`               // see SetDrainTimeout
+	FinalReply   ConfigDuration `json:"final_reply_timeout,omitempty"`
+	Unsolicited  ConfigDuration `json:"unsolicited_wait,omitempty"`
+	UploadRate   int64          `json:"upload_rate,omitempty"`   // bytes per second of the upload RateGroup
+	DownloadRate int64          `json:"download_rate,omitempty"` // bytes per second of the download RateGroup
+	BlockTuning  bool           `json:"block_tuning,omitempty"`
+	Checkpoints  int64          `json:"checkpoint_interval,omitempty"` // bytes between two checkpoints, 0 if none are kept
+	HashCache    bool           `json:"hash_cache,omitempty"`
+	Journal      bool           `json:"journal,omitempty"`
+
+	TreeMode    string         `json:"tree_mode"`             // see SetTreeTransferMode
+	Skip        string         `json:"skip_policy,omitempty"` // see SetTreeSkipPolicy
+	Dedup       string         `json:"dedup,omitempty"`       // see SetTreeDedup
+	Flatten     string         `json:"flatten,omitempty"`     // see SetTreeFlatten
+	Retries     int            `json:"tree_retries,omitempty"`
+	RetryWait   ConfigDuration `json:"tree_retry_wait,omitempty"`
+	Receipts    bool           `json:"receipts,omitempty"`
+	Heartbeat   string         `json:"heartbeat,omitempty"` // name and interval of the heartbeat file, see SetHeartbeat
+	Disabled    []string       `json:"disabled,omitempty"`  // the features the session stopped using, and why
+	RemoveParts bool           `json:"remove_partial,omitempty"`
+}
+
+// Config returns the effective configuration of the session. It sends no command:
+// call it after Login, and after Negotiate or Secure if used, for the settings gated
+// by the server to be resolved.
+func (ftp *FTP) Config() *Config {
+	c := &Config{
+		Host:         ftp.Host,
+		Port:         ftp.Port,
+		Proxy:        ftp.proxy,
+		ProxyFromEnv: ftp.proxyEnv,
+		DialTimeout:  ConfigDuration(ftp.timeoutInMsec),
+		Greeting:     enumName([]string{"default", "strict", "ignore"}, int(ftp.greeting)),
+		Login:        enumName([]string{"required", "optional", "skip"}, int(ftp.loginPolicy)),
+		Strictness:   enumName([]string{"lenient", "strict"}, int(ftp.strictness)),
+		DataConn:     "active",
+		Protection:   "clear",
+		UTF8:         ftp.utf8,
+		AutoUTF8:     ftp.autoUTF8,
+		Compression:  "MODE S",
+		ZPolicy:      enumName([]string{"skip-known", "sample", "all"}, int(ftp.zPolicy)),
+		ZLevel:       ftp.zLevel,
+		MlstFacts:    ftp.MlstFacts(),
+		Probe:        ftp.probe,
+		CaseFolding:  ftp.caseFolding,
+		Timezone:     ConfigDuration(ftp.tzOffset),
+		Drain:        ConfigDuration(ftp.drainTimeout),
+		FinalReply:   ConfigDuration(ftp.finalWait),
+		Unsolicited:  ConfigDuration(ftp.unsolicited),
+		UploadRate:   ftp.upGroup.limit(),
+		DownloadRate: ftp.downGroup.limit(),
+		BlockTuning:  ftp.blockTuning,
+		HashCache:    ftp.hashCache != nil,
+		Journal:      ftp.journal != nil,
+		TreeMode:     ftp.treeMode.String(),
+		Dedup:        enumName([]string{"", "copy", "record"}, int(ftp.dedup)),
+		Flatten:      enumName([]string{"", "prefix", "error", "overwrite"}, int(ftp.flatten)),
+		Retries:      ftp.treeRetries,
+		RetryWait:    ConfigDuration(ftp.treeRetryWait),
+		Receipts:     ftp.receiptOpts != nil,
+		RemoveParts:  ftp.removePartial,
+	}
+	if c.Drain <= 0 {
+		c.Drain = ConfigDuration(DefaultDrainTimeout)
+	}
+	if t := ftp.timeouts; t.max > 0 {
+		c.ReplyTimeout = fmt.Sprintf("%v-%v", t.min, t.max)
+	}
+	if p := ftp.pacer; p.min > 0 || p.jitter > 0 {
+		c.CommandDelay = fmt.Sprintf("%v+%v", p.min, p.jitter)
+	}
+	if ftp.passive(DataConnSession) {
+		c.DataConn = "passive"
+	}
+	if ftp.Protection() == ProtPrivate {
+		c.Protection = "private"
+	}
+	switch ftp.encoding {
+	case nil:
+	case Latin1:
+		c.Encoding = "latin1"
+	default:
+		c.Encoding = fmt.Sprintf("%T", ftp.encoding)
+	}
+	if ftp.probe == ProbeAuto && ftp.features != nil {
+		switch {
+		case ftp.HasFeature("MLST"):
+			c.Probe = ProbeMLST
+		case ftp.HasFeature("SIZE"):
+			c.Probe = ProbeSize
+		default:
+			c.Probe = ProbeList
+		}
+	}
+	if ftp.caseFolding == CaseDetect {
+		c.CaseFolding = ftp.caseFound
+	}
+	if ftp.checkpoints != nil {
+		c.Checkpoints = ftp.ckInterval
+		if c.Checkpoints <= 0 {
+			c.Checkpoints = DefaultCheckpointInterval
+		}
+	}
+	var skips []string
+	for _, s := range []struct {
+		policy SkipPolicy
+		name   string
+	}{{SkipIfSameSize, "same-size"}, {SkipIfTargetNewer, "target-newer"}, {SkipIfUnreadable, "unreadable"}} {
+		if ftp.skipPolicy&s.policy != 0 {
+			skips = append(skips, s.name)
+		}
+	}
+	c.Skip = strings.Join(skips, ",")
+	if o := ftp.heartbeatOpts; o != nil {
+		name, interval := o.Name, o.Interval
+		if name == "" {
+			name = DefaultHeartbeatName
+		}
+		if interval <= 0 {
+			interval = DefaultHeartbeatInterval
+		}
+		c.Heartbeat = fmt.Sprintf("%s every %v", name, interval)
+	}
+
+	switch {
+	case ftp.modeZ:
+		c.Compression = "MODE Z"
+	case ftp.noCompression:
+		c.Compression = "MODE S, MODE Z disabled by SetCompression"
+	case ftp.features != nil && !ftp.HasFeature("MODE Z"):
+		c.Compression = "MODE S, MODE Z not advertised"
+	}
+	if ftp.autoUTF8 && !ftp.utf8 && ftp.features != nil {
+		c.Disabled = append(c.Disabled, "UTF-8 file names: OPTS UTF8 ON refused or UTF8 not advertised")
+	}
+	if ftp.alloRefused {
+		c.Disabled = append(c.Disabled, "size announcements: ALLO refused by the server")
+	}
+	if ftp.noSiteCopy {
+		c.Disabled = append(c.Disabled, "server-side copy: SITE CPFR/CPTO refused by the server")
+	}
+	return c
+}
+
+// String returns a readable report of the configuration, one setting per line;
+// the unset optional settings are left out.
+func (c *Config) String() string {
+	var b strings.Builder
+	line := func(name string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				return
+			}
+		case bool:
+			if !v {
+				return
+			}
+		case int:
+			if v == 0 {
+				return
+			}
+		case int64:
+			if v == 0 {
+				return
+			}
+		case ConfigDuration:
+			if v == 0 {
+				return
+			}
+			value = time.Duration(v)
+		case []string:
+			if len(v) == 0 {
+				return
+			}
+			value = strings.Join(v, ", ")
+		}
+		fmt.Fprintf(&b, "%s: %v\n", name, value)
+	}
+	line("Server", fmt.Sprintf("%s:%d", c.Host, c.Port))
+	if c.Proxy == "" {
+		line("Proxy", "none")
+	} else if c.ProxyFromEnv {
+		line("Proxy", c.Proxy+" (environment)")
+	} else {
+		line("Proxy", c.Proxy)
+	}
+	line("Dial timeout", c.DialTimeout)
+	line("Reply timeout", c.ReplyTimeout)
+	line("Command delay", c.CommandDelay)
+	line("Greeting policy", c.Greeting)
+	line("Login policy", c.Login)
+	line("Strictness", c.Strictness)
+	line("Data connections", c.DataConn)
+	line("Protection", c.Protection)
+	line("UTF-8 file names", c.UTF8)
+	line("Auto UTF-8", c.AutoUTF8)
+	line("Name encoding", c.Encoding)
+	line("Compression", c.Compression)
+	line("Compression policy", c.ZPolicy)
+	line("Compression level", c.ZLevel)
+	line("MLST facts", c.MlstFacts)
+	line("Probe", c.Probe.String())
+	line("Case folding", c.CaseFolding.String())
+	line("Server timezone", c.Timezone)
+	line("Drain timeout", c.Drain)
+	line("Final reply timeout", c.FinalReply)
+	line("Unsolicited wait", c.Unsolicited)
+	line("Upload rate", c.UploadRate)
+	line("Download rate", c.DownloadRate)
+	line("Block tuning", c.BlockTuning)
+	line("Checkpoint interval", c.Checkpoints)
+	line("Hash cache", c.HashCache)
+	line("Journal", c.Journal)
+	line("Tree transfer mode", c.TreeMode)
+	line("Skip policy", c.Skip)
+	line("Dedup", c.Dedup)
+	line("Flatten", c.Flatten)
+	line("Tree retries", c.Retries)
+	line("Tree retry wait", c.RetryWait)
+	line("Receipts", c.Receipts)
+	line("Heartbeat", c.Heartbeat)
+	line("Remove partial downloads", c.RemoveParts)
+	for _, d := range c.Disabled {
+		line("Disabled", d)
+	}
+	return b.String()
+}
+
+// JSON returns the configuration as indented JSON.
+func (c *Config) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// resolveProxy records the proxy Connect uses to reach host, arg being the URL given to it.
+func (ftp *FTP) resolveProxy(arg string, host string) {
+	ftp.proxy, ftp.proxyEnv = "", arg == ""
+	if arg == "" {
+		if arg = os.Getenv("ALL_PROXY"); arg == "" {
+			arg = os.Getenv("all_proxy")
+		}
+		if arg == "" || ftp.dialer == socks5.Direct || socks5.Bypassed(ftp.dialer, host) {
+			ftp.proxyEnv = false
+			return
+		}
+	}
+	if u, err := url.Parse(arg); err == nil {
+		ftp.proxy = u.Redacted()
+	}
+}
+
+// enumName returns the name of the value i of an enumeration, its number if out of range.
+func enumName(names []string, i int) string {
+	if i < 0 || i >= len(names) {
+		return fmt.Sprint(i)
+	}
+	return names[i]
+}
@@ -0,0 +1,340 @@
+package ftp4go
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Quirks are the settings working around the deviations of a server, as found by
+// CheckConformance. They can be kept in the partner profile of the server, see
+// PartnerProfile.Quirks, and are applied to a session before it connects.
+type Quirks struct {
+	Probe         ProbeStrategy  `json:"probe,omitempty"`          // see SetProbeStrategy
+	UTF8          bool           `json:"utf8,omitempty"`           // switch to UTF-8 file names at login, see SetAutoUTF8
+	NoCompression bool           `json:"no_compression,omitempty"` // never negotiate MODE Z, see SetCompression
+	Timezone      ConfigDuration `json:"timezone,omitempty"`       // offset of the LIST times, see SetServerTimezone
+	CaseFolding   CaseFolding    `json:"case_folding,omitempty"`   // see SetCaseFolding
+}
+
+// Apply configures the session with the quirks, it is meant to be called before Connect.
+func (q *Quirks) Apply(ftp *FTP) error {
+	ftp.SetProbeStrategy(q.Probe)
+	ftp.SetAutoUTF8(q.UTF8)
+	ftp.SetServerTimezone(time.Duration(q.Timezone))
+	ftp.SetCaseFolding(q.CaseFolding)
+	return ftp.SetCompression(!q.NoCompression)
+}
+
+// ConformanceOptions configures CheckConformance.
+type ConformanceOptions struct {
+	// Dir is a writable folder for the checks uploading a probe file: REST, SIZE, the
+	// round trip of UTF-8 names and the server time zone. Empty skips them.
+	Dir string
+	// IdleWait is the silence kept before checking the session is still alive, 0 skips the check.
+	IdleWait time.Duration
+}
+
+// CheckStatus is the outcome of a conformance check.
+type CheckStatus int
+
+const (
+	CheckPassed CheckStatus = iota
+	CheckFailed
+	CheckSkipped // the server does not advertise the feature, or the options exclude the check
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckPassed:
+		return "passed"
+	case CheckFailed:
+		return "failed"
+	}
+	return "skipped"
+}
+
+func (s CheckStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ConformanceCheck is the outcome of a check of CheckConformance.
+type ConformanceCheck struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// ConformanceReport is the outcome of CheckConformance: the checks run, in order, and the
+// quirks working around the failures.
+type ConformanceReport struct {
+	Greeting string             `json:"greeting"`
+	Features []string           `json:"features"`
+	Checks   []ConformanceCheck `json:"checks"`
+	Quirks   Quirks             `json:"quirks"`
+}
+
+// Failed returns the checks which failed.
+func (r *ConformanceReport) Failed() []ConformanceCheck {
+	var failed []ConformanceCheck
+	for _, c := range r.Checks {
+		if c.Status == CheckFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// String returns the report as readable text, one check per line.
+func (r *ConformanceReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Greeting: %s\n", r.Greeting)
+	fmt.Fprintf(&b, "Features: %s\n", strings.Join(r.Features, ", "))
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "%-7s %s", c.Status, c.Name)
+		if c.Detail != "" {
+			fmt.Fprintf(&b, ": %s", c.Detail)
+		}
+		b.WriteString("\n")
+	}
+	q, _ := json.Marshal(r.Quirks)
+	fmt.Fprintf(&b, "Quirks: %s\n", q)
+	return b.String()
+}
+
+// JSON returns the report as indented JSON.
+func (r *ConformanceReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// CheckConformance runs a battery of checks against the server of a logged in session and
+// reports the capabilities found and the quirks to apply to the later sessions: FEAT, TLS,
+// UTF-8 names, MLSD, MODE Z, SIZE, REST and the server time zone, then the idle timeout.
+// A failed check is reported, not returned: the error is for a session which broke down.
+// The checks leave the session in MODE S; with opts.Dir set, the time zone found is set.
+func (ftp *FTP) CheckConformance(opts *ConformanceOptions) (*ConformanceReport, error) {
+	if opts == nil {
+		opts = &ConformanceOptions{}
+	}
+	r := &ConformanceReport{Greeting: ftp.welcome}
+	add := func(name string, status CheckStatus, format string, args ...interface{}) {
+		r.Checks = append(r.Checks, ConformanceCheck{name, status, fmt.Sprintf(format, args...)})
+	}
+
+	fts, err := ftp.Feat()
+	switch {
+	case err == nil:
+		r.Features = fts
+		add("FEAT", CheckPassed, "%d features", len(fts))
+	case replyCode(err) >= 500:
+		ftp.features = map[string]string{}
+		add("FEAT", CheckFailed, "%v", err)
+	default:
+		return r, err
+	}
+
+	switch {
+	case ftp.Protection() == ProtPrivate:
+		add("TLS", CheckPassed, "the session is secured")
+	case ftp.HasFeature("AUTH TLS") || ftp.HasFeature("AUTH SSL"):
+		add("TLS", CheckSkipped, "AUTH TLS advertised, call Secure before Login to check it")
+	default:
+		add("TLS", CheckFailed, "AUTH TLS not advertised")
+	}
+
+	switch {
+	case ftp.utf8:
+		r.Quirks.UTF8 = true
+		add("UTF8", CheckPassed, "OPTS UTF8 ON accepted")
+	case !ftp.HasFeature("UTF8"):
+		add("UTF8", CheckSkipped, "UTF8 not advertised")
+	default:
+		if err = ftp.enableUTF8(); err != nil {
+			if replyCode(err) < 500 {
+				return r, err
+			}
+			add("UTF8", CheckFailed, "UTF8 advertised but OPTS UTF8 ON refused: %v", err)
+		} else {
+			r.Quirks.UTF8 = true
+			add("UTF8", CheckPassed, "OPTS UTF8 ON accepted")
+		}
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		if dir, err = ftp.Pwd(); err != nil {
+			return r, err
+		}
+	}
+	if err = ftp.checkMlsd(r, dir, add); err != nil {
+		return r, err
+	}
+	if err = ftp.checkModeZ(r, dir, add); err != nil {
+		return r, err
+	}
+
+	if opts.Dir == "" {
+		for _, name := range []string{"SIZE", "REST", "UTF8 names", "Timezone"} {
+			add(name, CheckSkipped, "no writable folder given")
+		}
+	} else if err = ftp.checkWritable(r, opts.Dir, add); err != nil {
+		return r, err
+	}
+
+	if opts.IdleWait <= 0 {
+		add("Idle", CheckSkipped, "no idle wait given")
+	} else {
+		time.Sleep(opts.IdleWait)
+		if _, err = ftp.Pwd(); err != nil {
+			add("Idle", CheckFailed, "the session did not survive %v of silence: %v", opts.IdleWait, err)
+			return r, err
+		}
+		add("Idle", CheckPassed, "the session survived %v of silence", opts.IdleWait)
+	}
+	return r, nil
+}
+
+// checkMlsd lists dir with MLSD if advertised, a failure making Exists and IsDir avoid MLST.
+func (ftp *FTP) checkMlsd(r *ConformanceReport, dir string, add func(string, CheckStatus, string, ...interface{})) error {
+	if !ftp.HasFeature("MLST") {
+		add("MLSD", CheckSkipped, "MLST not advertised")
+		return nil
+	}
+	if _, err := ftp.Mlsd(dir, nil); err != nil {
+		if replyCode(err) < 400 {
+			return err
+		}
+		r.Quirks.Probe = ProbeList
+		if ftp.HasFeature("SIZE") {
+			r.Quirks.Probe = ProbeSize
+		}
+		add("MLSD", CheckFailed, "MLST advertised but MLSD failed: %v", err)
+		return nil
+	}
+	add("MLSD", CheckPassed, "MLSD listed %s", dir)
+	return nil
+}
+
+// checkModeZ compares the listings of dir in MODE S and MODE Z if advertised.
+func (ftp *FTP) checkModeZ(r *ConformanceReport, dir string, add func(string, CheckStatus, string, ...interface{})) error {
+	if !ftp.HasFeature("MODE Z") {
+		add("MODE Z", CheckSkipped, "MODE Z not advertised")
+		return nil
+	}
+	if ftp.modeZ {
+		if _, err := ftp.SendAndRead(MODE_FTP_CMD, "S"); err != nil {
+			return err
+		}
+		ftp.modeZ = false
+	}
+	plain, err := ftp.Nlst(dir)
+	if err != nil {
+		return err
+	}
+	if _, err = ftp.SendAndRead(MODE_FTP_CMD, "Z"); err != nil {
+		if replyCode(err) < 500 {
+			return err
+		}
+		r.Quirks.NoCompression = true
+		add("MODE Z", CheckFailed, "MODE Z advertised but refused: %v", err)
+		return nil
+	}
+	ftp.modeZ = true
+	compressed, err := ftp.Nlst(dir)
+	if _, err1 := ftp.SendAndRead(MODE_FTP_CMD, "S"); err1 != nil {
+		return err1
+	}
+	ftp.modeZ = false
+	if ftp.negotiation != nil {
+		ftp.negotiation.ModeZ = false
+	}
+	sort.Strings(plain)
+	sort.Strings(compressed)
+	switch {
+	case err != nil:
+		r.Quirks.NoCompression = true
+		add("MODE Z", CheckFailed, "listing in MODE Z failed: %v", err)
+	case strings.Join(plain, "\n") != strings.Join(compressed, "\n"):
+		r.Quirks.NoCompression = true
+		add("MODE Z", CheckFailed, "the listing in MODE Z differs from the one in MODE S")
+	default:
+		add("MODE Z", CheckPassed, "the listings in MODE Z and MODE S agree")
+	}
+	return nil
+}
+
+// checkWritable uploads a probe file to dir to check SIZE and REST, then the round trip
+// of UTF-8 names and the server time zone.
+func (ftp *FTP) checkWritable(r *ConformanceReport, dir string, add func(string, CheckStatus, string, ...interface{})) error {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	const content = "0123456789"
+	probe := path.Join(dir, ".ftp4go-conformance-"+hex.EncodeToString(b))
+	if err := ftp.Store(probe, strings.NewReader(content), nil); err != nil {
+		return fmt.Errorf("Cannot upload the conformance probe %s: %w", probe, err)
+	}
+	defer func() {
+		if _, err := ftp.Delete(probe); err != nil {
+			ftp.writeInfo("Unable to remove the conformance probe", probe, ":", err)
+		}
+	}()
+
+	if !ftp.HasFeature("SIZE") {
+		add("SIZE", CheckSkipped, "SIZE not advertised")
+	} else if size, err := ftp.Size(probe); err != nil || size != len(content) {
+		if r.Quirks.Probe == ProbeAuto && !ftp.HasFeature("MLST") {
+			r.Quirks.Probe = ProbeList
+		}
+		add("SIZE", CheckFailed, "SIZE of a %d bytes file answered %d, %v", len(content), size, err)
+	} else {
+		add("SIZE", CheckPassed, "SIZE answered %d", size)
+	}
+
+	var buf bytes.Buffer
+	if err := ftp.Retrieve(probe, &buf, &TransferOptions{Offset: 4}); err != nil {
+		if ftp.conn == nil {
+			return err
+		}
+		add("REST", CheckFailed, "download from offset 4 failed: %v", err)
+	} else if buf.String() != content[4:] {
+		add("REST", CheckFailed, "download from offset 4 got %q instead of %q", buf.String(), content[4:])
+	} else {
+		add("REST", CheckPassed, "download resumed at offset 4")
+	}
+
+	if check, err := ftp.VerifyEncoding(dir); err != nil {
+		add("UTF8 names", CheckFailed, "%v", err)
+	} else if !check.Intact {
+		r.Quirks.UTF8 = false
+		add("UTF8 names", CheckFailed, "%q was listed back as %q", check.Name, check.Listed)
+	} else {
+		add("UTF8 names", CheckPassed, "%q listed back intact", EncodingProbe)
+	}
+
+	cwd, err := ftp.Pwd()
+	if err != nil {
+		return err
+	}
+	if _, err = ftp.Cwd(dir); err != nil {
+		return err
+	}
+	offset, err := ftp.DetectServerTimezone()
+	if _, err1 := ftp.Cwd(cwd); err1 != nil {
+		return err1
+	}
+	if err != nil {
+		add("Timezone", CheckFailed, "%v", err)
+	} else {
+		r.Quirks.Timezone = ConfigDuration(offset)
+		add("Timezone", CheckPassed, "LIST times are %v from UTC", offset)
+	}
+	return nil
+}
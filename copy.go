@@ -0,0 +1,60 @@
+package ftp4go
+
+import (
+	"io"
+	"os"
+)
+
+// CopyRemote copies the remote file from to the remote path to. When the server advertises
+// the SITE COPY feature of ProFTPD's mod_copy, see Feat, the file is copied on the server
+// with SITE CPFR/CPTO; otherwise, or if the server refuses these commands, the file is
+// downloaded to a temporary file and uploaded back, in binary mode.
+func (ftp *FTP) CopyRemote(from string, to string) error {
+	if ftp.HasFeature("SITE COPY") && !ftp.noSiteCopy {
+		err := ftp.siteCopy(from, to)
+		switch replyCode(err) {
+		case StatusBadCommand, StatusBadArguments, StatusNotImplemented, StatusNotImplementedParameter:
+			ftp.writeInfo("SITE CPFR/CPTO not supported, relaying the copy:", err)
+			ftp.noSiteCopy = true
+		default:
+			if err == nil {
+				ftp.writeInfo("Copied", from, "to", to, "on the server")
+			}
+			return err
+		}
+	}
+	return ftp.relayCopy(from, to)
+}
+
+// siteCopy copies a remote file on the server with the SITE CPFR/CPTO commands of
+// ProFTPD's mod_copy.
+func (ftp *FTP) siteCopy(from string, to string) error {
+	if _, err := ftp.SendAndRead(SITE_FTP_CMD, "CPFR", from); err != nil {
+		return err
+	}
+	// the server copies the whole file before replying
+	ftp.timeouts.untimed = true
+	_, err := ftp.SendAndRead(SITE_FTP_CMD, "CPTO", to)
+	return err
+}
+
+// relayCopy copies a remote file through a temporary local file, the control connection
+// carrying one transfer at a time.
+func (ftp *FTP) relayCopy(from string, to string) (err error) {
+	f, err := os.CreateTemp("", "ftp4go-copy-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	if err = ftp.Retrieve(from, f, nil); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	ftp.writeInfo("Relaying the copy of", from, "to", to)
+	return ftp.Store(to, f, nil)
+}
@@ -0,0 +1,108 @@
+package ftp4go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// DedupMode selects how UploadDirTree handles local files identical to one it uploaded
+// already, same size and SHA-256 checksum, see SetTreeDedup.
+type DedupMode int
+
+const (
+	DedupNone   DedupMode = iota // upload every file, the default
+	DedupCopy                    // copy the first upload on the server with SITE CPFR/CPTO, uploading if the server does not support it
+	DedupRecord                  // upload only the first one, the others are recorded in the receipt and reported as skipped
+)
+
+// SetTreeDedup sets how UploadDirTree handles identical files, e.g. in build artifact
+// trees full of repeated files. The duplicates carry the remote path of the file they
+// duplicate in their ReceiptFile; the files copied on the server count as uploaded.
+func (ftp *FTP) SetTreeDedup(mode DedupMode) {
+	ftp.dedup = mode
+}
+
+// dupIndex indexes the files uploaded by an UploadDirTree call by size, the checksums
+// are only computed for files sharing their size.
+type dupIndex struct {
+	bySize   map[int64][]*dupFile
+	checksum func(localpath string) (int64, string, error)
+}
+
+type dupFile struct {
+	localpath  string
+	remotepath string
+	sum        string // computed on demand
+}
+
+func (f *dupFile) checksum(d *dupIndex) (string, error) {
+	if f.sum == "" {
+		_, sum, err := d.checksum(f.localpath)
+		if err != nil {
+			return "", err
+		}
+		f.sum = sum
+	}
+	return f.sum, nil
+}
+
+// find returns the remote path of a file identical to the local one, indexing the latter
+// under its remote path if there is none.
+func (d *dupIndex) find(localpath string, remotepath string, size int64) (string, error) {
+	f := &dupFile{localpath: localpath, remotepath: remotepath}
+	for _, c := range d.bySize[size] {
+		sum, err := c.checksum(d)
+		if err != nil {
+			return "", err
+		}
+		own, err := f.checksum(d)
+		if err != nil {
+			return "", err
+		}
+		if sum == own {
+			return c.remotepath, nil
+		}
+	}
+	d.bySize[size] = append(d.bySize[size], f)
+	return "", nil
+}
+
+// uploadDuplicate handles a file identical to the one uploaded at orig, done is false if
+// it must be uploaded nonetheless.
+func (ftp *FTP) uploadDuplicate(orig string, remotepath string, localpath string, n *int) (done bool, err error) {
+	if ftp.dedup == DedupRecord {
+		ftp.skipped("upload", localpath, remotepath, SkipDuplicate, nil)
+		return true, ftp.addToReceipt(remotepath, localpath, orig)
+	}
+	if ftp.noSiteCopy {
+		return false, nil
+	}
+	if err = ftp.siteCopy(orig, remotepath); err != nil {
+		if replyCode(err) < 500 {
+			return false, err
+		}
+		ftp.writeInfo("SITE CPFR/CPTO not supported, uploading the duplicates:", err)
+		ftp.noSiteCopy = true
+		return false, nil
+	}
+	ftp.writeInfo("Copied", orig, "to", remotepath, "on the server")
+	*n++
+	return true, ftp.addToReceipt(remotepath, localpath, orig)
+}
+
+// fileChecksum returns the size and the hex encoded SHA-256 checksum of a local file.
+func fileChecksum(localpath string) (int64, string, error) {
+	f, err := os.Open(localpath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,263 @@
+package ftp4go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Hash returns the SHA-256 checksum of a remote file, hex encoded, by using the HASH command.
+// The server must advertise HASH with SHA-256 in its FEAT reply.
+func (ftp *FTP) Hash(filename string) (checksum string, err error) {
+	const operation, fallback = "Checksumming a file", "compare the sizes only"
+	if !ftp.HasFeature("HASH SHA-256") {
+		return "", &ErrFeatureUnavailable{Feature: "HASH SHA-256", Operation: operation, Fallback: fallback}
+	}
+	if _, err = ftp.Opts("HASH", "SHA-256"); err != nil {
+		return "", ftp.unavailable(err, "HASH SHA-256", operation, fallback)
+	}
+	var r *Response
+	// the server reads the whole file before replying
+	ftp.timeouts.untimed = true
+	if r, err = ftp.SendAndRead(HASH_FTP_CMD, filename); err != nil {
+		return "", ftp.unavailable(err, "HASH SHA-256", operation, fallback)
+	}
+	// 213 SHA-256 0-49 169cd22282da7f147cb491e559e9dd filename
+	fields := strings.Fields(r.Message)
+	if r.Code != StatusFile || len(fields) < 3 {
+		return "", NewErrProto(errors.New("Unexpected HASH reply: " + r.Message))
+	}
+	return strings.ToLower(fields[2]), nil
+}
+
+// cleanup deletes a remote file left by a failed operation, a failure is only logged
+// since the error of the operation matters.
+func (ftp *FTP) cleanup(remotePath string) {
+	if _, err := ftp.Delete(remotePath); err != nil {
+		ftp.writeInfo("Unable to clean up", remotePath, ":", err)
+	}
+}
+
+// DeliverOptions configures DeliverFile, the zero value uses the defaults.
+type DeliverOptions struct {
+	TempPrefix    string   // prefix of the temporary name, default none
+	TempSuffix    string   // suffix of the temporary name, default ".part"
+	MarkerSuffix  string   // suffix of the marker file appended to the final name, default ".done"
+	NoMarker      bool     // do not create a marker file
+	MarkerContent []byte   // content of the marker file, default empty
+	VerifyHash    bool     // also compare the SHA-256 checksum via HASH, fails if the server lacks it
+	Callback      Callback // progress of the upload
+}
+
+// DeliverFile implements the common partner exchange pattern: the local file is uploaded
+// under a temporary name, verified by size (and checksum if requested), renamed into place
+// at remotePath and finally a marker file such as "name.done" is created next to it.
+// Either all steps succeed or the remote files created so far are removed again, so that
+// the consumer never picks up a partial delivery. opts may be nil.
+func (ftp *FTP) DeliverFile(localpath string, remotePath string, opts *DeliverOptions) (err error) {
+	if opts == nil {
+		opts = &DeliverOptions{}
+	}
+	tempSuffix, markerSuffix := opts.TempSuffix, opts.MarkerSuffix
+	if tempSuffix == "" && opts.TempPrefix == "" {
+		tempSuffix = ".part"
+	}
+	if markerSuffix == "" {
+		markerSuffix = ".done"
+	}
+	dir, name := path.Split(remotePath)
+	tempPath := dir + opts.TempPrefix + name + tempSuffix
+
+	var fi os.FileInfo
+	if fi, err = os.Stat(localpath); err != nil {
+		return
+	}
+
+	if err = ftp.UploadFileWithOptions(tempPath, localpath, &TransferOptions{Callback: opts.Callback}); err != nil {
+		ftp.cleanup(tempPath)
+		return err
+	}
+
+	// remove the temporary file if anything goes wrong from now on
+	published := false
+	defer func() {
+		if err != nil {
+			if published {
+				ftp.cleanup(remotePath)
+			} else {
+				ftp.cleanup(tempPath)
+			}
+		}
+	}()
+
+	if err = ftp.verifyDelivery(localpath, tempPath, fi.Size(), opts.VerifyHash); err != nil {
+		return
+	}
+
+	if _, err = ftp.Rename(tempPath, remotePath); err != nil {
+		return
+	}
+	published = true
+
+	if !opts.NoMarker {
+		marker := remotePath + markerSuffix
+		if err = ftp.StoreBytes(STORE_FTP_CMD, bytes.NewReader(opts.MarkerContent), BLOCK_SIZE, marker, "", nil); err != nil {
+			ftp.cleanup(marker)
+			return
+		}
+	}
+	return nil
+}
+
+// verifyDelivery compares the size, and the checksum if required, of an uploaded file with the local one.
+func (ftp *FTP) verifyDelivery(localpath string, remotename string, size int64, verifyHash bool) error {
+	remoteSize, err := ftp.Size(remotename)
+	if err != nil {
+		return err
+	}
+	if int64(remoteSize) != size {
+		return fmt.Errorf("Size mismatch for %s: %d bytes on the server, %d locally", remotename, remoteSize, size)
+	}
+
+	if !verifyHash {
+		return nil
+	}
+	remoteSum, err := ftp.Hash(remotename)
+	if err != nil {
+		return err
+	}
+	_, localSum, err := ftp.fileChecksum(localpath)
+	if err != nil {
+		return err
+	}
+	if localSum != remoteSum {
+		return fmt.Errorf("Checksum mismatch for %s: %s on the server, %s locally", remotename, remoteSum, localSum)
+	}
+	return nil
+}
+
+// CollectOptions configures CollectFiles, the zero value uses the defaults.
+type CollectOptions struct {
+	MarkerSuffix string // suffix of the ready marker next to each file, default ".done"
+	NoMarker     bool   // collect every file, without waiting for a marker
+	Pattern      string // only collect the files whose name matches this path.Match pattern
+	ArchiveDir   string // move the collected files into this remote folder instead of deleting them
+	Keep         bool   // leave the collected files and markers on the server
+	VerifyHash   bool   // also compare the SHA-256 checksum via HASH, fails if the server lacks it
+}
+
+// CollectResult reports the outcome of collecting a single file.
+type CollectResult struct {
+	Remotepath string // the collected remote file
+	Localpath  string // where it has been stored
+	Size       int64  // bytes downloaded
+	Archived   string // the remote path it was moved to, if archived
+	Err        error  // nil if the file was collected
+}
+
+// CollectFiles is the mirror image of DeliverFile: it downloads the files of a remote drop
+// folder which are ready, that is accompanied by a marker file such as "name.done", verifies
+// them by size (and checksum if requested) and then deletes their markers and deletes them,
+// or moves them into the archive folder.
+// A file is downloaded under a temporary name and renamed locally once verified, so a failed
+// file never shows up in localDir and stays on the server for the next run.
+// A result is returned for every file taken into account; the error is only set if the
+// remote folder could not be listed. A listed name that would land outside localDir is
+// left on the server, its result holding ErrUnsafePath. opts may be nil.
+func (ftp *FTP) CollectFiles(remoteDir string, localDir string, opts *CollectOptions) (results []*CollectResult, err error) {
+	if opts == nil {
+		opts = &CollectOptions{}
+	}
+	markerSuffix := opts.MarkerSuffix
+	if markerSuffix == "" {
+		markerSuffix = ".done"
+	}
+
+	var entries []*Entry
+	if entries, err = ftp.List(remoteDir); err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		present[e.Name] = true
+	}
+
+	archiveDir := opts.ArchiveDir
+	if archiveDir != "" && !path.IsAbs(archiveDir) {
+		archiveDir = path.Join(remoteDir, archiveDir)
+	}
+
+	for _, e := range entries {
+		if e.Type != EntryTypeFile || (!opts.NoMarker && strings.HasSuffix(e.Name, markerSuffix)) {
+			continue
+		}
+		if opts.Pattern != "" {
+			if ok, _ := path.Match(opts.Pattern, e.Name); !ok {
+				continue
+			}
+		}
+		marker := ""
+		if !opts.NoMarker {
+			if !present[e.Name+markerSuffix] {
+				ftp.writeInfo("Not ready yet, no marker for:", e.Name)
+				continue
+			}
+			marker = path.Join(remoteDir, e.Name+markerSuffix)
+		}
+
+		r := &CollectResult{Remotepath: path.Join(remoteDir, e.Name)}
+		if !plainName(e.Name) {
+			r.Err = fmt.Errorf("%w: %q", ErrUnsafePath, e.Name)
+		} else if r.Localpath, r.Err = localPathIn(localDir, e.Name); r.Err == nil {
+			r.Size, r.Err = ftp.collectFile(r.Remotepath, r.Localpath, opts.VerifyHash)
+		}
+		if r.Err == nil && !opts.Keep {
+			r.Archived, r.Err = ftp.disposeCollected(r.Remotepath, marker, archiveDir)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// collectFile downloads and verifies a single file, it is renamed into place locally once verified.
+func (ftp *FTP) collectFile(remotepath string, localpath string, verifyHash bool) (size int64, err error) {
+	tempPath := localpath + ".part"
+	if err = ftp.DownloadFileWithOptions(remotepath, tempPath, nil); err != nil {
+		os.Remove(tempPath)
+		return
+	}
+	var fi os.FileInfo
+	if fi, err = os.Stat(tempPath); err != nil {
+		return
+	}
+	if err = ftp.verifyDelivery(tempPath, remotepath, fi.Size(), verifyHash); err != nil {
+		os.Remove(tempPath)
+		return
+	}
+	return fi.Size(), os.Rename(tempPath, localpath)
+}
+
+// disposeCollected deletes the marker of a collected file, then deletes the file or moves it
+// into the archive folder. The marker goes first: left behind, it would mark as ready a new
+// file uploaded under the same name before its upload completes.
+func (ftp *FTP) disposeCollected(remotepath string, marker string, archiveDir string) (archived string, err error) {
+	if marker != "" {
+		if _, err = ftp.Delete(marker); err != nil {
+			return "", err
+		}
+	}
+	if archiveDir == "" {
+		if _, err = ftp.Delete(remotepath); err != nil {
+			return
+		}
+	} else {
+		archived = path.Join(archiveDir, path.Base(remotepath))
+		if _, err = ftp.Rename(remotepath, archived); err != nil {
+			return "", err
+		}
+	}
+	return archived, nil
+}
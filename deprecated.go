@@ -0,0 +1,50 @@
+//go:build !ftp4go_nodeprecated
+
+package ftp4go
+
+import "os"
+
+// The deprecated APIs are kept until the next major version. Building with the
+// ftp4go_nodeprecated tag leaves them out, which lets users check that they migrated:
+//
+//	go build -tags ftp4go_nodeprecated ./...
+
+// DownloadFile downloads a file and stores it locally.
+// There are two modes:
+// - binary, 				useLineMode = false
+// - line by line (text), 	useLineMode = true
+//
+// If the download fails or is stopped, an *ErrPartialTransfer is returned telling how many bytes
+// were written and whether the partial local file was kept, see SetKeepPartialDownloads.
+//
+// Deprecated: use DownloadFileWithOptions, whose TransferMode also offers Auto.
+func (ftp *FTP) DownloadFile(remotename string, localpath string, useLineMode bool) (err error) {
+	return ftp.DownloadFileWithOptions(remotename, localpath, &TransferOptions{Mode: lineMode(useLineMode)})
+}
+
+// UploadFile uploads a file from a local path to the current folder (see Cwd too) on the FTP server.
+// A remotename needs to be specified.
+// There are two modes set via the useLineMode flag:
+// - binary, 				useLineMode = false
+// - line by line (text), 	useLineMode = true
+//
+// Deprecated: use UploadFileWithOptions, whose TransferMode also offers Auto.
+func (ftp *FTP) UploadFile(remotename string, localpath string, useLineMode bool, callback Callback) (err error) {
+	return ftp.UploadFileWithOptions(remotename, localpath, &TransferOptions{Mode: lineMode(useLineMode), Callback: callback})
+}
+
+// DownloadResumeFile downloads a file, resuming after the contents of the local file if it exists.
+// The line mode can not restart a transfer: it downloads the whole file when the local file is
+// missing or empty, and returns ErrRestartASCII leaving the local file as is otherwise.
+// A failed download is reported as *ErrPartialTransfer, see DownloadFileWithOptions.
+//
+// Deprecated: use DownloadFileWithOptions with the size of the local file as Offset.
+func (ftp *FTP) DownloadResumeFile(remotename string, localpath string, useLineMode bool) error {
+	var offset int64
+	if fi, err := os.Stat(localpath); err == nil {
+		offset = fi.Size()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return ftp.DownloadFileWithOptions(remotename, localpath, &TransferOptions{Mode: lineMode(useLineMode), Offset: offset})
+}
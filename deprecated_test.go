@@ -0,0 +1,50 @@
+//go:build !ftp4go_nodeprecated
+
+package ftp4go
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeprecatedShims(t *testing.T) {
+	s := newTestServer(t)
+	s.putFile("/a.txt", []byte("line 1\r\nline 2\r\n"))
+	ftp := s.dial()
+	defer ftp.Quit()
+
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err := ftp.DownloadFile("/a.txt", local, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ftp.UploadFile("/b.txt", local, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := s.file("/b.txt"); string(b) != "line 1\r\nline 2\r\n" {
+		t.Errorf("Unexpected upload through UploadFile: %q", b)
+	}
+
+	os.WriteFile(local, []byte("line 1\r\n"), 0644)
+	if err := ftp.DownloadResumeFile("/a.txt", local, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(local); string(b) != "line 1\r\nline 2\r\n" {
+		t.Errorf("Unexpected resumed download: %q", b)
+	}
+
+	// the line mode downloads the whole file, and only into an empty one
+	if err := ftp.DownloadResumeFile("/a.txt", local, true); err != ErrRestartASCII {
+		t.Errorf("Expected ErrRestartASCII, got %v", err)
+	}
+	if b, _ := os.ReadFile(local); string(b) != "line 1\r\nline 2\r\n" {
+		t.Errorf("The local file changed: %q", b)
+	}
+	os.Remove(local)
+	if err := ftp.DownloadResumeFile("/a.txt", local, true); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(local); string(b) != "line 1\nline 2\n" {
+		t.Errorf("Unexpected download in line mode: %q", b)
+	}
+}
@@ -0,0 +1,86 @@
+package ftp4go
+
+import (
+	"context"
+	"net"
+
+	"github.com/shenshouer/ftp4go/internal/socks5"
+)
+
+// SetDialer sets the function opening the control connection of Connect and the data
+// connections, such as net.Dialer.DialContext, instead of the timeout and proxy settings, e.g. to open the data connections
+// through the tunnel of a connection handed to ConnectConn. nil restores the default.
+func (ftp *FTP) SetDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) {
+	ftp.dialFunc = dial
+}
+
+// dial connects to addr with the SetDialer function if any, else directly when a timeout
+// is set and through the proxy dialer otherwise, giving up as soon as ctx is done.
+func (ftp *FTP) dial(ctx context.Context, addr string) (net.Conn, error) {
+	if ftp.dialFunc != nil {
+		return ftp.dialFunc(ctx, "tcp", addr)
+	}
+	if ftp.timeoutInMsec > 0 {
+		d := net.Dialer{Timeout: ftp.timeoutInMsec}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	d := ftp.dialer
+	if d == nil {
+		d = socks5.Direct
+	}
+	return dialContext(ctx, d, "tcp", addr)
+}
+
+// dialContext dials with d, which honours ctx during the resolution and the proxy handshake
+// when it implements socks5.ContextDialer. A plain socks5.Dialer cannot be interrupted, the dial
+// then runs in its own goroutine which closes the connection if it completes after ctx is done.
+func dialContext(ctx context.Context, d socks5.Dialer, network, addr string) (net.Conn, error) {
+	if cd, ok := d.(socks5.ContextDialer); ok {
+		return cd.DialContext(ctx, network, addr)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := d.Dial(network, addr)
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// watchContext calls interrupt when ctx is done before the returned stop function is
+// called, which closes the connection to interrupt a pending read such as the one of the greeting.
+func watchContext(ctx context.Context, interrupt func()) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			interrupt()
+		case <-stopped:
+		}
+	}()
+	return func() {
+		close(stopped)
+		<-finished
+	}
+}
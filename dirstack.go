@@ -0,0 +1,57 @@
+package ftp4go
+
+import "errors"
+
+// ErrDirStackEmpty is returned by PopD without a matching PushD.
+var ErrDirStackEmpty = errors.New("Directory stack empty")
+
+// PushD changes the working directory to dir like Cwd, saving the current one on a
+// client side stack for PopD, like the shell builtin. An empty dir saves the current
+// directory without changing it. Nothing is saved if the change fails.
+// The stack is cleared by Connect, a new session starts in the home directory.
+func (ftp *FTP) PushD(dir string) error {
+	pwd, err := ftp.Pwd()
+	if err != nil {
+		return err
+	}
+	if dir != "" {
+		if _, err = ftp.Cwd(dir); err != nil {
+			return err
+		}
+	}
+	ftp.dirStack = append(ftp.dirStack, pwd)
+	return nil
+}
+
+// PopD changes back to the directory saved by the last PushD and removes it from the
+// stack, even if the change fails.
+func (ftp *FTP) PopD() error {
+	n := len(ftp.dirStack)
+	if n == 0 {
+		return ErrDirStackEmpty
+	}
+	dir := ftp.dirStack[n-1]
+	ftp.dirStack = ftp.dirStack[:n-1]
+	_, err := ftp.Cwd(dir)
+	return err
+}
+
+// InDir runs fn in the directory dir and changes back to the current directory
+// afterwards, whether fn succeeds or not. The error of fn takes precedence over
+// that of changing back.
+func (ftp *FTP) InDir(dir string, fn func() error) (err error) {
+	if err = ftp.PushD(dir); err != nil {
+		return err
+	}
+	defer func() {
+		if err1 := ftp.PopD(); err == nil {
+			err = err1
+		}
+	}()
+	return fn()
+}
+
+// DirStack returns the directories saved by PushD, the most recent last.
+func (ftp *FTP) DirStack() []string {
+	return append([]string(nil), ftp.dirStack...)
+}
@@ -0,0 +1,61 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInsufficientSpace is returned when a download would not fit on the local file system.
+var ErrInsufficientSpace = errors.New("Insufficient local disk space")
+
+// CheckLocalSpace fails with an error wrapping ErrInsufficientSpace if fewer than need bytes
+// are available in the local folder dir. It always succeeds on the platforms where the
+// available space can not be determined.
+func CheckLocalSpace(dir string, need int64) error {
+	avail, ok, err := freeSpace(dir)
+	if err != nil {
+		return err
+	}
+	if ok && avail < need {
+		return fmt.Errorf("%w: %d bytes needed in %s, %d available", ErrInsufficientSpace, need, dir, avail)
+	}
+	return nil
+}
+
+// Avbl returns the bytes the user can still store in the remote folder dir, the current one
+// if empty, by using the AVBL command of the streamlined FTP extensions draft.
+func (ftp *FTP) Avbl(dir string) (int64, error) {
+	var params []string
+	if dir != "" {
+		params = append(params, dir)
+	}
+	response, err := ftp.SendAndRead(AVBL_FTP_CMD, params...)
+	if err != nil {
+		return 0, ftp.unavailable(err, "AVBL", "Querying the available space", "")
+	}
+	if response.Code != StatusFile {
+		return 0, ftp.quirk("AVBL answered with %d instead of 213", response.Code)
+	}
+	avail, err := strconv.ParseInt(strings.TrimSpace(response.Message), 10, 64)
+	if err != nil {
+		return 0, NewErrProto(fmt.Errorf("Invalid AVBL reply: %s", response.Message))
+	}
+	return avail, nil
+}
+
+// DuRemote returns the total size in bytes of the files below the remote folder root,
+// an absolute path, for instance to check the local space before DownloadDirTree.
+func (ftp *FTP) DuRemote(root string) (total int64, err error) {
+	err = ftp.WalkRemote(root, func(remotepath string, e *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.Type == EntryTypeFile {
+			total += e.Size
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package ftp4go
+
+// freeSpace is not supported on this platform, the space checks are skipped.
+func freeSpace(dir string) (avail int64, ok bool, err error) {
+	return 0, false, nil
+}
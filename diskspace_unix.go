@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package ftp4go
+
+import "syscall"
+
+// freeSpace returns the bytes available to the user on the file system of dir.
+func freeSpace(dir string) (avail int64, ok bool, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(dir, &st); err != nil {
+		return 0, false, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), true, nil
+}
@@ -0,0 +1,138 @@
+package ftp4go
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// NameEncoding converts the file names exchanged with a server which does not use UTF-8,
+// see SetNameEncoding. Decode converts the bytes received from the server to UTF-8,
+// Encode converts UTF-8 back to the bytes of the server. The Decoder and Encoder of
+// golang.org/x/text/encoding provide both through their Bytes method.
+type NameEncoding interface {
+	Decode(b []byte) ([]byte, error)
+	Encode(b []byte) ([]byte, error)
+}
+
+// Latin1 is the ISO-8859-1 NameEncoding, each byte being the code point of a character.
+var Latin1 NameEncoding = latin1{}
+
+type latin1 struct{}
+
+func (latin1) Decode(b []byte) ([]byte, error) {
+	s := make([]byte, 0, len(b))
+	for _, c := range b {
+		s = utf8.AppendRune(s, rune(c))
+	}
+	return s, nil
+}
+
+func (latin1) Encode(b []byte) ([]byte, error) {
+	s := make([]byte, 0, len(b))
+	for _, r := range string(b) {
+		if r > 0xff {
+			return nil, fmt.Errorf("%q has no ISO-8859-1 encoding", r)
+		}
+		s = append(s, byte(r))
+	}
+	return s, nil
+}
+
+// SetNameEncoding sets the encoding of the file names on the server, nil for none, the
+// default, which passes the bytes through unchanged. The command lines sent are encoded,
+// the replies and the lines of the NLST, LIST and MLSD listings are decoded, so that the
+// names listed can be passed back to RETR and the like as they are.
+func (ftp *FTP) SetNameEncoding(enc NameEncoding) {
+	ftp.encoding = enc
+}
+
+// encodeLine encodes a command line for the server.
+func (ftp *FTP) encodeLine(line string) (string, error) {
+	if ftp.encoding == nil {
+		return line, nil
+	}
+	b, err := ftp.encoding.Encode([]byte(line))
+	if err != nil {
+		return "", fmt.Errorf("Cannot encode the command for the server: %w", err)
+	}
+	return string(b), nil
+}
+
+// decode decodes bytes received from the server, which are kept as they are if they
+// cannot be decoded.
+func (ftp *FTP) decode(b []byte) []byte {
+	if ftp.encoding == nil {
+		return b
+	}
+	d, err := ftp.encoding.Decode(b)
+	if err != nil {
+		ftp.writeInfo("Cannot decode", fmt.Sprintf("%q:", b), err)
+		return b
+	}
+	return d
+}
+
+// isListing reports whether the data of cmd are file names.
+func isListing(cmd FtpCmd) bool {
+	return cmd == NLST_FTP_CMD || cmd == LIST_FTP_CMD || cmd == MLSD_FTP_CMD
+}
+
+// EncodingProbe is the multi-byte part of the name uploaded by VerifyEncoding: accented Latin,
+// Greek, Cyrillic and Japanese characters.
+const EncodingProbe = "Grüße-αβγ-жук-日本語"
+
+// EncodingCheck is the outcome of VerifyEncoding.
+type EncodingCheck struct {
+	Name   string // the name uploaded
+	Listed string // the name NLST listed back for it, empty if not found
+	Intact bool   // the name round-tripped unchanged
+	UTF8   bool   // the server accepted OPTS UTF8 ON, see SetAutoUTF8
+}
+
+// VerifyEncoding diagnoses the handling of non-ASCII names by the server: it uploads an
+// empty file with a multi-byte name, see EncodingProbe, into the remote folder dir, lists
+// the folder with NLST and reports whether the name came back intact, then deletes the
+// file. A name mangled on the way, because the server or the NameEncoding set does not
+// use UTF-8, shows up as a different Listed name, or none at all. The error is set if a
+// step failed, the upload of the name included, e.g. if the NameEncoding cannot encode it.
+func (ftp *FTP) VerifyEncoding(dir string) (check *EncodingCheck, err error) {
+	b := make([]byte, 4)
+	if _, err = rand.Read(b); err != nil {
+		return nil, err
+	}
+	marker := "ftp4go-" + hex.EncodeToString(b)
+	check = &EncodingCheck{Name: marker + "-" + EncodingProbe + ".txt", UTF8: ftp.utf8}
+	remotePath := path.Join(dir, check.Name)
+	if err = ftp.StoreBytes(STORE_FTP_CMD, bytes.NewReader(nil), BLOCK_SIZE, remotePath, "", nil); err != nil {
+		return check, fmt.Errorf("Cannot upload %q: %w", check.Name, err)
+	}
+	names, err := ftp.Nlst(dir)
+	for _, name := range names {
+		if name = path.Base(name); strings.HasPrefix(name, marker) {
+			check.Listed = name
+		}
+	}
+	check.Intact = check.Listed == check.Name
+
+	// the name to delete is the one the server knows
+	if _, err1 := ftp.Delete(remotePath); err1 != nil {
+		if check.Listed != "" && !check.Intact {
+			_, err1 = ftp.Delete(path.Join(dir, check.Listed))
+		}
+		if err1 != nil {
+			ftp.writeInfo("Unable to remove the encoding probe", remotePath, ":", err1)
+		}
+	}
+	if err != nil {
+		return check, err
+	}
+	if !check.Intact {
+		ftp.writeInfo(fmt.Sprintf("The name %q was listed back as %q", check.Name, check.Listed))
+	}
+	return check, nil
+}
@@ -0,0 +1,299 @@
+package ftp4go
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntryType is the type of a directory entry.
+type EntryType int
+
+const (
+	EntryTypeFile EntryType = iota
+	EntryTypeFolder
+	EntryTypeLink
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case EntryTypeFolder:
+		return "dir"
+	case EntryTypeLink:
+		return "link"
+	}
+	return "file"
+}
+
+// Entry describes a file, folder or link found in a directory listing.
+type Entry struct {
+	Name   string // file name, without the path
+	Target string // target of a symbolic link, empty otherwise
+	Type   EntryType
+	Size   int64     // size in bytes, 0 when the listing format does not carry it
+	Time   time.Time // last modification time, zero when not available
+	Perm   string    // permission string as listed by the server, if any
+	Raw    string    // the unparsed listing line
+}
+
+var (
+	// ErrIgnoredListLine is returned for listing lines carrying no entry, such as "total 12" or column headers.
+	ErrIgnoredListLine = errors.New("Listing line carries no entry")
+	// ErrUnsupportedListLine is returned for listing lines in an unknown format.
+	ErrUnsupportedListLine = errors.New("Unsupported listing line format")
+)
+
+// ParseListLine parses a single line of a LIST reply.
+// The Unix style listings (vsftpd, ProFTPD, FileZilla Server, Netware) as well as
+// the DOS style ones (IIS) and the MVS dataset and member listings are supported.
+// Times without a year are assumed to lie within the last year and are returned in UTC.
+func ParseListLine(line string) (*Entry, error) {
+	return parseListLine(line, time.Now().UTC())
+}
+
+// list line parsers, tried in order
+var listLineParsers = []func(line string, now time.Time) (*Entry, error){
+	parseUnixListLine,
+	parseDosListLine,
+	parseMvsListLine,
+}
+
+func parseListLine(line string, now time.Time) (*Entry, error) {
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 || (len(fields) == 2 && fields[0] == "total") {
+		return nil, ErrIgnoredListLine
+	}
+	for _, parse := range listLineParsers {
+		e, err := parse(line, now)
+		if err == errNoMatch {
+			continue
+		}
+		if e != nil {
+			e.Raw = line
+		}
+		return e, err
+	}
+	return nil, ErrUnsupportedListLine
+}
+
+// errNoMatch tells parseListLine to try the next parser.
+var errNoMatch = errors.New("no match")
+
+type listField struct {
+	text string
+	end  int
+}
+
+// listFields splits s like strings.Fields keeping the end offset of each field,
+// so that the remainder of a line (a name containing spaces) can be recovered.
+func listFields(s string) []listField {
+	fields := make([]listField, 0, 10)
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || isASCIISpace(s[i]) {
+			if start >= 0 {
+				fields = append(fields, listField{s[start:i], i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return fields
+}
+
+// rest returns the part of line after the given field with the separating blanks removed.
+func rest(line string, f listField) string {
+	return strings.TrimLeft(line[f.end:], " \t")
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// parseUnixListLine parses "ls -l" style lines, including the Netware variant
+// which lists a single type character followed by the rights in brackets:
+//
+//	-rw-r--r--   1 owner    group        1234 Jan  2 15:04 name
+//	d [RWCEAFMS] owner                    512 Apr 14  2011 name
+func parseUnixListLine(line string, now time.Time) (*Entry, error) {
+	fs := listFields(line)
+	if len(fs) < 6 {
+		return nil, errNoMatch
+	}
+
+	perm := fs[0].text
+	switch {
+	case len(perm) == 10 && strings.IndexByte("-dlbcps", perm[0]) >= 0:
+	case len(perm) == 1 && strings.IndexByte("-d", perm[0]) >= 0 && strings.HasPrefix(fs[1].text, "["):
+		perm = perm + " " + fs[1].text
+	default:
+		return nil, errNoMatch
+	}
+
+	// look for "size month day time-or-year", the owner and group columns vary
+	for i := 3; i+3 < len(fs) && i <= 6; i++ {
+		month, ok := months[strings.ToLower(fs[i].text)]
+		if !ok {
+			continue
+		}
+		size, err := strconv.ParseInt(fs[i-1].text, 10, 64)
+		if err != nil {
+			continue
+		}
+		t, err := parseUnixTime(month, fs[i+1].text, fs[i+2].text, now)
+		if err != nil {
+			return nil, err
+		}
+		e := &Entry{Name: rest(line, fs[i+2]), Size: size, Time: t, Perm: perm}
+		switch perm[0] {
+		case 'd':
+			e.Type = EntryTypeFolder
+		case 'l':
+			e.Type = EntryTypeLink
+			if i := strings.Index(e.Name, " -> "); i >= 0 {
+				e.Name, e.Target = e.Name[:i], e.Name[i+4:]
+			}
+		}
+		if e.Name == "" {
+			return nil, ErrUnsupportedListLine
+		}
+		return e, nil
+	}
+	return nil, ErrUnsupportedListLine
+}
+
+// parseUnixTime parses the "Jan  2 15:04" and "Jan  2  2006" date forms.
+// Dates without a year are placed within the year before now.
+func parseUnixTime(month time.Month, day string, yearOrTime string, now time.Time) (time.Time, error) {
+	d, err := strconv.Atoi(day)
+	if err != nil || d < 1 || d > 31 {
+		return time.Time{}, ErrUnsupportedListLine
+	}
+	if i := strings.IndexByte(yearOrTime, ':'); i > 0 {
+		h, err1 := strconv.Atoi(yearOrTime[:i])
+		m, err2 := strconv.Atoi(yearOrTime[i+1:])
+		if err1 != nil || err2 != nil {
+			return time.Time{}, ErrUnsupportedListLine
+		}
+		t := time.Date(now.Year(), month, d, h, m, 0, 0, time.UTC)
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, nil
+	}
+	y, err := strconv.Atoi(yearOrTime)
+	if err != nil {
+		return time.Time{}, ErrUnsupportedListLine
+	}
+	return time.Date(y, month, d, 0, 0, 0, 0, time.UTC), nil
+}
+
+var dosTimeLayouts = []string{"01-02-06 03:04PM", "01-02-2006 03:04PM", "01-02-06 15:04", "01-02-2006 15:04"}
+
+// parseDosListLine parses the DOS style lines sent by IIS:
+//
+//	01-16-02  11:14AM       <DIR>          epsgroup
+//	06-05-02  03:19PM                 1419 readme.txt
+func parseDosListLine(line string, now time.Time) (*Entry, error) {
+	fs := listFields(line)
+	if len(fs) < 4 || strings.Count(fs[0].text, "-") != 2 || strings.IndexByte(fs[1].text, ':') < 0 {
+		return nil, errNoMatch
+	}
+
+	var t time.Time
+	var err error
+	for _, layout := range dosTimeLayouts {
+		if t, err = time.Parse(layout, fs[0].text+" "+strings.ToUpper(fs[1].text)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, ErrUnsupportedListLine
+	}
+
+	e := &Entry{Name: rest(line, fs[2]), Time: t}
+	if fs[2].text == "<DIR>" {
+		e.Type = EntryTypeFolder
+	} else if e.Size, err = strconv.ParseInt(fs[2].text, 10, 64); err != nil {
+		return nil, ErrUnsupportedListLine
+	}
+	return e, nil
+}
+
+// parseMvsListLine parses MVS dataset and partitioned dataset member listings:
+//
+//	Volume Unit    Referred Ext Used Recfm Lrecl BlkSz Dsorg Dsname
+//	WYNAP1 3390   2012/02/17  1    1  FB      80  3120  PS  ACCOUNT.DATA
+//	Migrated                                                OLD.DATA
+//	Name     VV.MM   Created       Changed      Size  Init   Mod   Id
+//	MEMBER1   01.01 2002/09/12 2002/09/12 11:28    20    20     0 USER1
+func parseMvsListLine(line string, now time.Time) (*Entry, error) {
+	fs := strings.Fields(line)
+	switch {
+	case fs[0] == "Volume" && len(fs) > 1 && fs[1] == "Unit",
+		fs[0] == "Name" && len(fs) > 1 && fs[1] == "VV.MM":
+		return nil, ErrIgnoredListLine
+	case fs[0] == "Migrated" && len(fs) == 2:
+		return &Entry{Name: fs[1]}, nil
+	case len(fs) >= 10 && isMvsDate(fs[2]):
+		t, _ := time.Parse("2006/01/02", fs[2])
+		e := &Entry{Name: fs[len(fs)-1], Time: t}
+		if strings.HasPrefix(fs[len(fs)-2], "PO") {
+			e.Type = EntryTypeFolder
+		}
+		return e, nil
+	case len(fs) >= 5 && isMvsDate(fs[2]) && isMvsDate(fs[3]):
+		t, err := time.Parse("2006/01/02 15:04", fs[3]+" "+fs[4])
+		if err != nil {
+			return nil, ErrUnsupportedListLine
+		}
+		return &Entry{Name: fs[0], Time: t}, nil
+	}
+	return nil, errNoMatch
+}
+
+func isMvsDate(s string) bool {
+	_, err := time.Parse("2006/01/02", s)
+	return err == nil
+}
+
+// List returns the entries of a directory, by default the current, parsed from the LIST reply.
+// Lines in an unknown format are skipped and the "." and ".." entries are left out.
+func (ftp *FTP) List(params ...string) (entries []*Entry, err error) {
+	var lines []string
+	if lines, err = ftp.Dir(params...); err != nil {
+		return nil, err
+	}
+	entries = make([]*Entry, 0, len(lines))
+	for _, l := range lines {
+		if e := ftp.listEntry(l); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// listEntry parses a listing line, nil for the lines skipped by List.
+func (ftp *FTP) listEntry(l string) *Entry {
+	// the times are the server's local ones, see SetServerTimezone
+	e, err := parseListLine(l, time.Now().UTC().Add(ftp.tzOffset))
+	if err != nil {
+		if err != ErrIgnoredListLine {
+			ftp.writeInfo("Skipping listing line:", l, "error:", err)
+		}
+		return nil
+	}
+	if n := path.Base(e.Name); n == "." || n == ".." {
+		return nil
+	}
+	if !e.Time.IsZero() {
+		e.Time = e.Time.Add(-ftp.tzOffset)
+	}
+	return e
+}
@@ -0,0 +1,76 @@
+package ftp4go
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// listGoldenNow is the reference time used to place dates without a year.
+var listGoldenNow = time.Date(2012, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+// formatEntry renders an entry, or the parse error, as one golden file line.
+func formatEntry(e *Entry, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	s := fmt.Sprintf("%s\t%d\t%s\t%q", e.Type, e.Size, e.Time.Format(time.RFC3339), e.Name)
+	if e.Target != "" {
+		s += fmt.Sprintf(" -> %q", e.Target)
+	}
+	return s
+}
+
+// TestListGolden parses the real server listings in testdata/list/*.txt and compares
+// the result with the matching .golden file; run with -update to regenerate them.
+func TestListGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "list", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No listing fixtures found, error: %v", err)
+	}
+
+	for _, fn := range files {
+		f, err := os.Open(fn)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		var out strings.Builder
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			out.WriteString(formatEntry(parseListLine(sc.Text(), listGoldenNow)))
+			out.WriteString("\n")
+		}
+		f.Close()
+
+		golden := strings.TrimSuffix(fn, ".txt") + ".golden"
+		if *updateGolden {
+			if err = os.WriteFile(golden, []byte(out.String()), 0644); err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("Missing golden file %s, run the test with -update, error: %v", golden, err)
+		}
+		if got := out.String(); got != string(want) {
+			t.Errorf("Parsing %s differs from %s\n--- got:\n%s--- want:\n%s", fn, golden, got, want)
+		}
+	}
+}
+
+func TestParseListLineUnsupported(t *testing.T) {
+	if _, err := ParseListLine("this is not a listing line"); err != ErrUnsupportedListLine {
+		t.Errorf("Expected ErrUnsupportedListLine, got: %v", err)
+	}
+	if _, err := ParseListLine("total 0"); err != ErrIgnoredListLine {
+		t.Errorf("Expected ErrIgnoredListLine, got: %v", err)
+	}
+}
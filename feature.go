@@ -0,0 +1,46 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFeatureUnavailable is returned by an operation needing a server feature which is missing,
+// e.g. a restarted transfer without REST STREAM or a checksum without HASH, rather than the
+// bare refusal of the command. It matches errors.ErrUnsupported.
+type ErrFeatureUnavailable struct {
+	Feature   string // the missing feature, as listed by FEAT, e.g. "REST STREAM"
+	Operation string // the operation which needed it, e.g. "restarting a transfer"
+	Fallback  string // how the operation can be carried out without it, empty if it cannot
+	Err       error  // the refusal of the server, nil if the feature is not advertised
+}
+
+func (e *ErrFeatureUnavailable) Error() string {
+	msg := fmt.Sprintf("%s needs %s, which the server does not provide", e.Operation, e.Feature)
+	if e.Fallback != "" {
+		msg += ", fallback: " + e.Fallback
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ErrFeatureUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, errors.ErrUnsupported) hold.
+func (e *ErrFeatureUnavailable) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// unavailable returns err as *ErrFeatureUnavailable if it is the reply refusing the command
+// as unknown or not implemented.
+func (ftp *FTP) unavailable(err error, feature string, operation string, fallback string) error {
+	switch replyCode(err) {
+	case StatusBadCommand, StatusNotImplemented, StatusNotImplementedParameter:
+		return &ErrFeatureUnavailable{Feature: feature, Operation: operation, Fallback: fallback, Err: err}
+	}
+	return err
+}
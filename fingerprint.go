@@ -0,0 +1,67 @@
+package ftp4go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FingerprintOptions configures FingerprintRemoteWithOptions.
+type FingerprintOptions struct {
+	Checksums bool // also hash the SHA-256 checksum of every file, fails if the server lacks HASH
+}
+
+// FingerprintRemote returns a digest of the remote tree rooted at root, an absolute path,
+// computed from the sorted paths, sizes and modification times of its files and folders.
+// Comparing the digests of two runs tells cheaply whether anything changed below root.
+//
+// The times come from the listings, which some servers only give to the minute,
+// so a file rewritten with the same size within the same minute can go unnoticed.
+func (ftp *FTP) FingerprintRemote(root string) (string, error) {
+	return ftp.FingerprintRemoteWithOptions(root, nil)
+}
+
+// FingerprintRemoteWithOptions is FingerprintRemote configured by opts, which may be nil.
+func (ftp *FTP) FingerprintRemoteWithOptions(root string, opts *FingerprintOptions) (string, error) {
+	if opts == nil {
+		opts = &FingerprintOptions{}
+	}
+
+	var lines []string
+	err := ftp.WalkRemote(root, func(remotepath string, e *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(remotepath, root), "/")
+		switch e.Type {
+		case EntryTypeFolder:
+			lines = append(lines, fmt.Sprintf("d %s", rel))
+		case EntryTypeLink:
+			lines = append(lines, fmt.Sprintf("l %s -> %s", rel, e.Target))
+		default:
+			line := fmt.Sprintf("f %s %d %s", rel, e.Size, e.Time.UTC().Format(time.RFC3339))
+			if opts.Checksums {
+				sum, err := ftp.Hash(remotepath)
+				if err != nil {
+					return err
+				}
+				line += " " + sum
+			}
+			lines = append(lines, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		fmt.Fprintln(h, line)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,238 @@
+package ftp4go
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FS exposes the usual file system method names of SFTP style clients over an FTP session,
+// to ease porting code between both protocols. Paths are best given absolute.
+//
+// The session only has one data connection at a time: a File returned by Open or Create
+// needs closing before any other call is made on the FS or the underlying FTP.
+type FS struct {
+	ftp *FTP
+}
+
+// NewFS returns an FS working over a connected and logged in FTP session.
+func NewFS(ftp *FTP) *FS {
+	return &FS{ftp}
+}
+
+// FTP returns the underlying session.
+func (fs *FS) FTP() *FTP {
+	return fs.ftp
+}
+
+// ReadDir returns the entries of a folder, "." and ".." excluded.
+func (fs *FS) ReadDir(p string) ([]os.FileInfo, error) {
+	entries, err := fs.ftp.List(p)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, len(entries))
+	for i, e := range entries {
+		infos[i] = &fileInfo{e}
+	}
+	return infos, nil
+}
+
+// Stat returns the entry of a file or folder, found by listing its parent folder.
+// An error satisfying os.IsNotExist is returned if it is not there.
+func (fs *FS) Stat(p string) (os.FileInfo, error) {
+	p = path.Clean(p)
+	if p == "/" || p == "." {
+		return &fileInfo{&Entry{Name: p, Type: EntryTypeFolder}}, nil
+	}
+	entries, err := fs.ftp.List(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	fold, err := fs.ftp.foldsCase()
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(p)
+	var folded *Entry
+	for _, e := range entries {
+		if e.Name == name {
+			return &fileInfo{e}, nil
+		}
+		if fold && folded == nil && strings.EqualFold(e.Name, name) {
+			folded = e
+		}
+	}
+	if folded != nil {
+		return &fileInfo{folded}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+}
+
+// Lstat is Stat, listings describe links rather than their targets already.
+func (fs *FS) Lstat(p string) (os.FileInfo, error) {
+	return fs.Stat(p)
+}
+
+// Remove removes a file or an empty folder.
+func (fs *FS) Remove(p string) error {
+	_, err := fs.ftp.Delete(p)
+	if err == nil {
+		return nil
+	}
+	if _, err1 := fs.ftp.Rmd(p); err1 == nil {
+		return nil
+	}
+	return err
+}
+
+// RemoveDirectory removes an empty folder.
+func (fs *FS) RemoveDirectory(p string) error {
+	_, err := fs.ftp.Rmd(p)
+	return err
+}
+
+// Rename renames or moves a file or folder.
+func (fs *FS) Rename(oldname string, newname string) error {
+	_, err := fs.ftp.Rename(oldname, newname)
+	return err
+}
+
+// Mkdir creates a folder, its parent must exist.
+func (fs *FS) Mkdir(p string) error {
+	_, err := fs.ftp.Mkd(p)
+	return err
+}
+
+// Getwd returns the current working folder.
+func (fs *FS) Getwd() (string, error) {
+	return fs.ftp.Pwd()
+}
+
+// Open opens a remote file for reading, its content is streamed over the data connection.
+func (fs *FS) Open(p string) (*File, error) {
+	return fs.open(p, RETR_FTP_CMD, 0)
+}
+
+// OpenAt opens a remote file for reading from offset on, the server needs to support REST.
+func (fs *FS) OpenAt(p string, offset int64) (*File, error) {
+	return fs.open(p, RETR_FTP_CMD, offset)
+}
+
+// Create creates or truncates a remote file for writing, the content is streamed over the data connection.
+func (fs *FS) Create(p string) (*File, error) {
+	return fs.open(p, STORE_FTP_CMD, 0)
+}
+
+func (fs *FS) open(p string, cmd FtpCmd, offset int64) (*File, error) {
+	if _, err := fs.ftp.SendAndRead(TYPE_I_FTP_CMD); err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := fs.ftp.SendAndRead(REST_FTP_CMD, strconv.FormatInt(offset, 10)); err != nil {
+			return nil, err
+		}
+	}
+	conn, _, err := fs.ftp.transferCmd(cmd, p)
+	if err != nil {
+		return nil, err
+	}
+	return &File{ftp: fs.ftp, name: p, cmd: cmd, conn: conn}, nil
+}
+
+// ErrFileClosed is returned when using a File after Close.
+var ErrFileClosed = errors.New("File already closed")
+
+// File is a remote file opened by FS.Open, for reading, or FS.Create, for writing.
+type File struct {
+	ftp  *FTP
+	name string
+	cmd  FtpCmd
+	conn net.Conn
+}
+
+// Name returns the path the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Read reads from a file opened by Open.
+func (f *File) Read(p []byte) (int, error) {
+	if f.conn == nil {
+		return 0, ErrFileClosed
+	}
+	if f.cmd != RETR_FTP_CMD {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrInvalid}
+	}
+	return f.conn.Read(p)
+}
+
+// Write writes to a file opened by Create.
+func (f *File) Write(p []byte) (int, error) {
+	if f.conn == nil {
+		return 0, ErrFileClosed
+	}
+	if f.cmd != STORE_FTP_CMD {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrInvalid}
+	}
+	return f.conn.Write(p)
+}
+
+// ReadFrom copies r into a file opened by Create.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{f}, r)
+}
+
+// Close closes the data connection and reads the final reply of the transfer,
+// the error reports a failed upload. Closing a file before reading it to the
+// end aborts the download.
+func (f *File) Close() error {
+	if f.conn == nil {
+		return ErrFileClosed
+	}
+	f.conn.Close()
+	f.conn = nil
+	// an aborted download is answered with 426 or 226, both end the transfer
+	f.ftp.timeouts.untimed = true
+	_, err := f.ftp.Read(f.cmd)
+	f.ftp.stats.transfer(err)
+	f.ftp.logTransfer(f.ftp.stats.end(err))
+	return err
+}
+
+// fileInfo adapts an Entry to os.FileInfo.
+type fileInfo struct {
+	e *Entry
+}
+
+func (fi *fileInfo) Name() string       { return fi.e.Name }
+func (fi *fileInfo) Size() int64        { return fi.e.Size }
+func (fi *fileInfo) ModTime() time.Time { return fi.e.Time }
+func (fi *fileInfo) IsDir() bool        { return fi.e.Type == EntryTypeFolder }
+
+// Sys returns the underlying *Entry.
+func (fi *fileInfo) Sys() interface{} { return fi.e }
+
+// Mode returns the type bits and, for Unix style listings, the permission bits.
+func (fi *fileInfo) Mode() os.FileMode {
+	var m os.FileMode
+	if perm := fi.e.Perm; len(perm) == 10 {
+		for i, c := range perm[1:] {
+			if c != '-' {
+				m |= 1 << uint(8-i)
+			}
+		}
+	}
+	switch fi.e.Type {
+	case EntryTypeFolder:
+		m |= os.ModeDir
+	case EntryTypeLink:
+		m |= os.ModeSymlink
+	}
+	return m
+}
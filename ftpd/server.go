@@ -0,0 +1,714 @@
+// Package ftpd is a small read-only FTP server serving an fs.FS, for demos, fixture servers
+// and contract tests of clients. It implements the commands a client needs to browse and
+// download: passive data connections (PASV and EPSV), LIST, NLST, MLSD, MLST, RETR with REST,
+// SIZE and MDTM, and explicit FTPS (AUTH TLS, PBSZ and PROT) when configured with a
+// certificate. Every command changing the files is refused.
+package ftpd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+	"github.com/shenshouer/ftp4go/replyparse"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close.
+var ErrServerClosed = errors.New("ftpd: Server closed")
+
+const (
+	// DefaultIdleTimeout is the time a session may stay silent before it is closed.
+	DefaultIdleTimeout = 5 * time.Minute
+	// dataTimeout bounds the wait for the client to open a data connection.
+	dataTimeout = 30 * time.Second
+	// statusProtRequired refuses a data connection for its protection level (RFC 4217).
+	statusProtRequired = 521
+)
+
+// Server serves the files of FS read-only. The zero value with FS set is ready to use.
+type Server struct {
+	FS fs.FS
+
+	// Auth checks the credentials of a user, nil accepts any, anonymous included.
+	Auth func(user string, password string) bool
+	// TLSConfig enables explicit FTPS with AUTH TLS, it holds the server certificate.
+	TLSConfig *tls.Config
+	// RequireTLS refuses to log users in before AUTH TLS, and the transfers before PROT P.
+	RequireTLS bool
+	// PassiveIP is the IPv4 address announced by PASV, by default the one the client connected to.
+	PassiveIP string
+	// IdleTimeout closes the sessions silent for longer, 0 for DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// Welcome is the text of the greeting.
+	Welcome string
+	// ErrorLog logs the failures to accept connections and the refused data connections,
+	// nil for the log package's standard logger.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	sessions  map[*session]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// ListenAndServe listens on the TCP address addr, e.g. ":2121", and serves the connections.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves the connections accepted on ln until Close, it always returns a non-nil error.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.sessions = make(map[*session]struct{})
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			s.logf("ftpd: accept error: %v", err)
+			return err
+		}
+		c := &session{s: s, conn: conn, tp: textproto.NewConn(conn), cwd: "/"}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.sessions[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			c.run()
+			s.mu.Lock()
+			delete(s.sessions, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops the listeners and closes the sessions, then waits for their goroutines to end.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for c := range s.sessions {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// session is a control connection.
+type session struct {
+	s        *Server
+	conn     net.Conn
+	tp       *textproto.Conn
+	user     string
+	loggedIn bool
+	secured  bool // AUTH TLS done
+	prot     bool // PROT P, the data connections are wrapped in TLS
+	cwd      string
+	pasv     net.Listener
+	offset   int64
+}
+
+func (c *session) reply(code int, format string, args ...interface{}) {
+	c.tp.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+// multiline sends a multiline reply, each line of lines being indented by a space.
+func (c *session) multiline(code int, first string, lines []string, last string) {
+	c.tp.W.WriteString(fmt.Sprintf("%d-%s\r\n", code, first))
+	for _, l := range lines {
+		c.tp.W.WriteString(" " + l + "\r\n")
+	}
+	c.tp.W.WriteString(fmt.Sprintf("%d %s\r\n", code, last))
+	c.tp.W.Flush()
+}
+
+func (c *session) run() {
+	defer c.conn.Close()
+	defer c.closePasv()
+	welcome := c.s.Welcome
+	if welcome == "" {
+		welcome = "ftp4go ftpd ready"
+	}
+	c.reply(ftp4go.StatusReady, "%s", welcome)
+	idle := c.s.IdleTimeout
+	if idle <= 0 {
+		idle = DefaultIdleTimeout
+	}
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idle))
+		line, err := c.tp.ReadLine()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				c.reply(ftp4go.StatusNotAvailable, "Idle timeout, closing the session")
+			}
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		cmd, ok := commands[verb]
+		switch {
+		case !ok:
+			c.reply(ftp4go.StatusNotImplemented, "%s not implemented", verb)
+		case cmd.write:
+			c.reply(ftp4go.StatusFileUnavailable, "%s refused, the server is read-only", verb)
+		case cmd.login && !c.loggedIn:
+			c.reply(ftp4go.StatusNotLoggedIn, "Please log in with USER and PASS")
+		default:
+			cmd.fn(c, arg)
+		}
+		if verb == "QUIT" {
+			return
+		}
+	}
+}
+
+type command struct {
+	fn    func(c *session, arg string)
+	login bool // needs a logged in user
+	write bool // changes the files, always refused
+}
+
+var commands map[string]command
+
+func init() {
+	refused := command{write: true}
+	commands = map[string]command{
+		"USER": {fn: (*session).handleUser},
+		"PASS": {fn: (*session).handlePass},
+		"REIN": {fn: (*session).handleRein},
+		"QUIT": {fn: func(c *session, arg string) { c.reply(ftp4go.StatusClosing, "Goodbye") }},
+		"NOOP": {fn: func(c *session, arg string) { c.reply(ftp4go.StatusCommandOK, "OK") }},
+		"SYST": {fn: func(c *session, arg string) { c.reply(ftp4go.StatusName, "UNIX Type: L8") }},
+		"FEAT": {fn: (*session).handleFeat},
+		"OPTS": {fn: (*session).handleOpts},
+		"AUTH": {fn: (*session).handleAuth},
+		"PBSZ": {fn: (*session).handlePbsz},
+		"PROT": {fn: (*session).handleProt},
+		"PWD":  {fn: (*session).handlePwd, login: true},
+		"XPWD": {fn: (*session).handlePwd, login: true},
+		"CWD":  {fn: (*session).handleCwd, login: true},
+		"CDUP": {fn: func(c *session, arg string) { c.handleCwd("..") }, login: true},
+		"TYPE": {fn: (*session).handleType, login: true},
+		"MODE": {fn: (*session).handleMode, login: true},
+		"STRU": {fn: (*session).handleStru, login: true},
+		"PASV": {fn: (*session).handlePasv, login: true},
+		"EPSV": {fn: (*session).handleEpsv, login: true},
+		"PORT": {fn: (*session).handleActive, login: true},
+		"EPRT": {fn: (*session).handleActive, login: true},
+		"REST": {fn: (*session).handleRest, login: true},
+		"RETR": {fn: (*session).handleRetr, login: true},
+		"LIST": {fn: (*session).handleList, login: true},
+		"NLST": {fn: (*session).handleNlst, login: true},
+		"MLSD": {fn: (*session).handleMlsd, login: true},
+		"MLST": {fn: (*session).handleMlst, login: true},
+		"SIZE": {fn: (*session).handleSize, login: true},
+		"MDTM": {fn: (*session).handleMdtm, login: true},
+		"ABOR": {fn: func(c *session, arg string) { c.reply(ftp4go.StatusClosingDataConnection, "No transfer to abort") }, login: true},
+		"STOR": refused, "STOU": refused, "APPE": refused, "ALLO": refused, "DELE": refused,
+		"MKD": refused, "XMKD": refused, "RMD": refused, "XRMD": refused,
+		"RNFR": refused, "RNTO": refused, "SITE": refused,
+	}
+}
+
+func (c *session) handleUser(arg string) {
+	if c.s.RequireTLS && !c.secured {
+		c.reply(ftp4go.StatusNotLoggedIn, "AUTH TLS is required first")
+		return
+	}
+	c.user, c.loggedIn = arg, false
+	c.reply(ftp4go.StatusUserOK, "Password required for %s", arg)
+}
+
+func (c *session) handlePass(arg string) {
+	if c.user == "" {
+		c.reply(ftp4go.StatusBadSequence, "Send USER first")
+		return
+	}
+	if c.s.Auth != nil && !c.s.Auth(c.user, arg) {
+		c.user = ""
+		c.reply(ftp4go.StatusNotLoggedIn, "Login incorrect")
+		return
+	}
+	c.loggedIn = true
+	c.reply(ftp4go.StatusLoggedIn, "Logged in")
+}
+
+func (c *session) handleRein(arg string) {
+	c.user, c.loggedIn, c.cwd, c.offset = "", false, "/", 0
+	c.closePasv()
+	c.reply(ftp4go.StatusReady, "Service ready for new user")
+}
+
+func (c *session) handleFeat(arg string) {
+	feats := []string{"EPSV", "MDTM", "MLST type*;size*;modify*;perm*;", "PASV", "REST STREAM", "SIZE", "UTF8"}
+	if c.s.TLSConfig != nil {
+		feats = append(feats, "AUTH TLS", "PBSZ", "PROT")
+	}
+	sort.Strings(feats)
+	c.multiline(ftp4go.StatusSystem, "Features:", feats, "End")
+}
+
+func (c *session) handleOpts(arg string) {
+	opt, _, _ := strings.Cut(strings.ToUpper(arg), " ")
+	switch opt {
+	case "UTF8", "MLST":
+		c.reply(ftp4go.StatusCommandOK, "OK")
+	default:
+		c.reply(ftp4go.StatusNotImplementedParameter, "OPTS %s not supported", arg)
+	}
+}
+
+func (c *session) handleAuth(arg string) {
+	if a := strings.ToUpper(arg); c.s.TLSConfig == nil || (a != "TLS" && a != "SSL") {
+		c.reply(ftp4go.StatusNotImplementedParameter, "AUTH %s not supported", arg)
+		return
+	}
+	if c.secured {
+		c.reply(ftp4go.StatusBadSequence, "TLS is active already")
+		return
+	}
+	c.reply(ftp4go.StatusSecurityDataExchanged, "Proceed with negotiation")
+	conn := tls.Server(c.conn, c.s.TLSConfig)
+	if err := conn.Handshake(); err != nil {
+		c.conn.Close()
+		return
+	}
+	c.s.mu.Lock() // Close reads c.conn
+	c.conn = conn
+	c.s.mu.Unlock()
+	c.tp, c.secured = textproto.NewConn(conn), true
+}
+
+func (c *session) handlePbsz(arg string) {
+	if !c.secured {
+		c.reply(ftp4go.StatusBadSequence, "PBSZ needs AUTH TLS first")
+		return
+	}
+	c.reply(ftp4go.StatusCommandOK, "PBSZ=0")
+}
+
+func (c *session) handleProt(arg string) {
+	if !c.secured {
+		c.reply(ftp4go.StatusBadSequence, "PROT needs AUTH TLS first")
+		return
+	}
+	switch strings.ToUpper(arg) {
+	case "C":
+		c.prot = false
+	case "P":
+		c.prot = true
+	default:
+		c.reply(ftp4go.StatusNotImplementedParameter, "PROT %s not supported", arg)
+		return
+	}
+	c.reply(ftp4go.StatusCommandOK, "Protection set to %s", strings.ToUpper(arg))
+}
+
+// abs returns the absolute virtual path of a name relative to the working directory.
+func (c *session) abs(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = path.Join(c.cwd, name)
+	}
+	return path.Clean("/" + name)
+}
+
+// stat returns the virtual path of name and its file info.
+func (c *session) stat(name string) (string, fs.FileInfo, error) {
+	p := c.abs(name)
+	fi, err := fs.Stat(c.s.FS, fsPath(p))
+	return p, fi, err
+}
+
+// fsPath converts an absolute virtual path to a path of the fs.FS.
+func fsPath(p string) string {
+	if p == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+func (c *session) handlePwd(arg string) {
+	c.reply(ftp4go.StatusPathCreated, "\"%s\" is the current directory", strings.ReplaceAll(c.cwd, "\"", "\"\""))
+}
+
+func (c *session) handleCwd(arg string) {
+	p, fi, err := c.stat(arg)
+	if err != nil || !fi.IsDir() {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such directory", arg)
+		return
+	}
+	c.cwd = p
+	c.reply(ftp4go.StatusRequestedFileActionOK, "Directory changed to %s", p)
+}
+
+func (c *session) handleType(arg string) {
+	switch strings.ToUpper(strings.TrimSpace(arg)) {
+	case "A", "A N", "I", "L 8":
+		c.reply(ftp4go.StatusCommandOK, "Type set to %s", arg)
+	default:
+		c.reply(ftp4go.StatusNotImplementedParameter, "TYPE %s not supported", arg)
+	}
+}
+
+func (c *session) handleMode(arg string) {
+	if strings.ToUpper(arg) != "S" {
+		c.reply(ftp4go.StatusNotImplementedParameter, "MODE %s not supported", arg)
+		return
+	}
+	c.reply(ftp4go.StatusCommandOK, "Mode set to S")
+}
+
+func (c *session) handleStru(arg string) {
+	if strings.ToUpper(arg) != "F" {
+		c.reply(ftp4go.StatusNotImplementedParameter, "STRU %s not supported", arg)
+		return
+	}
+	c.reply(ftp4go.StatusCommandOK, "Structure set to F")
+}
+
+func (c *session) handleActive(arg string) {
+	c.reply(ftp4go.StatusNotImplemented, "Active mode not supported, use PASV or EPSV")
+}
+
+// listenData opens the listener of a passive data connection on the address the client connected to.
+func (c *session) listenData() (net.Listener, error) {
+	c.closePasv()
+	host, _, err := net.SplitHostPort(c.conn.LocalAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+	c.pasv = ln
+	return ln, nil
+}
+
+func (c *session) closePasv() {
+	if c.pasv != nil {
+		c.pasv.Close()
+		c.pasv = nil
+	}
+}
+
+func (c *session) handlePasv(arg string) {
+	ln, err := c.listenData()
+	if err != nil {
+		c.reply(ftp4go.StatusCanNotOpenDataConnection, "Cannot open a passive connection")
+		return
+	}
+	ip := c.s.PassiveIP
+	if ip == "" {
+		ip, _, _ = net.SplitHostPort(ln.Addr().String())
+	}
+	addr, err := replyparse.FormatPasv(ip, ln.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		c.closePasv()
+		c.reply(ftp4go.StatusCanNotOpenDataConnection, "No IPv4 address for PASV, use EPSV")
+		return
+	}
+	c.reply(ftp4go.StatusPassiveMode, "Entering Passive Mode (%s)", addr)
+}
+
+func (c *session) handleEpsv(arg string) {
+	if strings.EqualFold(arg, "ALL") {
+		c.reply(ftp4go.StatusCommandOK, "EPSV ALL accepted")
+		return
+	}
+	ln, err := c.listenData()
+	if err != nil {
+		c.reply(ftp4go.StatusCanNotOpenDataConnection, "Cannot open a passive connection")
+		return
+	}
+	c.reply(ftp4go.StatusExtendedPassiveMode, "Entering Extended Passive Mode (|||%d|)", ln.Addr().(*net.TCPAddr).Port)
+}
+
+// openData accepts the passive data connection, wrapped in TLS after PROT P. The
+// connections from another address than the client's are refused, so that nobody
+// else can steal the data by connecting to the announced port first.
+func (c *session) openData() (net.Conn, error) {
+	if c.pasv == nil {
+		return nil, errors.New("no data connection negotiated")
+	}
+	defer c.closePasv()
+	c.pasv.(*net.TCPListener).SetDeadline(time.Now().Add(dataTimeout))
+	client := c.conn.RemoteAddr().(*net.TCPAddr).IP
+	var conn net.Conn
+	for {
+		var err error
+		if conn, err = c.pasv.Accept(); err != nil {
+			return nil, err
+		}
+		if ip := conn.RemoteAddr().(*net.TCPAddr).IP; !ip.Equal(client) {
+			c.s.logf("ftpd: data connection from %s refused, the client is %s", ip, client)
+			conn.Close()
+			continue
+		}
+		break
+	}
+	if c.prot {
+		conn = tls.Server(conn, c.s.TLSConfig)
+	}
+	return conn, nil
+}
+
+// transfer sends the data written by send over a new data connection.
+func (c *session) transfer(send func(w io.Writer) error) {
+	if c.pasv == nil {
+		c.reply(ftp4go.StatusCanNotOpenDataConnection, "Use PASV or EPSV first")
+		return
+	}
+	if c.s.RequireTLS && !c.prot {
+		c.closePasv()
+		c.reply(statusProtRequired, "Data connections must be protected, use PROT P")
+		return
+	}
+	c.reply(ftp4go.StatusAboutToSend, "Opening data connection")
+	conn, err := c.openData()
+	if err != nil {
+		c.reply(ftp4go.StatusCanNotOpenDataConnection, "Cannot open the data connection: %v", err)
+		return
+	}
+	err = send(conn)
+	if err1 := conn.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		c.reply(ftp4go.StatusTransfertAborted, "Transfer aborted: %v", err)
+		return
+	}
+	c.reply(ftp4go.StatusClosingDataConnection, "Transfer complete")
+}
+
+func (c *session) handleRest(arg string) {
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 {
+		c.reply(ftp4go.StatusBadArguments, "Invalid offset %s", arg)
+		return
+	}
+	c.offset = offset
+	c.reply(ftp4go.StatusRequestFilePending, "Restarting at %d", offset)
+}
+
+func (c *session) handleRetr(arg string) {
+	offset := c.offset
+	c.offset = 0
+	p, fi, err := c.stat(arg)
+	if err != nil || fi.IsDir() {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such file", arg)
+		return
+	}
+	f, err := c.s.FS.Open(fsPath(p))
+	if err != nil {
+		c.reply(ftp4go.ReplyCode(err), "%s: %v", arg, err)
+		return
+	}
+	defer f.Close()
+	if offset > 0 {
+		if seeker, ok := f.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, f, offset)
+		}
+		if err != nil {
+			c.reply(ftp4go.StatusFileUnavailable, "Cannot restart at %d: %v", offset, err)
+			return
+		}
+	}
+	c.transfer(func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
+
+// listArg returns the path of a LIST or NLST argument, without the options of ls such as "-la".
+func listArg(arg string) string {
+	fields := strings.Fields(arg)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
+
+// entries returns the file infos of a folder, or of the file itself, sorted by name.
+func (c *session) entries(name string) ([]fs.FileInfo, bool) {
+	p, fi, err := c.stat(name)
+	if err != nil {
+		return nil, false
+	}
+	if !fi.IsDir() {
+		return []fs.FileInfo{fi}, true
+	}
+	des, err := fs.ReadDir(c.s.FS, fsPath(p))
+	if err != nil {
+		return nil, false
+	}
+	infos := make([]fs.FileInfo, 0, len(des))
+	for _, de := range des {
+		if fi, err := de.Info(); err == nil {
+			infos = append(infos, fi)
+		}
+	}
+	return infos, true
+}
+
+// listLine formats a file info as a line of "ls -l".
+func listLine(fi fs.FileInfo, now time.Time) string {
+	mode := fi.Mode()
+	if mode.Perm() == 0 {
+		// e.g. fstest.MapFS, which sets no permission bits
+		mode |= 0444
+		if mode.IsDir() {
+			mode |= 0111
+		}
+	}
+	perm := mode.Perm().String()
+	kind := "-"
+	if mode.IsDir() {
+		kind = "d"
+	}
+	t := fi.ModTime().UTC()
+	layout := "Jan _2 15:04"
+	if now.Sub(t) > 180*24*time.Hour || t.Sub(now) > 24*time.Hour {
+		layout = "Jan _2  2006"
+	}
+	return fmt.Sprintf("%s%s 1 ftp ftp %12d %s %s", kind, perm[1:], fi.Size(), t.Format(layout), fi.Name())
+}
+
+// facts formats the MLSD facts of a file info.
+func facts(fi fs.FileInfo) string {
+	t := fi.ModTime().UTC().Format("20060102150405")
+	if fi.IsDir() {
+		return fmt.Sprintf("type=dir;modify=%s;perm=el;", t)
+	}
+	return fmt.Sprintf("type=file;size=%d;modify=%s;perm=r;", fi.Size(), t)
+}
+
+func (c *session) handleList(arg string) {
+	infos, ok := c.entries(listArg(arg))
+	if !ok {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such file or directory", arg)
+		return
+	}
+	now := time.Now().UTC()
+	c.transfer(func(w io.Writer) error {
+		for _, fi := range infos {
+			if _, err := io.WriteString(w, listLine(fi, now)+"\r\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *session) handleNlst(arg string) {
+	infos, ok := c.entries(listArg(arg))
+	if !ok {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such file or directory", arg)
+		return
+	}
+	c.transfer(func(w io.Writer) error {
+		for _, fi := range infos {
+			if _, err := io.WriteString(w, fi.Name()+"\r\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *session) handleMlsd(arg string) {
+	_, fi, err := c.stat(arg)
+	if err != nil || !fi.IsDir() {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such directory", arg)
+		return
+	}
+	infos, _ := c.entries(arg)
+	c.transfer(func(w io.Writer) error {
+		for _, fi := range infos {
+			if _, err := io.WriteString(w, facts(fi)+" "+fi.Name()+"\r\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *session) handleMlst(arg string) {
+	p, fi, err := c.stat(arg)
+	if err != nil {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such file or directory", arg)
+		return
+	}
+	c.multiline(ftp4go.StatusRequestedFileActionOK, "Listing "+p, []string{facts(fi) + " " + p}, "End")
+}
+
+func (c *session) handleSize(arg string) {
+	_, fi, err := c.stat(arg)
+	if err != nil || fi.IsDir() {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such file", arg)
+		return
+	}
+	c.reply(ftp4go.StatusFile, "%d", fi.Size())
+}
+
+func (c *session) handleMdtm(arg string) {
+	_, fi, err := c.stat(arg)
+	if err != nil || fi.IsDir() {
+		c.reply(ftp4go.StatusFileUnavailable, "%s: No such file", arg)
+		return
+	}
+	c.reply(ftp4go.StatusFile, "%s", fi.ModTime().UTC().Format("20060102150405"))
+}
@@ -0,0 +1,302 @@
+package ftpd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+)
+
+var testModTime = time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"readme.txt":         {Data: []byte("hello ftpd\n"), ModTime: testModTime},
+		"pub/data.bin":       {Data: []byte("0123456789"), ModTime: testModTime},
+		"pub/sub/deep.txt":   {Data: []byte("deep"), ModTime: testModTime},
+		"pub/with space.txt": {Data: []byte("space"), ModTime: testModTime},
+	}
+}
+
+// startServer serves fsys on a local port and returns its address.
+func startServer(t *testing.T, s *Server) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve returned %v", err)
+		}
+	})
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func dial(t *testing.T, host string, port int) *ftp4go.FTP {
+	t.Helper()
+	ftp := ftp4go.NewFTP(0)
+	if _, err := ftp.Connect(host, port, ""); err != nil {
+		t.Fatal(err)
+	}
+	return ftp
+}
+
+func TestServer(t *testing.T) {
+	host, port := startServer(t, &Server{FS: testFS()})
+	ftp := dial(t, host, port)
+	defer ftp.Quit()
+
+	if _, err := ftp.Dir(""); err == nil {
+		t.Error("LIST before login succeeded")
+	}
+	if _, err := ftp.Login("anonymous", "guest", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ftp.List("/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if got := strings.Join(names, ","); got != "data.bin,sub,with space.txt" {
+		t.Errorf("List names = %s", got)
+	}
+	if e := entries[0]; e.Size != 10 || !e.Time.Equal(time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("List entry = %+v", e)
+	}
+	if entries[1].Type != ftp4go.EntryTypeFolder {
+		t.Errorf("sub is not listed as a folder: %+v", entries[1])
+	}
+
+	nlst, err := ftp.Nlst("pub/sub")
+	if err != nil || len(nlst) != 1 || !strings.HasSuffix(nlst[0], "deep.txt") {
+		t.Errorf("Nlst = %v, %v", nlst, err)
+	}
+
+	mlsd, err := ftp.Mlsd("/pub", nil)
+	if err != nil || len(mlsd) != 3 {
+		t.Fatalf("Mlsd = %v, %v", mlsd, err)
+	}
+	if mlsd[0].Name != "data.bin" || mlsd[0].Facts["size"] != "10" || mlsd[1].Facts["type"] != "dir" {
+		t.Errorf("Mlsd entries = %+v %+v", mlsd[0], mlsd[1])
+	}
+
+	if _, err := ftp.Cwd("pub"); err != nil {
+		t.Fatal(err)
+	}
+	if pwd, err := ftp.Pwd(); err != nil || pwd != "/pub" {
+		t.Errorf("Pwd = %q, %v", pwd, err)
+	}
+	if _, err := ftp.Cwd("../nowhere"); err == nil {
+		t.Error("Cwd to a missing folder succeeded")
+	}
+	if ok, err := ftp.IsDir("sub"); err != nil || !ok {
+		t.Errorf("IsDir(sub) = %v, %v", ok, err)
+	}
+	if ok, err := ftp.Exists("missing.txt"); err != nil || ok {
+		t.Errorf("Exists(missing.txt) = %v, %v", ok, err)
+	}
+	if size, err := ftp.Size("data.bin"); err != nil || size != 10 {
+		t.Errorf("Size = %d, %v", size, err)
+	}
+	if mtime, err := ftp.Mdtm("/readme.txt"); err != nil || !mtime.Equal(testModTime) {
+		t.Errorf("Mdtm = %v, %v", mtime, err)
+	}
+
+	var buf bytes.Buffer
+	if err := ftp.Retrieve("data.bin", &buf, &ftp4go.TransferOptions{Offset: 4}); err != nil || buf.String() != "456789" {
+		t.Errorf("Retrieve from 4 = %q, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := ftp.Retrieve("with space.txt", &buf, nil); err != nil || buf.String() != "space" {
+		t.Errorf("Retrieve = %q, %v", buf.String(), err)
+	}
+
+	err = ftp.Store("new.txt", strings.NewReader("x"), nil)
+	if err == nil {
+		t.Fatal("Store succeeded on a read-only server")
+	}
+	if _, err := ftp.SendAndRead(ftp4go.DELETE_FTP_CMD, "data.bin"); err == nil {
+		t.Error("DELE succeeded on a read-only server")
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	host, port := startServer(t, &Server{
+		FS:   testFS(),
+		Auth: func(user, password string) bool { return user == "alice" && password == "secret" },
+	})
+	ftp := dial(t, host, port)
+	defer ftp.Quit()
+
+	if _, err := ftp.Login("alice", "wrong", ""); err == nil {
+		t.Error("login with a wrong password succeeded")
+	}
+	if _, err := ftp.Login("alice", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	host, port := startServer(t, &Server{FS: testFS(), TLSConfig: serverConfig, RequireTLS: true})
+
+	plain := dial(t, host, port)
+	if _, err := plain.Login("anonymous", "guest", ""); err == nil {
+		t.Error("login without TLS succeeded")
+	}
+	plain.Quit()
+
+	ftp := dial(t, host, port)
+	defer ftp.Quit()
+	if err := ftp.Secure(clientConfig); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ftp.Login("anonymous", "guest", ""); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := ftp.Retrieve("readme.txt", &buf, nil); err != nil || buf.String() != "hello ftpd\n" {
+		t.Errorf("Retrieve over TLS = %q, %v", buf.String(), err)
+	}
+
+	if err := ftp.Prot(ftp4go.ProtClear); err != nil {
+		t.Fatal(err)
+	}
+	err := ftp.Retrieve("readme.txt", &buf, nil)
+	if err == nil || !strings.Contains(err.Error(), "PROT P") {
+		t.Errorf("Retrieve in clear = %v, want a refusal", err)
+	}
+}
+
+func TestServerDataConnection(t *testing.T) {
+	host, port := startServer(t, &Server{FS: testFS(), ErrorLog: log.New(io.Discard, "", 0)})
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	expect := func(cmd string, code int) string {
+		t.Helper()
+		if cmd != "" {
+			tp.PrintfLine("%s", cmd)
+		}
+		_, msg, err := tp.ReadResponse(code)
+		if err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+		return msg
+	}
+	expect("", ftp4go.StatusReady)
+	expect("USER anonymous", ftp4go.StatusUserOK)
+	expect("PASS guest", ftp4go.StatusLoggedIn)
+
+	// no 150 before the 425 of a transfer without PASV or EPSV
+	expect("RETR readme.txt", ftp4go.StatusCanNotOpenDataConnection)
+	expect("NOOP", ftp4go.StatusCommandOK)
+
+	// a data connection from another address is refused
+	msg := expect("EPSV", ftp4go.StatusExtendedPassiveMode)
+	dataPort := strings.TrimSuffix(msg[strings.Index(msg, "|||")+3:], "|)")
+	dataAddr := net.JoinHostPort(host, dataPort)
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}}
+	thief, err := d.Dial("tcp", dataAddr)
+	if err != nil {
+		t.Skipf("No second loopback address: %v", err)
+	}
+	defer thief.Close()
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	expect("RETR readme.txt", ftp4go.StatusAboutToSend)
+	if b, err := io.ReadAll(data); err != nil || string(b) != "hello ftpd\n" {
+		t.Errorf("Data = %q, %v", b, err)
+	}
+	expect("", ftp4go.StatusClosingDataConnection)
+	thief.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if b, _ := io.ReadAll(thief); len(b) != 0 {
+		t.Errorf("The other address got %q", b)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	host, port := startServer(t, &Server{FS: testFS(), IdleTimeout: 50 * time.Millisecond})
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var all bytes.Buffer
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		all.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	if !strings.Contains(all.String(), "\r\n421 ") {
+		t.Errorf("idle session got %q, want a 421 reply", all.String())
+	}
+}
+
+// testTLSConfigs returns a server configuration with a self-signed certificate for 127.0.0.1
+// and a client configuration trusting it.
+func testTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ftpd test server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}}},
+		&tls.Config{RootCAs: pool}
+}
@@ -0,0 +1,194 @@
+// Package ftphttp serves the files and folders of a remote FTP tree over HTTP.
+package ftphttp
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+)
+
+type handler struct {
+	pool *ftp4go.Pool
+	root string
+}
+
+// Handler returns an http.Handler serving the remote tree below root, an absolute path,
+// with sessions taken from the pool. Files are streamed with their size, modification
+// time and a content type guessed from their extension; single byte ranges are served
+// by restarting the download with REST. Folders are served as plain HTML indexes.
+// Only GET and HEAD requests are accepted.
+func Handler(session *ftp4go.Pool, root string) http.Handler {
+	return &handler{pool: session, root: root}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ftp, err := h.pool.Get()
+	if err != nil {
+		http.Error(w, "502 FTP server unavailable", http.StatusBadGateway)
+		return
+	}
+	healthy := false
+	defer func() {
+		if healthy {
+			h.pool.Put(ftp)
+		} else {
+			h.pool.Discard(ftp)
+		}
+	}()
+
+	fs := ftp4go.NewFS(ftp)
+	upath := path.Clean("/" + r.URL.Path)
+	remote := path.Join(h.root, upath)
+	fi, err := fs.Stat(remote)
+	switch {
+	case os.IsNotExist(err):
+		healthy = true
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, "502 "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if fi.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			healthy = true
+			http.Redirect(w, r, path.Base(upath)+"/", http.StatusMovedPermanently)
+			return
+		}
+		healthy = serveDir(w, r, fs, remote)
+		return
+	}
+	healthy = serveFile(w, r, fs, remote, fi)
+}
+
+// serveDir writes the index of a folder, it returns false if the session failed.
+func serveDir(w http.ResponseWriter, r *http.Request, fs *ftp4go.FS, remote string) bool {
+	infos, err := fs.ReadDir(remote)
+	if err != nil {
+		http.Error(w, "502 "+err.Error(), http.StatusBadGateway)
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return true
+	}
+	fmt.Fprintf(w, "<pre>\n")
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	return true
+}
+
+// serveFile streams a file or a range of it, it returns false if the session failed.
+func serveFile(w http.ResponseWriter, r *http.Request, fs *ftp4go.FS, remote string, fi os.FileInfo) bool {
+	size := fi.Size()
+	start, length := int64(0), size
+
+	if rh := r.Header.Get("Range"); rh != "" {
+		var ok bool
+		if start, length, ok = parseRange(rh, size); !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "416 requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return true
+		}
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(remote))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if t := fi.ModTime(); !t.IsZero() {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	status := http.StatusOK
+	if length != size {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		status = http.StatusPartialContent
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return true
+	}
+
+	f, err := fs.OpenAt(remote, start)
+	if err != nil {
+		http.Error(w, "502 "+err.Error(), http.StatusBadGateway)
+		return false
+	}
+	w.WriteHeader(status)
+	n, err := io.CopyN(w, f, length)
+	if err1 := f.Close(); err1 != nil && start+n == size {
+		// an early Close aborts the download and may be answered with 426
+		return false
+	}
+	return err == nil || err == io.EOF
+}
+
+// parseRange parses a Range header holding a single byte range; a header holding
+// several ranges is ignored, which RFC 7233 permits, and the whole file is served.
+func parseRange(s string, size int64) (start int64, length int64, ok bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, size, true
+	}
+	spec := strings.TrimSpace(s[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return 0, 0, false
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if first == "" {
+		// suffix range, the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true
+}
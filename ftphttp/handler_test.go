@@ -0,0 +1,185 @@
+package ftphttp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+	"github.com/shenshouer/ftp4go/ftpd"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header        string
+		start, length int64
+		ok            bool
+	}{
+		{"bytes=0-99", 0, 100, true},
+		{"bytes=100-", 100, 900, true},
+		{"bytes=-10", 990, 10, true},
+		{"bytes=990-2000", 990, 10, true},
+		{"bytes=0-1,5-6", 0, 1000, true},
+		{"items=0-1", 0, 1000, true},
+		{"bytes=1000-", 0, 0, false},
+		{"bytes=5-4", 0, 0, false},
+		{"bytes=x-", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, length, ok := parseRange(tt.header, 1000)
+		if ok != tt.ok || (ok && (start != tt.start || length != tt.length)) {
+			t.Errorf("%s: got %d+%d %v, want %d+%d %v", tt.header, start, length, ok, tt.start, tt.length, tt.ok)
+		}
+	}
+}
+
+// brokenFS fails the reads of broken.bin once all of its data is read, so that the server
+// answers 426 after sending the whole file.
+type brokenFS struct {
+	fstest.MapFS
+}
+
+func (b brokenFS) Open(name string) (fs.File, error) {
+	f, err := b.MapFS.Open(name)
+	if err != nil || name != "broken.bin" {
+		return f, err
+	}
+	return &brokenFile{f}, nil
+}
+
+type brokenFile struct {
+	fs.File
+}
+
+func (f *brokenFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err == io.EOF {
+		err = errors.New("disk error")
+	}
+	return n, err
+}
+
+func TestHandler(t *testing.T) {
+	mtime := time.Date(2020, 3, 4, 5, 6, 0, 0, time.UTC)
+	s := &ftpd.Server{FS: brokenFS{fstest.MapFS{
+		"readme.txt":     {Data: []byte("hello ftpd\n"), ModTime: mtime},
+		"broken.bin":     {Data: []byte("0123456789"), ModTime: mtime},
+		"pub/a&<b>.txt":  {Data: []byte("escaped"), ModTime: mtime},
+		"pub/sub/c.txt":  {Data: []byte("c"), ModTime: mtime},
+		"pub/space d.md": {Data: []byte("d"), ModTime: mtime},
+	}}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer s.Close()
+	addr := ln.Addr().(*net.TCPAddr)
+
+	var dials atomic.Int32
+	pool := ftp4go.NewPool(1, func() (*ftp4go.FTP, error) {
+		dials.Add(1)
+		ftp := ftp4go.NewFTP(0)
+		if _, err := ftp.Connect(addr.IP.String(), addr.Port, ""); err != nil {
+			return nil, err
+		}
+		if _, err := ftp.Login("anonymous", "guest", ""); err != nil {
+			ftp.Quit()
+			return nil, err
+		}
+		return ftp, nil
+	})
+	defer pool.Close()
+	srv := httptest.NewServer(Handler(pool, "/"))
+	defer srv.Close()
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	do := func(method, p string, header ...string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+p, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	if resp, _ := do(http.MethodGet, "/missing.txt"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %s", resp.Status)
+	}
+	if resp, _ := do(http.MethodGet, "/pub"); resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/pub/" {
+		t.Errorf("Expected a redirect to the folder, got %s to %q", resp.Status, resp.Header.Get("Location"))
+	}
+	resp, body := do(http.MethodGet, "/pub/")
+	for _, want := range []string{`<a href="a&%3Cb%3E.txt">a&amp;&lt;b&gt;.txt</a>`, `<a href="space%20d.md">space d.md</a>`, `<a href="sub/">sub/</a>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("The index lacks %s:\n%s", want, body)
+		}
+	}
+	if resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected index type %q", resp.Header.Get("Content-Type"))
+	}
+
+	// the listing of an old file only tells its day
+	resp, body = do(http.MethodGet, "/readme.txt")
+	if resp.StatusCode != http.StatusOK || body != "hello ftpd\n" ||
+		!strings.HasPrefix(resp.Header.Get("Last-Modified"), "Wed, 04 Mar 2020") ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected file %s %q, headers %v", resp.Status, body, resp.Header)
+	}
+	resp, body = do(http.MethodHead, "/readme.txt")
+	if resp.StatusCode != http.StatusOK || body != "" || resp.ContentLength != 11 || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Unexpected HEAD %s %q, length %d", resp.Status, body, resp.ContentLength)
+	}
+	// the download of a range is cut short, which the server may answer with 426
+	resp, body = do(http.MethodGet, "/readme.txt", "Range", "bytes=6-9")
+	if resp.StatusCode != http.StatusPartialContent || body != "ftpd" || resp.Header.Get("Content-Range") != "bytes 6-9/11" {
+		t.Errorf("Unexpected range %s %q, %q", resp.Status, body, resp.Header.Get("Content-Range"))
+	}
+	if resp, _ := do(http.MethodGet, "/readme.txt", "Range", "bytes=20-"); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable ||
+		resp.Header.Get("Content-Range") != "bytes */11" {
+		t.Errorf("Expected 416, got %s", resp.Status)
+	}
+	if resp, _ := do(http.MethodPost, "/readme.txt"); resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Errorf("Expected 405, got %s", resp.Status)
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("Expected the session to be reused, got %d dials", n)
+	}
+
+	// a failure once the whole file is sent is the session's, which is discarded
+	if _, body = do(http.MethodGet, "/broken.bin"); body != "0123456789" {
+		t.Errorf("Unexpected content %q", body)
+	}
+	if resp, body = do(http.MethodGet, "/readme.txt"); body != "hello ftpd\n" || dials.Load() != 2 {
+		t.Errorf("Expected a new session after the failed one, got %s %q after %d dials", resp.Status, body, dials.Load())
+	}
+
+	// a session failing during the listing is discarded too
+	ftp, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftp.Quit()
+	pool.Put(ftp)
+	if resp, _ := do(http.MethodGet, "/readme.txt"); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected 502 from a closed session, got %s", resp.Status)
+	}
+	if resp, body = do(http.MethodGet, "/readme.txt"); body != "hello ftpd\n" || dials.Load() != 3 {
+		t.Errorf("Expected a new session after the closed one, got %s %q after %d dials", resp.Status, body, dials.Load())
+	}
+}
@@ -0,0 +1,170 @@
+// Package ftpprogress renders the progress of FTP transfers on a terminal: a single status
+// line redrawn in place with the bytes done, the speed and the time left, for one file or
+// for a batch of files as a whole.
+package ftpprogress
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+)
+
+// DefaultInterval is the minimum time between two redraws of a Bar.
+const DefaultInterval = 100 * time.Millisecond
+
+// Bar is a progress line written to a terminal, its Callback method plugs into any
+// ftp4go.Callback option. Set the totals of a batch with Expect to render the batch as a
+// whole, otherwise the running file is rendered. A Bar is safe for concurrent use, by the
+// transfers of a pool for instance.
+type Bar struct {
+	Width    int           // width of the bar in characters, 0 for 30
+	Interval time.Duration // minimum time between two redraws, 0 for DefaultInterval
+
+	mu         sync.Mutex
+	w          io.Writer
+	now        func() time.Time
+	start      time.Time
+	drawn      time.Time
+	lineLen    int
+	files      int              // files expected in the batch, 0 if unknown
+	total      int64            // bytes expected in the batch, 0 if unknown
+	done       int              // files ended
+	doneBytes  int64            // bytes of the files ended
+	running    map[string]int64 // bytes of the running files by resource and name
+	current    string           // name of the file last reported
+	currentTot int64            // its size, -1 if unknown
+}
+
+// New returns a Bar writing to w, usually os.Stderr.
+func New(w io.Writer) *Bar {
+	return &Bar{w: w, now: time.Now, running: make(map[string]int64)}
+}
+
+// Expect sets the number of files and bytes of a batch, either may be 0 if unknown.
+func (b *Bar) Expect(files int, bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files, b.total = files, bytes
+}
+
+// Callback reports the progress of a transfer, pass it as the Callback of the transfer options.
+func (b *Bar) Callback(info *ftp4go.CallbackInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.start.IsZero() {
+		b.start = now
+	}
+	key := info.Resourcename + "\x00" + info.Filename
+	b.current, b.currentTot = info.Filename, info.TotalBytes
+	if b.current == "" {
+		b.current = info.Resourcename
+	}
+	ended := info.Eof || info.Err != nil
+	if ended {
+		delete(b.running, key)
+		b.done++
+		b.doneBytes += info.BytesTransmitted
+	} else {
+		b.running[key] = info.BytesTransmitted
+	}
+	interval := b.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if ended || now.Sub(b.drawn) >= interval {
+		b.drawn = now
+		b.draw(info.BytesTransmitted, now)
+	}
+}
+
+// Stats renders a transfer from its statistics, such as ftp4go.FTP.LastTransfer polled by
+// a ticker for the transfers run without a callback.
+func (b *Bar) Stats(ts *ftp4go.TransferStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current, b.currentTot = ts.Command, ts.TotalBytes
+	b.start = ts.Start
+	now := ts.Start.Add(ts.Duration)
+	if ts.Duration == 0 {
+		now = b.now()
+	}
+	b.draw(ts.Bytes, now)
+}
+
+// Finish ends the progress line, the next output starts on a line of its own.
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lineLen > 0 {
+		fmt.Fprintln(b.w)
+		b.lineLen = 0
+	}
+}
+
+// draw redraws the line, n being the bytes of the file last reported.
+func (b *Bar) draw(n int64, now time.Time) {
+	var line strings.Builder
+	done, total := n, b.currentTot
+	if b.files > 0 || b.total > 0 {
+		// the batch as a whole
+		done = b.doneBytes
+		for _, r := range b.running {
+			done += r
+		}
+		total = b.total
+		if b.files > 0 {
+			fmt.Fprintf(&line, "[%d/%d] ", b.done, b.files)
+		}
+	}
+	line.WriteString(path.Base(b.current))
+	if total > 0 {
+		width := b.Width
+		if width <= 0 {
+			width = 30
+		}
+		fill := width
+		if done < total {
+			fill = int(int64(width) * done / total)
+		}
+		fmt.Fprintf(&line, " [%s%s] %3d%%", strings.Repeat("=", fill), strings.Repeat(" ", width-fill), done*100/total)
+	}
+	fmt.Fprintf(&line, " %s", Bytes(done))
+	if total > 0 {
+		fmt.Fprintf(&line, "/%s", Bytes(total))
+	}
+	if elapsed := now.Sub(b.start); elapsed > 0 {
+		speed := float64(done) / elapsed.Seconds()
+		fmt.Fprintf(&line, " %s/s", Bytes(int64(speed)))
+		if total > done && speed > 0 {
+			fmt.Fprintf(&line, " ETA %s", time.Duration(float64(total-done)/speed*float64(time.Second)).Round(time.Second))
+		}
+	}
+	s := line.String()
+	// blank out the rest of a longer previous line
+	pad := ""
+	if len(s) < b.lineLen {
+		pad = strings.Repeat(" ", b.lineLen-len(s))
+	}
+	b.lineLen = len(s)
+	fmt.Fprintf(b.w, "\r%s%s", s, pad)
+}
+
+// Bytes formats a byte count with a binary unit, e.g. "1.5 MiB".
+func Bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,75 @@
+package ftpprogress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+)
+
+func TestBytes(t *testing.T) {
+	tests := map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 20: "5.0 MiB", 3 << 30: "3.0 GiB"}
+	for n, want := range tests {
+		if got := Bytes(n); got != want {
+			t.Errorf("Bytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestBar(t *testing.T) {
+	var out bytes.Buffer
+	clock := time.Unix(0, 0)
+	b := New(&out)
+	b.Width = 10
+	b.now = func() time.Time { return clock }
+
+	b.Callback(&ftp4go.CallbackInfo{Filename: "/in/a.bin", TotalBytes: 4096})
+	clock = clock.Add(time.Second)
+	b.Callback(&ftp4go.CallbackInfo{Filename: "/in/a.bin", BytesTransmitted: 1024, TotalBytes: 4096})
+	if want := "\ra.bin [==        ]  25% 1.0 KiB/4.0 KiB 1.0 KiB/s ETA 3s"; !strings.HasSuffix(out.String(), want) {
+		t.Errorf("Unexpected line %q, want %q", out.String(), want)
+	}
+
+	// updates within the interval are not drawn, the end always is
+	out.Reset()
+	b.Callback(&ftp4go.CallbackInfo{Filename: "/in/a.bin", BytesTransmitted: 2048, TotalBytes: 4096})
+	if out.Len() != 0 {
+		t.Errorf("Expected no redraw within the interval, got %q", out.String())
+	}
+	b.Callback(&ftp4go.CallbackInfo{Filename: "/in/a.bin", BytesTransmitted: 4096, TotalBytes: 4096, Eof: true})
+	if !strings.Contains(out.String(), "100%") {
+		t.Errorf("Expected the end to be drawn, got %q", out.String())
+	}
+	b.Finish()
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("Finish should end the line, got %q", out.String())
+	}
+}
+
+func TestBarBatch(t *testing.T) {
+	var out bytes.Buffer
+	clock := time.Unix(0, 0)
+	b := New(&out)
+	b.Width = 4
+	b.now = func() time.Time { return clock }
+	b.Expect(2, 2000)
+
+	b.Callback(&ftp4go.CallbackInfo{Filename: "a", BytesTransmitted: 1000, TotalBytes: 1000, Eof: true})
+	clock = clock.Add(2 * time.Second)
+	b.Callback(&ftp4go.CallbackInfo{Filename: "b", BytesTransmitted: 500, TotalBytes: 1000})
+	if want := "\r[1/2] b [=== ]  75% 1.5 KiB/2.0 KiB 750 B/s ETA 1s"; !strings.HasSuffix(out.String(), want) {
+		t.Errorf("Unexpected line %q, want %q", out.String(), want)
+	}
+}
+
+func TestBarStats(t *testing.T) {
+	var out bytes.Buffer
+	b := New(&out)
+	start := time.Unix(100, 0)
+	b.Stats(&ftp4go.TransferStats{Command: "RETR big.iso", TotalBytes: -1, Bytes: 2048, Start: start, Duration: 2 * time.Second})
+	if want := "\rRETR big.iso 2.0 KiB 1.0 KiB/s"; out.String() != want {
+		t.Errorf("Unexpected line %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,387 @@
+// Package ftpreplay records the control channel dialogue of a real FTP session and
+// replays it as a fake server, so that the behavior of an odd server can be captured
+// once and reproduced in tests or attached to a bug report.
+//
+// A recording is a text file holding one line per control channel line, prefixed by
+// "S: " for the server and "C: " for the client; blank lines and lines starting with
+// "#" are ignored. Passwords are recorded as "PASS ****" and any password matches them.
+// Data connections are relayed while recording but not captured: on replay they are
+// opened and closed without content.
+package ftpreplay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenshouer/ftp4go/replyparse"
+)
+
+const (
+	serverPrefix = "S: "
+	clientPrefix = "C: "
+	maskedPass   = "PASS ****"
+)
+
+// Recorder is a proxy between a client and an FTP server writing the control channel
+// dialogue of the sessions going through it.
+type Recorder struct {
+	ln     net.Listener
+	target string
+	mu     sync.Mutex
+	w      io.Writer
+	wg     sync.WaitGroup
+	open   closers
+}
+
+// Record starts a recording proxy listening on listenAddr, e.g. "127.0.0.1:0", and
+// relaying to the server at target, "host:port". The dialogue is written to w.
+// Sessions going through the proxy at the same time end up interleaved in w.
+func Record(listenAddr string, target string, w io.Writer) (*Recorder, error) {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{ln: ln, target: target, w: w}
+	r.wg.Add(1)
+	go r.serve()
+	return r, nil
+}
+
+// Addr returns the host and port the proxy listens on.
+func (r *Recorder) Addr() (string, int) {
+	return tcpAddr(r.ln)
+}
+
+// Close stops the proxy, ends the sessions going through it and waits for them to return.
+func (r *Recorder) Close() error {
+	err := r.ln.Close()
+	r.open.closeAll()
+	r.wg.Wait()
+	return err
+}
+
+func (r *Recorder) serve() {
+	defer r.wg.Done()
+	for {
+		client, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		if !r.open.add(client) {
+			return
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer r.open.remove(client)
+			defer client.Close()
+			server, err := net.Dial("tcp", r.target)
+			if err != nil {
+				r.write("# dial " + r.target + ": " + err.Error())
+				return
+			}
+			if !r.open.add(server) {
+				return
+			}
+			defer r.open.remove(server)
+			defer server.Close()
+			r.session(client, server)
+		}()
+	}
+}
+
+func (r *Recorder) write(line string) {
+	r.mu.Lock()
+	fmt.Fprintln(r.w, line)
+	r.mu.Unlock()
+}
+
+// session relays the control channel lines both ways until either side closes.
+func (r *Recorder) session(client net.Conn, server net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		defer func() { done <- struct{}{} }()
+		br := bufio.NewReader(client)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				l := strings.TrimRight(line, "\r\n")
+				if strings.HasPrefix(strings.ToUpper(l), "PASS ") {
+					l = maskedPass
+				}
+				r.write(clientPrefix + l)
+				io.WriteString(server, line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer func() { done <- struct{}{} }()
+		br := bufio.NewReader(server)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				l := strings.TrimRight(line, "\r\n")
+				r.write(serverPrefix + l)
+				if strings.HasPrefix(l, "227 ") {
+					line = r.relayPasv(l, server) + "\r\n"
+				}
+				io.WriteString(client, line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	<-done
+	client.Close()
+	server.Close()
+	<-done
+}
+
+// relayPasv opens a local data listener relaying to the address of a 227 reply
+// and returns the reply rewritten to point to it.
+func (r *Recorder) relayPasv(reply string, server net.Conn) string {
+	_, port, err := replyparse.Pasv(reply)
+	if err != nil {
+		return reply
+	}
+	// connect to the server host like the client does, whatever the reply says
+	host, _, _ := net.SplitHostPort(server.RemoteAddr().String())
+	target := net.JoinHostPort(host, strconv.Itoa(port))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return reply
+	}
+	if !r.open.add(ln) {
+		return reply
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.open.remove(ln)
+		defer ln.Close()
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(30 * time.Second))
+		client, err := ln.Accept()
+		if err != nil || !r.open.add(client) {
+			return
+		}
+		defer r.open.remove(client)
+		defer client.Close()
+		data, err := net.Dial("tcp", target)
+		if err != nil || !r.open.add(data) {
+			return
+		}
+		defer r.open.remove(data)
+		defer data.Close()
+		copied := make(chan struct{})
+		go func() {
+			defer close(copied)
+			io.Copy(data, client)
+			data.(*net.TCPConn).CloseWrite()
+		}()
+		io.Copy(client, data)
+		client.Close()
+		<-copied
+	}()
+	return replacePasv(reply, ln)
+}
+
+// Server replays a recording as a fake FTP server, for a single session.
+// A client line differing from the recording is answered with a 500 reply
+// and reported by Err.
+type Server struct {
+	ln    net.Listener
+	lines []string
+	mu    sync.Mutex
+	err   error
+	wg    sync.WaitGroup
+	open  closers
+}
+
+// NewServer reads a recording and starts replaying it on a local port.
+func NewServer(recording io.Reader) (*Server, error) {
+	var lines []string
+	sc := bufio.NewScanner(recording)
+	for sc.Scan() {
+		l := sc.Text()
+		switch {
+		case strings.HasPrefix(l, serverPrefix), strings.HasPrefix(l, clientPrefix):
+			lines = append(lines, l)
+		case strings.TrimSpace(l) == "", strings.HasPrefix(l, "#"):
+		default:
+			return nil, fmt.Errorf("ftpreplay: invalid recording line %q", l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, lines: lines}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host and port the server listens on.
+func (s *Server) Addr() (string, int) {
+	return tcpAddr(s.ln)
+}
+
+// Err returns the first divergence of the client from the recording, nil if none.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the server, ends the session and waits for it to return.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.open.closeAll()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	conn, err := s.ln.Accept()
+	if err != nil || !s.open.add(conn) {
+		return
+	}
+	defer s.open.remove(conn)
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	i := 0
+	for {
+		// send the server lines up to the next client line
+		for ; i < len(s.lines) && strings.HasPrefix(s.lines[i], serverPrefix); i++ {
+			line := s.lines[i][len(serverPrefix):]
+			if strings.HasPrefix(line, "227 ") {
+				line = s.fakePasv(line)
+			}
+			io.WriteString(conn, line+"\r\n")
+		}
+		got, err := br.ReadString('\n')
+		if err != nil {
+			if i < len(s.lines) {
+				s.fail(fmt.Errorf("ftpreplay: client closed the connection, expected %q", s.lines[i]))
+			}
+			return
+		}
+		got = strings.TrimRight(got, "\r\n")
+		if i == len(s.lines) {
+			s.fail(fmt.Errorf("ftpreplay: unexpected %q after the end of the recording", got))
+			io.WriteString(conn, "421 ftpreplay: end of the recording\r\n")
+			return
+		}
+		want := s.lines[i][len(clientPrefix):]
+		if !matches(want, got) {
+			s.fail(fmt.Errorf("ftpreplay: expected %q, got %q", want, got))
+			io.WriteString(conn, "500 ftpreplay: expected "+want+"\r\n")
+			continue
+		}
+		i++
+	}
+}
+
+// fakePasv opens a data listener accepting a single connection, closed without
+// content, and returns the reply rewritten to point to it.
+func (s *Server) fakePasv(reply string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil || !s.open.add(ln) {
+		return reply
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.open.remove(ln)
+		defer ln.Close()
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(30 * time.Second))
+		if c, err := ln.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	return replacePasv(reply, ln)
+}
+
+func matches(want string, got string) bool {
+	if want == maskedPass {
+		return strings.HasPrefix(strings.ToUpper(got), "PASS ")
+	}
+	return want == got
+}
+
+func tcpAddr(ln net.Listener) (string, int) {
+	a := ln.Addr().(*net.TCPAddr)
+	return a.IP.String(), a.Port
+}
+
+// replacePasv rewrites the address of a 227 reply to point to the listener.
+func replacePasv(reply string, ln net.Listener) string {
+	host, port := tcpAddr(ln)
+	if r, err := replyparse.ReplacePasv(reply, host, port); err == nil {
+		return r
+	}
+	return reply
+}
+
+// closers tracks the connections and listeners still open, so that Close can end
+// the goroutines blocked on them instead of waiting for the peers to hang up.
+type closers struct {
+	mu     sync.Mutex
+	closed bool
+	m      map[io.Closer]struct{}
+}
+
+// add tracks c, it closes c and returns false if closeAll was already called.
+func (cs *closers) add(c io.Closer) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		c.Close()
+		return false
+	}
+	if cs.m == nil {
+		cs.m = make(map[io.Closer]struct{})
+	}
+	cs.m[c] = struct{}{}
+	return true
+}
+
+func (cs *closers) remove(c io.Closer) {
+	cs.mu.Lock()
+	delete(cs.m, c)
+	cs.mu.Unlock()
+}
+
+func (cs *closers) closeAll() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.closed = true
+	for c := range cs.m {
+		c.Close()
+	}
+	cs.m = nil
+}
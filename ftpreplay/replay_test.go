@@ -0,0 +1,152 @@
+package ftpreplay
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	ftp4go "github.com/shenshouer/ftp4go"
+)
+
+const recording = `# server sending a multi-line greeting and a private PASV address
+S: 220-Welcome
+S: 220 odd server
+C: USER test
+S: 331 Password required
+C: PASS ****
+S: 230 Logged in
+C: PWD
+S: 257 "/home/test" is the current directory
+C: TYPE A
+S: 200 Type set to A
+C: PASV
+S: 227 Entering Passive Mode (10,0,0,1,4,1)
+C: NLST
+S: 150 Here comes the listing
+S: 226 Transfer complete
+C: QUIT
+S: 221 Goodbye
+`
+
+// session runs the client side of the recording against host:port.
+func session(t *testing.T, host string, port int) {
+	t.Helper()
+	ftp := ftp4go.NewFTP(0)
+	if _, err := ftp.Connect(host, port, ""); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	if _, err := ftp.Login("test", "secret", ""); err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+	if dir, err := ftp.Pwd(); err != nil || dir != "/home/test" {
+		t.Errorf("Pwd returned %q, error: %v", dir, err)
+	}
+	if names, err := ftp.Nlst(); err != nil || len(names) != 0 {
+		t.Errorf("Nlst returned %v, error: %v", names, err)
+	}
+	if _, err := ftp.Quit(); err != nil {
+		t.Errorf("Quit error: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s, err := NewServer(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := s.Addr()
+	session(t, host, port)
+	s.Close()
+	if err := s.Err(); err != nil {
+		t.Errorf("The client diverged from the recording: %v", err)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	s, err := NewServer(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := s.Addr()
+	ftp := ftp4go.NewFTP(0)
+	if _, err := ftp.Connect(host, port, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ftp.Login("other", "secret", ""); err == nil {
+		t.Errorf("Login should fail on divergence")
+	}
+	ftp.Quit()
+	s.Close()
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), "USER test") {
+		t.Errorf("Unexpected divergence error: %v", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	s, err := NewServer(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := s.Addr()
+	var out bytes.Buffer
+	r, err := Record("127.0.0.1:0", net.JoinHostPort(host, strconv.Itoa(port)), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session(t, "127.0.0.1", mustPort(r))
+	r.Close()
+	s.Close()
+	if err := s.Err(); err != nil {
+		t.Errorf("The recorded session diverged: %v", err)
+	}
+
+	// the server addresses of PASV replies differ, compare the remaining lines
+	want := strings.Split(strings.SplitN(recording, "\n", 2)[1], "\n")
+	got := strings.Split(out.String(), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("Recorded:\n%s", out.String())
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], "S: 227") && got[i] != want[i] {
+			t.Errorf("Line %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func mustPort(r *Recorder) int {
+	_, port := r.Addr()
+	return port
+}
+
+func TestCloseEndsSessions(t *testing.T) {
+	s, err := NewServer(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := s.Addr()
+	r, err := Record("127.0.0.1:0", net.JoinHostPort(host, strconv.Itoa(port)), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a client which connects and never hangs up
+	ftp := ftp4go.NewFTP(0)
+	if _, err := ftp.Connect("127.0.0.1", mustPort(r), ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []io.Closer{r, s} {
+		done := make(chan struct{})
+		go func() {
+			c.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%T.Close waits for the client to hang up", c)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ftp4go
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HashKey identifies the content of a local file in a HashCache, the file being assumed
+// unchanged as long as its size and modification time are.
+type HashKey struct {
+	Path    string    `json:"path"` // absolute
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"` // in UTC
+}
+
+// HashCache keeps the SHA-256 checksums of local files, hex encoded, so that the receipts,
+// deduplication and verified deliveries of repeated runs do not hash unchanged multi-GB files
+// again. Load returns an empty checksum without error if there is none for the key. A cache
+// may be shared by several sessions, and persisted on disk by the implementations.
+type HashCache interface {
+	Load(key HashKey) (string, error)
+	Save(key HashKey, checksum string) error
+}
+
+// SetHashCache sets the cache of the checksums of local files, nil to turn it off.
+// A failing cache is logged and the file hashed.
+func (ftp *FTP) SetHashCache(cache HashCache) {
+	ftp.hashCache = cache
+}
+
+// MemoryHashCache is a HashCache held in memory, safe for concurrent use.
+// The zero value is ready to use.
+type MemoryHashCache struct {
+	mu   sync.Mutex
+	sums map[HashKey]string
+}
+
+// Load returns the checksum of key.
+func (c *MemoryHashCache) Load(key HashKey) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sums[key], nil
+}
+
+// Save records the checksum of key.
+func (c *MemoryHashCache) Save(key HashKey, checksum string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sums == nil {
+		c.sums = make(map[HashKey]string)
+	}
+	c.sums[key] = checksum
+	return nil
+}
+
+// fileChecksum returns the size and the hex encoded SHA-256 checksum of a local file, from
+// the hash cache if the file is unchanged since it was cached.
+func (ftp *FTP) fileChecksum(localpath string) (int64, string, error) {
+	if ftp.hashCache == nil {
+		return fileChecksum(localpath)
+	}
+	abs, err := filepath.Abs(localpath)
+	if err != nil {
+		return 0, "", err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return 0, "", err
+	}
+	key := HashKey{Path: abs, Size: fi.Size(), ModTime: fi.ModTime().UTC()}
+	if sum, err := ftp.hashCache.Load(key); err != nil {
+		ftp.writeInfo("Unable to read the hash cache:", err)
+	} else if sum != "" {
+		return key.Size, sum, nil
+	}
+
+	size, sum, err := fileChecksum(abs)
+	if err != nil {
+		return 0, "", err
+	}
+	// not cached if the file changed while hashed
+	if fi, err = os.Stat(abs); err == nil && fi.Size() == key.Size && fi.ModTime().Equal(key.ModTime) {
+		if err = ftp.hashCache.Save(key, sum); err != nil {
+			ftp.writeInfo("Unable to write the hash cache:", err)
+		}
+	}
+	return size, sum, nil
+}
@@ -0,0 +1,102 @@
+package ftp4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"time"
+)
+
+const (
+	// DefaultHeartbeatName is the name of the heartbeat file.
+	DefaultHeartbeatName = ".ftp4go-heartbeat.json"
+	// DefaultHeartbeatInterval is the time between two refreshes of the heartbeat file.
+	DefaultHeartbeatInterval = time.Minute
+)
+
+// HeartbeatOptions configures the heartbeat file of the tree and sync jobs, see SetHeartbeat.
+type HeartbeatOptions struct {
+	Name     string        // DefaultHeartbeatName if empty
+	Interval time.Duration // DefaultHeartbeatInterval if 0
+}
+
+// Heartbeat is the content of a heartbeat file, as JSON.
+type Heartbeat struct {
+	Job     string    `json:"job"` // "upload", "download" or "sync"
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+	Entries int       `json:"entries"`           // the files and folders handled so far
+	Current string    `json:"current,omitempty"` // the entry being handled
+}
+
+// heartbeat is the heartbeat of the running job.
+type heartbeat struct {
+	path     string
+	interval time.Duration
+	hb       Heartbeat
+}
+
+// SetHeartbeat makes UploadDirTree, DownloadDirTree and SyncDirs keep a small Heartbeat file
+// in their remote folder, so that the partner can tell the job is alive: it is uploaded when
+// the job starts, refreshed between the files once the interval elapsed, and deleted when the
+// job ends. It is not refreshed during the transfer of a single file, the session being busy.
+// A heartbeat failing to upload is logged rather than failing the job. nil turns it off.
+func (ftp *FTP) SetHeartbeat(opts *HeartbeatOptions) {
+	ftp.heartbeatOpts = opts
+}
+
+// startHeartbeat uploads the heartbeat file of a job into the absolute remote folder dir,
+// if configured, and returns the function deleting it at the end of the job.
+func (ftp *FTP) startHeartbeat(job string, dir string) (stop func()) {
+	opts := ftp.heartbeatOpts
+	if opts == nil || ftp.heartbeat != nil {
+		return func() {}
+	}
+	name, interval := opts.Name, opts.Interval
+	if name == "" {
+		name = DefaultHeartbeatName
+	}
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	now := time.Now().UTC()
+	hb := &heartbeat{path: path.Join(dir, name), interval: interval, hb: Heartbeat{Job: job, Started: now}}
+	ftp.heartbeat = hb
+	ftp.writeHeartbeat(hb, now)
+	return func() {
+		ftp.heartbeat = nil
+		if _, err := ftp.Delete(hb.path); err != nil {
+			ftp.writeInfo("Unable to remove the heartbeat file", hb.path, ":", err)
+		}
+	}
+}
+
+// beat counts the entry p of the running job and refreshes the heartbeat file if due.
+func (ftp *FTP) beat(p string) {
+	hb := ftp.heartbeat
+	if hb == nil {
+		return
+	}
+	hb.hb.Entries++
+	hb.hb.Current = p
+	if now := time.Now().UTC(); now.Sub(hb.hb.Updated) >= hb.interval {
+		ftp.writeHeartbeat(hb, now)
+	}
+}
+
+// isHeartbeat reports whether the remote path p is the heartbeat file of the running job,
+// which the job leaves out.
+func (ftp *FTP) isHeartbeat(p string) bool {
+	return ftp.heartbeat != nil && path.Clean(p) == ftp.heartbeat.path
+}
+
+func (ftp *FTP) writeHeartbeat(hb *heartbeat, now time.Time) {
+	hb.hb.Updated = now
+	b, err := json.Marshal(&hb.hb)
+	if err == nil {
+		err = ftp.Store(hb.path, bytes.NewReader(b), nil)
+	}
+	if err != nil {
+		ftp.writeInfo("Unable to upload the heartbeat file", hb.path, ":", err)
+	}
+}
@@ -0,0 +1,32 @@
+package ftp4go
+
+import "strconv"
+
+// SetIdle asks the server with SITE IDLE to keep an inactive session for the given seconds
+// instead of its default idle timeout, so that a slow pipeline leaving long gaps between
+// commands is not disconnected. SITE IDLE is a non-standard command supported by wu-ftpd,
+// ProFTPD and others: honored reports whether the server accepted it, a server refusing
+// or not knowing it is not an error. See IdleTimeout.
+func (ftp *FTP) SetIdle(seconds int) (honored bool, err error) {
+	resp, err := ftp.SendAndRead(SITE_FTP_CMD, "IDLE", strconv.Itoa(seconds))
+	if err != nil {
+		if replyCode(err) >= 500 {
+			ftp.writeInfo("SITE IDLE not honored:", err)
+			return false, nil
+		}
+		return false, err
+	}
+	if resp.Code == StatusCommandNotImplemented {
+		// superfluous at this site
+		ftp.writeInfo("SITE IDLE not honored:", resp.Message)
+		return false, nil
+	}
+	ftp.idle = seconds
+	return true, nil
+}
+
+// IdleTimeout returns the idle timeout in seconds last honored by the server through
+// SetIdle on the current connection, 0 if none.
+func (ftp *FTP) IdleTimeout() int {
+	return ftp.idle
+}
@@ -0,0 +1,258 @@
+package socks5
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is a SOCKS5 proxy serving CONNECT requests, relaying nothing: the accepted
+// connections echo what they receive after the handshake.
+type fakeServer struct {
+	ln      net.Listener
+	auth    *Auth         // required credentials, nil for no authentication
+	reply   byte          // reply code to CONNECT
+	hold    time.Duration // delay before answering the greeting
+	targets chan string   // the requested addresses
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, targets: make(chan string, 10)}
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeServer) serve() {
+	go func() {
+		for {
+			c, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(c)
+		}
+	}()
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeServer) handle(c net.Conn) {
+	defer c.Close()
+	b := make([]byte, 262)
+	if _, err := io.ReadFull(c, b[:2]); err != nil || b[0] != version {
+		return
+	}
+	methods := b[2 : 2+int(b[1])]
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return
+	}
+	time.Sleep(s.hold)
+	want := byte(methodNone)
+	if s.auth != nil {
+		want = methodUserPass
+	}
+	if !strings.ContainsRune(string(methods), rune(want)) {
+		c.Write([]byte{version, methodRefused})
+		return
+	}
+	c.Write([]byte{version, want})
+	if s.auth != nil {
+		if _, err := io.ReadFull(c, b[:2]); err != nil {
+			return
+		}
+		user := make([]byte, b[1])
+		io.ReadFull(c, user)
+		io.ReadFull(c, b[:1])
+		pass := make([]byte, b[0])
+		io.ReadFull(c, pass)
+		if string(user) != s.auth.User || string(pass) != s.auth.Password {
+			c.Write([]byte{1, 1})
+			return
+		}
+		c.Write([]byte{1, 0})
+	}
+
+	if _, err := io.ReadFull(c, b[:4]); err != nil || b[1] != cmdConnect {
+		return
+	}
+	var host string
+	switch b[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if b[3] == atypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		io.ReadFull(c, ip)
+		host = ip.String()
+	case atypDomain:
+		io.ReadFull(c, b[:1])
+		name := make([]byte, b[0])
+		io.ReadFull(c, name)
+		host = string(name)
+	}
+	io.ReadFull(c, b[:2])
+	s.targets <- net.JoinHostPort(host, strconv.Itoa(int(b[0])<<8|int(b[1])))
+	c.Write([]byte{version, s.reply, 0, atypIPv4, 127, 0, 0, 1, 0, 21})
+	if s.reply == 0 {
+		io.Copy(c, c)
+	}
+}
+
+func roundTrip(t *testing.T, c net.Conn) {
+	t.Helper()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "ping" {
+		t.Fatalf("Expected the connection to be relayed, got %q, %v", b, err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	s := newFakeServer(t)
+	s.serve()
+
+	for _, addr := range []string{"ftp.example.com:21", "10.1.2.3:2121", "[2001:db8::1]:990"} {
+		c, err := New(s.addr(), nil, nil).Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial %s: %v", addr, err)
+		}
+		if got := <-s.targets; got != addr {
+			t.Errorf("Expected the proxy to connect to %s, got %s", addr, got)
+		}
+		roundTrip(t, c)
+		c.Close()
+	}
+
+	if _, err := New(s.addr(), nil, nil).Dial("udp", "10.1.2.3:21"); err == nil {
+		t.Error("Expected UDP to be refused")
+	}
+}
+
+func TestDialAuth(t *testing.T) {
+	s := newFakeServer(t)
+	s.auth = &Auth{User: "alice", Password: "secret"}
+	s.serve()
+
+	c, err := New(s.addr(), &Auth{User: "alice", Password: "secret"}, Direct).Dial("tcp", "example.com:21")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, c)
+	c.Close()
+
+	_, err = New(s.addr(), &Auth{User: "alice", Password: "wrong"}, Direct).Dial("tcp", "example.com:21")
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("Expected an authentication failure, got %v", err)
+	}
+	_, err = New(s.addr(), nil, Direct).Dial("tcp", "example.com:21")
+	if err == nil || !strings.Contains(err.Error(), "no acceptable authentication") {
+		t.Errorf("Expected the proxy to refuse no authentication, got %v", err)
+	}
+}
+
+func TestDialReplyError(t *testing.T) {
+	s := newFakeServer(t)
+	s.reply = 5
+	s.serve()
+
+	_, err := New(s.addr(), nil, nil).Dial("tcp", "example.com:21")
+	if err == nil || err.Error() != "socks5: connection refused" {
+		t.Errorf("Expected the refusal of the proxy, got %v", err)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	s := newFakeServer(t)
+	s.hold = time.Second
+	s.serve()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err := New(s.addr(), nil, nil).DialContext(ctx, "tcp", "example.com:21")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the handshake to be canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("The cancellation took %v", d)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := New(s.addr(), nil, nil).DialContext(ctx, "tcp", "example.com:21"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the handshake to time out, got %v", err)
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	u, _ := url.Parse("socks5://bob:pw@proxy.example.com")
+	d, err := FromURL(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(*Client)
+	if c.ProxyAddr != "proxy.example.com:1080" || c.Auth == nil || c.Auth.User != "bob" || c.Auth.Password != "pw" {
+		t.Errorf("Unexpected client %+v, auth %+v", c, c.Auth)
+	}
+
+	for _, s := range []string{"http://proxy:3128", "socks5://:1080"} {
+		u, _ := url.Parse(s)
+		if _, err := FromURL(u, nil); err == nil {
+			t.Errorf("Expected %s to be refused", s)
+		}
+	}
+}
+
+func TestFromEnvironment(t *testing.T) {
+	t.Setenv("ALL_PROXY", "")
+	t.Setenv("all_proxy", "")
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	if FromEnvironment() != Direct {
+		t.Error("Expected a direct connection without proxy")
+	}
+
+	t.Setenv("all_proxy", "http://proxy:3128")
+	if FromEnvironment() != Direct {
+		t.Error("Expected a direct connection with an unsupported proxy")
+	}
+
+	t.Setenv("all_proxy", "socks5://proxy:1080")
+	if _, ok := FromEnvironment().(*Client); !ok {
+		t.Error("Expected a SOCKS5 client")
+	}
+
+	t.Setenv("NO_PROXY", "localhost, .internal.example.com,10.0.0.0/8,192.168.1.7")
+	b, ok := FromEnvironment().(*bypass)
+	if !ok {
+		t.Fatal("Expected the proxy to be bypassed for some hosts")
+	}
+	for host, want := range map[string]bool{
+		"localhost":                true,
+		"internal.example.com":     true,
+		"ftp.internal.example.com": true,
+		"example.com":              false,
+		"10.20.30.40":              true,
+		"192.168.1.7":              true,
+		"192.168.1.8":              false,
+	} {
+		if got := b.bypassed(host); got != want {
+			t.Errorf("bypassed(%s) = %v, expected %v", host, got, want)
+		}
+	}
+}
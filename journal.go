@@ -0,0 +1,112 @@
+package ftp4go
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a line of the audit journal, written as JSON for every
+// mutating operation of the session.
+type JournalEntry struct {
+	Time     time.Time `json:"time"`               // start of the operation
+	Op       string    `json:"op"`                 // STOR, DELE, MKD, RMD or RENAME
+	Path     string    `json:"path"`               // remote path as passed to the operation
+	Target   string    `json:"target,omitempty"`   // new name of a RENAME
+	Size     int64     `json:"size,omitempty"`     // bytes stored
+	Checksum string    `json:"checksum,omitempty"` // sha256 of the stored bytes, hex encoded
+	Code     int       `json:"code"`               // last reply code of the operation
+	Duration float64   `json:"duration"`           // in seconds
+	Error    string    `json:"error,omitempty"`
+}
+
+// Journal serializes the entries written to a journal writer, so that several sessions
+// can share it: pass the same Journal to their SetJournal.
+type Journal struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJournal returns a Journal writing to w.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write writes p to the writer of the journal, serialized with the entries.
+func (j *Journal) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.w.Write(p)
+}
+
+func (j *Journal) encode(e *JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc.Encode(e)
+}
+
+// SetJournal sets an io.Writer receiving an audit journal in JSON lines format, one
+// JournalEntry for every upload, delete, rename and folder creation or removal,
+// including the ones performed by the tree operations. A nil writer turns it off.
+// Sessions sharing a writer must be given the same *Journal, see NewJournal, for
+// their entries not to interleave.
+func (ftp *FTP) SetJournal(w io.Writer) {
+	switch j := w.(type) {
+	case nil:
+		ftp.journal = nil
+	case *Journal:
+		ftp.journal = j
+	default:
+		ftp.journal = NewJournal(w)
+	}
+}
+
+// MutationEvent reports a folder creation or removal, a rename or a delete, the mutations
+// which move no bytes, so that progress displays and audit logs show every change made by the
+// session, the tree and sync operations included; the uploads are reported to their Callback.
+type MutationEvent struct {
+	Op       string // DELE, MKD, RMD or RENAME
+	Path     string // remote path as passed to the operation
+	Target   string // new name of a RENAME
+	Code     int    // last reply code of the operation
+	Duration time.Duration
+	Err      error // nil if the operation succeeded
+}
+
+// MutationFunc receives the MutationEvent of every mutation of a session.
+type MutationFunc func(ev *MutationEvent)
+
+// SetMutationCallback sets the function told about every delete, rename and folder creation or
+// removal, including the ones performed by the tree operations, once its reply is read. It is
+// called synchronously; nil turns it off.
+func (ftp *FTP) SetMutationCallback(fn MutationFunc) {
+	ftp.onMutation = fn
+}
+
+// record writes e to the journal, if any, completing it with the outcome of the operation,
+// and reports the mutations other than uploads to the SetMutationCallback function.
+// It is meant to be deferred at the start of the operation with a pointer to its error.
+func (ftp *FTP) record(e *JournalEntry, start time.Time, err *error) {
+	// the code of the refusal, or of the last reply of the successful operation
+	code := replyCode(*err)
+	if *err == nil {
+		code = ftp.lastCode
+	}
+	if ftp.onMutation != nil && e.Op != "STOR" {
+		ftp.onMutation(&MutationEvent{Op: e.Op, Path: e.Path, Target: e.Target, Code: code, Duration: time.Since(start), Err: *err})
+	}
+	if ftp.journal == nil {
+		return
+	}
+	e.Time = start
+	e.Duration = time.Since(start).Seconds()
+	e.Code = code
+	if *err != nil {
+		e.Error = (*err).Error()
+	}
+	if err1 := ftp.journal.encode(e); err1 != nil {
+		ftp.writeInfo("Unable to write the journal:", err1)
+	}
+}
@@ -0,0 +1,69 @@
+package ftp4go
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// An ErrListingMismatch is returned by RemoveRemoteTree with RemoveOptions.VerifyListing when
+// the names of the NLST of a folder disagree with the parsed LIST entries, a sign the LIST
+// format of the server is not parsed right: deleting after it could miss or mistake entries.
+type ErrListingMismatch struct {
+	Dir      string
+	Unparsed []string // the names of NLST missing from the parsed LIST
+	Unknown  []string // the parsed names of files missing from NLST
+}
+
+func (e *ErrListingMismatch) Error() string {
+	var parts []string
+	if len(e.Unparsed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d names of NLST missing from LIST, e.g. %q", len(e.Unparsed), e.Unparsed[0]))
+	}
+	if len(e.Unknown) > 0 {
+		parts = append(parts, fmt.Sprintf("%d files of LIST missing from NLST, e.g. %q", len(e.Unknown), e.Unknown[0]))
+	}
+	return fmt.Sprintf("LIST and NLST disagree in %s: %s", e.Dir, strings.Join(parts, ", "))
+}
+
+// verifyListing cross-checks the parsed LIST entries of dir with its NLST. The folders may
+// be missing from NLST, which some servers restrict to the files.
+func (ftp *FTP) verifyListing(dir string, entries []*Entry) error {
+	names, err := ftp.Nlst(dir)
+	if ftp.absent(err) {
+		names, err = nil, nil // the reply of some servers to the NLST of an empty folder
+	}
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		listed[e.Name] = true
+	}
+	nlst := make(map[string]bool, len(names))
+	e := &ErrListingMismatch{Dir: dir}
+	for _, name := range names {
+		// some servers answer with the paths
+		name = path.Base(strings.TrimSpace(name))
+		if name == "." || name == ".." || name == "" {
+			continue
+		}
+		nlst[name] = true
+		if !listed[name] {
+			e.Unparsed = append(e.Unparsed, name)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Type != EntryTypeFolder && !nlst[entry.Name] {
+			e.Unknown = append(e.Unknown, entry.Name)
+		}
+	}
+	if len(e.Unparsed) == 0 && len(e.Unknown) == 0 {
+		return nil
+	}
+	sort.Strings(e.Unparsed)
+	sort.Strings(e.Unknown)
+	return e
+}
@@ -0,0 +1,131 @@
+package ftp4go
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+)
+
+// errIterClosed ends a listing closed before its end.
+var errIterClosed = errors.New("listing closed before its end")
+
+// EntryIter streams the entries of a LIST reply as they arrive, without holding the
+// whole listing in memory. The session must not be used for anything else until
+// Next returned false or Close was called:
+//
+//	it := ftp.ListIter("/big")
+//	for it.Next() {
+//		e := it.Entry()
+//		...
+//	}
+//	if err := it.Close(); err != nil {
+//		...
+//	}
+type EntryIter struct {
+	ftp  *FTP
+	conn net.Conn
+	r    *textproto.Reader
+	e    *Entry
+	err  error
+}
+
+// ListIter starts listing the directory p, the current one if empty. The entries are
+// filtered and parsed like by List; errors are reported by Err and Close.
+func (ftp *FTP) ListIter(p string) *EntryIter {
+	it := &EntryIter{ftp: ftp}
+	if _, it.err = ftp.SendAndRead(TYPE_A_FTP_CMD); it.err != nil {
+		return it
+	}
+	if it.conn, _, it.err = ftp.transferLine(LIST_FTP_CMD, LIST_FTP_CMD.AppendParameters(p), DataConnSession); it.err != nil {
+		it.err = ftp.finishTransfer(LIST_FTP_CMD, nil, true, it.err)
+		return it
+	}
+	it.r = textproto.NewReader(bufio.NewReader(it.conn))
+	return it
+}
+
+// Next advances to the next entry, false at the end of the listing or on error.
+func (it *EntryIter) Next() bool {
+	it.e = nil
+	for it.conn != nil {
+		l, err := it.r.ReadLineBytes()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			it.finish(err)
+			return false
+		}
+		if it.e = it.ftp.listEntry(string(it.ftp.decode(l))); it.e != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry returns the current entry.
+func (it *EntryIter) Entry() *Entry {
+	return it.e
+}
+
+// Err returns the error which ended the listing, nil until then or at its regular end.
+func (it *EntryIter) Err() error {
+	return it.err
+}
+
+// Close ends the listing, aborting it if Next did not reach its end, and returns Err.
+func (it *EntryIter) Close() error {
+	if it.conn != nil {
+		it.finish(errIterClosed)
+		if errors.Is(it.err, errIterClosed) {
+			it.err = nil
+		}
+	}
+	return it.err
+}
+
+func (it *EntryIter) finish(err error) {
+	// an aborted listing is not drained, the server answers with 426 or 226
+	it.err = it.ftp.finishTransfer(LIST_FTP_CMD, it.conn, false, err)
+	it.conn = nil
+	it.e = nil
+}
+
+// ListChan streams the entries of the directory p over a channel buffering up to buffer
+// entries: a slow consumer holds up the listing, down to the server through the flow control
+// of the data connection. The error channel receives the outcome, nil on success, once the
+// entries channel is closed. The consumer must read the entries channel to its end,
+// ListChanContext also lets it stop early. The session must not be used meanwhile.
+func (ftp *FTP) ListChan(p string, buffer int) (<-chan *Entry, <-chan error) {
+	return ftp.ListChanContext(context.Background(), p, buffer)
+}
+
+// ListChanContext is ListChan aborting the listing when ctx is done, the error channel
+// then receives the error of ctx.
+func (ftp *FTP) ListChanContext(ctx context.Context, p string, buffer int) (<-chan *Entry, <-chan error) {
+	entries := make(chan *Entry, buffer)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := ftp.sendEntries(ctx, p, entries)
+		close(entries)
+		errc <- err
+	}()
+	return entries, errc
+}
+
+func (ftp *FTP) sendEntries(ctx context.Context, p string, entries chan<- *Entry) error {
+	it := ftp.ListIter(p)
+	for it.Next() {
+		select {
+		case entries <- it.Entry():
+		case <-ctx.Done():
+			it.Close()
+			return ctx.Err()
+		}
+	}
+	return it.Close()
+}
@@ -0,0 +1,87 @@
+package ftp4go
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync"
+)
+
+// mkdExisted reports whether err, the failure of the MKD of a folder, means that it exists
+// already, created by another worker in the meantime for instance: the reply says so, or
+// else Stat finds it.
+func (ftp *FTP) mkdExisted(remoteDir string, err error) bool {
+	var reply *Error
+	if errors.As(err, &reply) && reply.Code == StatusFileUnavailable {
+		if msg := strings.ToLower(reply.Msg); strings.Contains(msg, "exists") || strings.Contains(msg, "already") {
+			return true
+		}
+	}
+	return ftp.isDir(remoteDir)
+}
+
+// DirCoordinator creates the remote folders of a job run by several workers, each with its
+// own session of a Pool for instance: every folder is created once, the workers needing one
+// being created by another wait for its outcome rather than racing it with MKD. Use one per
+// job, set as the Dirs of the TransferOptions with CreateDirs, or call MkdirAll directly.
+// A failed creation is forgotten, the next worker needing the folder tries again.
+type DirCoordinator struct {
+	mu   sync.Mutex
+	dirs map[string]*dirCreation
+}
+
+// dirCreation is a folder created, or being created, by a worker.
+type dirCreation struct {
+	done chan struct{} // closed once created or failed
+	err  error
+}
+
+// NewDirCoordinator returns a coordinator for a new job.
+func NewDirCoordinator() *DirCoordinator {
+	return &DirCoordinator{dirs: make(map[string]*dirCreation)}
+}
+
+// MkdirAll is FTP.MkdirAll with session, each folder being created only once per coordinator.
+func (c *DirCoordinator) MkdirAll(session *FTP, remoteDir string) error {
+	remoteDir = path.Clean(remoteDir)
+	if remoteDir == "/" || remoteDir == "." {
+		return nil
+	}
+	c.mu.Lock()
+	if d, ok := c.dirs[remoteDir]; ok {
+		c.mu.Unlock()
+		<-d.done
+		if d.err == nil {
+			return nil
+		}
+		// the worker which tried failed, try again
+		return c.MkdirAll(session, remoteDir)
+	}
+	d := &dirCreation{done: make(chan struct{})}
+	c.dirs[remoteDir] = d
+	c.mu.Unlock()
+
+	d.err = c.mkdir(session, remoteDir)
+	if d.err != nil {
+		c.mu.Lock()
+		delete(c.dirs, remoteDir)
+		c.mu.Unlock()
+	}
+	close(d.done)
+	return d.err
+}
+
+// mkdir creates a folder, and its missing parents through the coordinator.
+func (c *DirCoordinator) mkdir(session *FTP, remoteDir string) error {
+	if _, err := session.Mkd(remoteDir); err == nil || session.mkdExisted(remoteDir, err) {
+		return nil
+	}
+	// the parent is missing, or the folder can not be created at all
+	if err := c.MkdirAll(session, path.Dir(remoteDir)); err != nil {
+		return err
+	}
+	if _, err := session.Mkd(remoteDir); err != nil && !session.mkdExisted(remoteDir, err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package ftp4go
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform, the segmented downloads write with WriteAt.
+func mmapFile(f *os.File, size int64) (data []byte, unmap func() error, err error) {
+	return nil, nil, errors.ErrUnsupported
+}
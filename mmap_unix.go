@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package ftp4go
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the size first bytes of f for writing, the changes reaching the file.
+func mmapFile(f *os.File, size int64) (data []byte, unmap func() error, err error) {
+	if size > math.MaxInt {
+		return nil, nil, fmt.Errorf("Unable to map %d bytes of %s in memory", size, f.Name())
+	}
+	if data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
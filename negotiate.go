@@ -0,0 +1,147 @@
+package ftp4go
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Negotiation records which optional features Negotiate decided to use with the server.
+type Negotiation struct {
+	TLS   bool     // the control and data connections are protected by TLS
+	ModeZ bool     // the data connections are deflate compressed (MODE Z)
+	UTF8  bool     // the server accepted OPTS UTF8 ON, file names are UTF-8
+	MLSD  bool     // the server supports MLSD/MLST machine readable listings
+	Notes []string // why features advertised by the server are not used
+}
+
+// String returns a one line summary of the decisions, suitable for logs.
+func (n *Negotiation) String() string {
+	onoff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	}
+	s := fmt.Sprintf("TLS=%s MODE Z=%s UTF8=%s MLSD=%s", onoff(n.TLS), onoff(n.ModeZ), onoff(n.UTF8), onoff(n.MLSD))
+	if len(n.Notes) > 0 {
+		s += " (" + strings.Join(n.Notes, "; ") + ")"
+	}
+	return s
+}
+
+// SetCompression enables or disables the negotiation of MODE Z by Negotiate, enabled by default.
+// Disabling it after Negotiate switches the data connections back to MODE S.
+func (ftp *FTP) SetCompression(enabled bool) (err error) {
+	ftp.noCompression = !enabled
+	if !enabled && ftp.modeZ {
+		if _, err = ftp.SendAndRead(MODE_FTP_CMD, "S"); err != nil {
+			return
+		}
+		ftp.modeZ = false
+		if ftp.negotiation != nil {
+			ftp.negotiation.ModeZ = false
+		}
+	}
+	return
+}
+
+// Negotiate detects the server capabilities via FEAT, if not done yet, and decides
+// which optional features to use for the session: UTF-8 file names, MLSD listings
+// and MODE Z compression. The decisions are returned, logged and kept for Negotiated.
+// It is meant to be called once after Login.
+func (ftp *FTP) Negotiate() (n *Negotiation, err error) {
+	if ftp.features == nil {
+		if _, err = ftp.Feat(); err != nil {
+			return nil, err
+		}
+	}
+
+	n = &Negotiation{}
+
+	n.TLS = ftp.Protection() == ProtPrivate
+	if !n.TLS && (ftp.HasFeature("AUTH TLS") || ftp.HasFeature("AUTH SSL")) {
+		n.Notes = append(n.Notes, "AUTH TLS advertised but the session is not secured, see Secure")
+	}
+
+	if err1 := ftp.enableUTF8(); err1 != nil {
+		n.Notes = append(n.Notes, "OPTS UTF8 ON refused: "+err1.Error())
+	}
+	n.UTF8 = ftp.utf8
+
+	n.MLSD = ftp.HasFeature("MLST")
+
+	if ftp.HasFeature("MODE Z") {
+		switch {
+		case ftp.noCompression:
+			n.Notes = append(n.Notes, "MODE Z disabled by SetCompression")
+		case ftp.modeZ:
+			n.ModeZ = true
+		default:
+			if _, err1 := ftp.SendAndRead(MODE_FTP_CMD, "Z"); err1 != nil {
+				n.Notes = append(n.Notes, "MODE Z refused: "+err1.Error())
+			} else {
+				ftp.modeZ = true
+				n.ModeZ = true
+			}
+		}
+	}
+
+	ftp.negotiation = n
+	ftp.writeInfo("Negotiated features:", n)
+	return n, nil
+}
+
+// Negotiated returns the decisions of the last Negotiate call, nil if it has not been called.
+func (ftp *FTP) Negotiated() *Negotiation {
+	return ftp.negotiation
+}
+
+// zlibConn is a data connection in MODE Z: reads are inflated and writes deflated.
+type zlibConn struct {
+	net.Conn
+	r     io.ReadCloser
+	w     *zlib.Writer
+	level int // deflate level of the writes, 0 for the default
+}
+
+func (c *zlibConn) Read(p []byte) (n int, err error) {
+	if c.r == nil {
+		if c.r, err = zlib.NewReader(c.Conn); err != nil {
+			return 0, err
+		}
+	}
+	return c.r.Read(p)
+}
+
+func (c *zlibConn) Write(p []byte) (n int, err error) {
+	if c.w == nil {
+		level := c.level
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		if c.w, err = zlib.NewWriterLevel(c.Conn, level); err != nil {
+			return 0, err
+		}
+	}
+	return c.w.Write(p)
+}
+
+// Close flushes the compressed stream before closing the connection.
+// It returns the first error, a failed flush meaning the upload is incomplete.
+func (c *zlibConn) Close() (err error) {
+	if c.w != nil {
+		err = c.w.Close()
+	}
+	if c.r != nil {
+		if err1 := c.r.Close(); err == nil {
+			err = err1
+		}
+	}
+	if err1 := c.Conn.Close(); err == nil {
+		err = err1
+	}
+	return
+}
@@ -0,0 +1,123 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidOption is returned by the typed OPTS helpers for an argument rejected before
+// sending the command.
+var ErrInvalidOption = errors.New("Invalid OPTS argument")
+
+// OptsUTF8 switches the file names of the session to UTF-8 with OPTS UTF8 ON, or back to
+// the server's default with OPTS UTF8 OFF. UTF8Enabled reports the outcome.
+func (ftp *FTP) OptsUTF8(on bool) (response *Response, err error) {
+	state := "OFF"
+	if on {
+		state = "ON"
+	}
+	if response, err = ftp.Opts("UTF8", state); err != nil {
+		return
+	}
+	ftp.utf8 = on
+	return
+}
+
+// OptsMLST selects the facts listed by MLST and MLSD, e.g. "type", "size", "modify".
+// The facts must be among those advertised by FEAT, when it was called; the server may
+// still select fewer of them, MlstFacts returns those it acknowledged. No facts select none.
+func (ftp *FTP) OptsMLST(facts ...string) (response *Response, err error) {
+	advertised := ftp.mlstAdvertised()
+	for _, f := range facts {
+		if f == "" || strings.ContainsAny(f, "; =*") {
+			return nil, fmt.Errorf("%w: MLST fact %q", ErrInvalidOption, f)
+		}
+		if advertised != nil && !advertised[strings.ToLower(f)] {
+			return nil, fmt.Errorf("%w: MLST fact %q not advertised by the server", ErrInvalidOption, f)
+		}
+	}
+	list := strings.Join(facts, ";")
+	if list != "" {
+		list += ";"
+	}
+	if response, err = ftp.Opts("MLST", list); err != nil {
+		return response, ftp.unavailable(err, "MLST", "Selecting the MLST facts", "")
+	}
+	// "200 MLST OPTS type;size;", the facts actually selected
+	selected := facts
+	if i := strings.Index(strings.ToUpper(response.Message), "MLST OPTS"); i >= 0 {
+		selected = nil
+		for _, f := range strings.Split(strings.TrimSpace(response.Message[i+len("MLST OPTS"):]), ";") {
+			if f = strings.TrimSpace(f); f != "" {
+				selected = append(selected, f)
+			}
+		}
+	}
+	ftp.mlstFacts = append([]string{}, selected...)
+	ftp.markMlstFacts()
+	return
+}
+
+// MlstFacts returns the facts selected by the last OptsMLST, nil if it was not called and
+// the server lists its default facts.
+func (ftp *FTP) MlstFacts() []string {
+	if ftp.mlstFacts == nil {
+		return nil
+	}
+	return append([]string{}, ftp.mlstFacts...)
+}
+
+// mlstAdvertised returns the facts of the MLST feature in lower case, nil if unknown.
+func (ftp *FTP) mlstAdvertised() map[string]bool {
+	params := ftp.features["MLST"]
+	if params == "" {
+		return nil
+	}
+	facts := make(map[string]bool)
+	for _, f := range strings.Split(params, ";") {
+		if f = strings.TrimSuffix(strings.TrimSpace(f), "*"); f != "" {
+			facts[strings.ToLower(f)] = true
+		}
+	}
+	return facts
+}
+
+// markMlstFacts updates the parameters of the MLST feature, where a star marks the facts
+// selected, as a new FEAT would list them.
+func (ftp *FTP) markMlstFacts() {
+	params := ftp.features["MLST"]
+	if params == "" {
+		return
+	}
+	selected := make(map[string]bool, len(ftp.mlstFacts))
+	for _, f := range ftp.mlstFacts {
+		selected[strings.ToLower(f)] = true
+	}
+	var b strings.Builder
+	for _, f := range strings.Split(params, ";") {
+		if f = strings.TrimSuffix(strings.TrimSpace(f), "*"); f == "" {
+			continue
+		}
+		b.WriteString(f)
+		if selected[strings.ToLower(f)] {
+			b.WriteByte('*')
+		}
+		b.WriteByte(';')
+	}
+	ftp.features["MLST"] = b.String()
+}
+
+// OptsModeZLevel sets the deflate level, 1 for the fastest to 9 for the smallest, of the
+// data compressed in MODE Z by the server with OPTS MODE Z LEVEL, and by the client for
+// its uploads. Level 0 is rejected: MODE S transfers uncompressed data without the overhead.
+func (ftp *FTP) OptsModeZLevel(n int) (response *Response, err error) {
+	if n < 1 || n > 9 {
+		return nil, fmt.Errorf("%w: MODE Z level %d, not within 1-9", ErrInvalidOption, n)
+	}
+	if response, err = ftp.Opts("MODE Z LEVEL", fmt.Sprint(n)); err != nil {
+		return response, ftp.unavailable(err, "MODE Z", "Setting the compression level", "")
+	}
+	ftp.zLevel = n
+	return
+}
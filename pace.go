@@ -0,0 +1,35 @@
+package ftp4go
+
+import (
+	"math/rand"
+	"time"
+)
+
+// commandPacer spaces the commands sent on the control connection, see SetCommandDelay.
+type commandPacer struct {
+	min, jitter time.Duration
+	last        time.Time // when the last command was sent
+}
+
+// SetCommandDelay spaces the commands sent to the server by at least min plus a random
+// jitter of up to jitter, for fragile embedded servers, such as routers or PLCs, which
+// crash under rapid command sequences. The delay runs from the previous command, a slow
+// reply counts towards it. Both 0, the default, send the commands without delay.
+func (ftp *FTP) SetCommandDelay(min, jitter time.Duration) {
+	ftp.pacer = commandPacer{min: min, jitter: jitter}
+}
+
+// wait sleeps until the next command may be sent.
+func (p *commandPacer) wait() {
+	if p.min <= 0 && p.jitter <= 0 {
+		return
+	}
+	d := p.min
+	if p.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(p.jitter)))
+	}
+	if elapsed := time.Since(p.last); elapsed < d {
+		time.Sleep(d - elapsed)
+	}
+	p.last = time.Now()
+}
@@ -0,0 +1,75 @@
+package ftp4go
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PermissionMapper returns the permissions to set with SITE CHMOD on a file uploaded
+// from localpath, whose local mode is given, ok is false to leave the server default.
+type PermissionMapper func(localpath string, remotename string, mode os.FileMode) (perm os.FileMode, ok bool)
+
+// SetPermissionMapper sets the mapper consulted after each successful file upload,
+// by UploadFileWithOptions and UploadDirTree; nil, the default, never changes permissions.
+func (ftp *FTP) SetPermissionMapper(mapper PermissionMapper) {
+	ftp.permMapper = mapper
+}
+
+// Chmod changes the permissions of a remote file with SITE CHMOD, a non-standard
+// command supported by most Unix servers.
+func (ftp *FTP) Chmod(remotename string, perm os.FileMode) (err error) {
+	_, err = ftp.SendAndRead(SITE_FTP_CMD, "CHMOD", fmt.Sprintf("%03o", perm.Perm()), remotename)
+	return
+}
+
+// applyPermissions consults the permission mapper for an uploaded file.
+func (ftp *FTP) applyPermissions(localpath string, remotename string, fi os.FileInfo) error {
+	if ftp.permMapper == nil || fi == nil {
+		return nil
+	}
+	perm, ok := ftp.permMapper(localpath, remotename, fi.Mode())
+	if !ok {
+		return nil
+	}
+	return ftp.Chmod(remotename, perm)
+}
+
+// PreservePermissions is a PermissionMapper applying the local permissions to the uploaded files.
+func PreservePermissions(localpath string, remotename string, mode os.FileMode) (os.FileMode, bool) {
+	return mode.Perm(), true
+}
+
+// FixedPermissions returns a PermissionMapper applying perm to every uploaded file.
+func FixedPermissions(perm os.FileMode) PermissionMapper {
+	return func(string, string, os.FileMode) (os.FileMode, bool) {
+		return perm, true
+	}
+}
+
+// MaskPermissions returns a PermissionMapper applying the local permissions cleared of the mask bits,
+// e.g. 022 to drop the write permissions of the group and others.
+func MaskPermissions(mask os.FileMode) PermissionMapper {
+	return func(_ string, _ string, mode os.FileMode) (os.FileMode, bool) {
+		return mode.Perm() &^ mask, true
+	}
+}
+
+// SkipExtensions returns a PermissionMapper which leaves the files with one of the
+// extensions, such as ".tmp", alone and consults mapper for the others.
+func SkipExtensions(mapper PermissionMapper, exts ...string) PermissionMapper {
+	skip := make(map[string]bool, len(exts))
+	for _, e := range exts {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		skip[strings.ToLower(e)] = true
+	}
+	return func(localpath string, remotename string, mode os.FileMode) (os.FileMode, bool) {
+		if skip[strings.ToLower(filepath.Ext(localpath))] {
+			return 0, false
+		}
+		return mapper(localpath, remotename, mode)
+	}
+}
@@ -0,0 +1,270 @@
+package ftp4go
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Pool.Get after Close.
+var ErrPoolClosed = errors.New("Pool closed")
+
+// Priority orders the goroutines waiting in Pool.GetPriority for a session: the first
+// session handed back goes to the highest priority, to the longest waiting within a priority.
+type Priority int
+
+const (
+	PriorityBulk   Priority = -1 // large transfers which may wait
+	PriorityNormal Priority = 0  // the priority of Get
+	PriorityUrgent Priority = 1  // small control files, e.g. the markers of DeliverFile
+)
+
+// PriorityAging raises the priority of a waiting GetPriority by a level for every period
+// waited, so that a stream of urgent transfers does not starve the bulk ones.
+var PriorityAging = 10 * time.Second
+
+// DialFunc opens a new connected and logged in session for a Pool.
+type DialFunc func() (*FTP, error)
+
+// Pool shares a bounded number of sessions to the same server between goroutines.
+// A session taken with Get is owned by the caller until it is handed back with Put,
+// or with Discard if it is unusable, for instance after a network error.
+type Pool struct {
+	dial    DialFunc
+	slots   chan struct{} // one token per open or dialing session
+	mu      sync.Mutex
+	idle    []*FTP
+	done    bool
+	gen     int                  // bumped by each SetDial and Rotate
+	gens    map[*FTP]int         // the generation of each open session
+	relogin func(ftp *FTP) error // renews the sessions of a previous generation, see Rotate
+
+	returned chan struct{} // closed when a session is handed back
+	waiters  []*poolWaiter
+	head     *poolWaiter // the waiter served first
+}
+
+// poolWaiter is a goroutine in GetPriority.
+type poolWaiter struct {
+	prio  Priority
+	since time.Time
+}
+
+// rank is the priority of the waiter aged at now.
+func (w *poolWaiter) rank(now time.Time) int64 {
+	r := int64(w.prio)
+	if PriorityAging > 0 {
+		r += int64(now.Sub(w.since) / PriorityAging)
+	}
+	return r
+}
+
+// NewPool returns a pool opening at most size sessions via dial, lazily.
+func NewPool(size int, dial DialFunc) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{dial: dial, slots: make(chan struct{}, size), gens: make(map[*FTP]int)}
+}
+
+// Get returns an idle session or dials a new one, waiting for one to be handed back
+// if the pool is at its size. It is GetPriority with PriorityNormal.
+func (p *Pool) Get() (*FTP, error) {
+	return p.GetPriority(PriorityNormal)
+}
+
+// GetPriority is Get serving the goroutines waiting for a session by priority, see Priority
+// and PriorityAging.
+func (p *Pool) GetPriority(prio Priority) (*FTP, error) {
+	w := &poolWaiter{prio: prio, since: time.Now()}
+	p.mu.Lock()
+	p.waiters = append(p.waiters, w)
+	p.pickHead()
+	p.mu.Unlock()
+	defer p.leave(w)
+
+	for {
+		p.mu.Lock()
+		if p.done {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if p.returned == nil {
+			p.returned = make(chan struct{})
+		}
+		returned := p.returned
+		if p.head != w {
+			p.mu.Unlock()
+			<-returned // outranked, wait for the next session
+			continue
+		}
+		if n := len(p.idle); n > 0 {
+			ftp := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			return ftp, nil
+		}
+		dial, gen := p.dial, p.gen
+		p.mu.Unlock()
+
+		select {
+		case p.slots <- struct{}{}:
+			p.leave(w) // the next waiter may dial meanwhile
+			ftp, err := dial()
+			if err != nil {
+				<-p.slots
+				return nil, err
+			}
+			p.mu.Lock()
+			p.gens[ftp] = gen
+			p.mu.Unlock()
+			return ftp, nil
+		case <-returned:
+			// a session has been handed back or discarded, look again
+		}
+	}
+}
+
+// leave removes w from the waiters, if still there, and wakes up the others.
+func (p *Pool) leave(w *poolWaiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, o := range p.waiters {
+		if o == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			p.signal()
+			return
+		}
+	}
+}
+
+// pickHead elects the waiter served first, called with p.mu held.
+func (p *Pool) pickHead() {
+	p.head = nil
+	now := time.Now()
+	var best int64
+	for _, w := range p.waiters {
+		// the waiters are in arrival order
+		if r := w.rank(now); p.head == nil || r > best {
+			p.head, best = w, r
+		}
+	}
+}
+
+// signal wakes up the goroutines waiting in Get, called with p.mu held.
+func (p *Pool) signal() {
+	p.pickHead()
+	if p.returned != nil {
+		close(p.returned)
+		p.returned = nil
+	}
+}
+
+// Put hands a healthy session back to the pool.
+// A session opened before the last SetDial or Rotate is renewed, or retired, first.
+func (p *Pool) Put(ftp *FTP) {
+	p.mu.Lock()
+	if p.done {
+		p.release(ftp)
+		p.mu.Unlock()
+		ftp.QuitTimeout(DefaultQuitTimeout)
+		return
+	}
+	if gen, relogin := p.gen, p.relogin; p.gens[ftp] != gen {
+		p.mu.Unlock()
+		p.renew(ftp, relogin, gen)
+		return
+	}
+	p.idle = append(p.idle, ftp)
+	p.signal()
+	p.mu.Unlock()
+}
+
+// release frees the place of a closed session, called with p.mu held.
+func (p *Pool) release(ftp *FTP) {
+	delete(p.gens, ftp)
+	<-p.slots
+	p.signal()
+}
+
+// SetDial replaces the function opening the sessions, with rotated credentials for instance,
+// without interrupting the work in progress: the sessions opened from now on use dial, the
+// ones opened before are quit, right away if idle or else once handed back.
+func (p *Pool) SetDial(dial DialFunc) {
+	idle, gen := p.rotate(dial, nil)
+	for _, ftp := range idle {
+		p.renew(ftp, nil, gen)
+	}
+}
+
+// Rotate is SetDial forcing the rotation onto the open sessions: each one opened before is
+// renewed on its connection with relogin, typically a Relogin with the new credentials,
+// right away if idle or else once handed back. A session failing relogin, for lack of
+// REIN for instance, is quit and replaced by a new one on the next Get. The error joins
+// the failures of the idle sessions.
+func (p *Pool) Rotate(dial DialFunc, relogin func(ftp *FTP) error) error {
+	var errs []error
+	idle, gen := p.rotate(dial, relogin)
+	for _, ftp := range idle {
+		errs = append(errs, p.renew(ftp, relogin, gen))
+	}
+	return errors.Join(errs...)
+}
+
+// rotate starts a new generation of sessions and returns it along with the idle sessions, now outdated.
+func (p *Pool) rotate(dial DialFunc, relogin func(ftp *FTP) error) (idle []*FTP, gen int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dial, p.relogin = dial, relogin
+	p.gen++
+	idle, p.idle = p.idle, nil
+	return idle, p.gen
+}
+
+// renew brings a session of a previous generation to generation gen with relogin and hands
+// it back, or quits it if relogin is nil or fails.
+func (p *Pool) renew(ftp *FTP, relogin func(ftp *FTP) error, gen int) (err error) {
+	if relogin != nil {
+		if err = relogin(ftp); err == nil {
+			p.mu.Lock()
+			p.gens[ftp] = gen
+			p.mu.Unlock()
+			p.Put(ftp)
+			return nil
+		}
+		ftp.writeInfo("Unable to renew the session, reconnecting:", err)
+	}
+	p.mu.Lock()
+	p.release(ftp)
+	p.mu.Unlock()
+	ftp.QuitTimeout(DefaultQuitTimeout)
+	return err
+}
+
+// Discard closes a session which should not be reused and frees its place in the pool.
+func (p *Pool) Discard(ftp *FTP) {
+	if ftp.conn != nil {
+		ftp.conn.Close()
+		ftp.setConn(nil)
+	}
+	p.mu.Lock()
+	p.release(ftp)
+	p.mu.Unlock()
+}
+
+// Close quits the idle sessions, the ones in use are quit when handed back.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle, p.done = nil, true
+	p.signal()
+	p.mu.Unlock()
+
+	for _, ftp := range idle {
+		ftp.QuitTimeout(DefaultQuitTimeout)
+		p.mu.Lock()
+		p.release(ftp)
+		p.mu.Unlock()
+	}
+	return nil
+}
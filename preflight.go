@@ -0,0 +1,112 @@
+package ftp4go
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Requirements lists what a job needs from a session, checked by Preflight.
+// The zero value requires nothing.
+type Requirements struct {
+	// WritableDir is a remote folder the job stores files in, checked by uploading and
+	// deleting an empty probe file.
+	WritableDir string
+	// MinFree is the space in bytes the job needs on the server, in WritableDir if set,
+	// checked with AVBL.
+	MinFree int64
+	// Resume requires REST STREAM, to resume the interrupted transfers.
+	Resume bool
+	// Protection is the lowest data protection accepted: ProtPrivate requires the control
+	// and data connections to be protected by TLS, see Secure.
+	Protection ProtLevel
+	// Features are the other features the job relies on, as listed by FEAT, e.g. "MLST".
+	Features []string
+}
+
+// ErrPreflight reports the requirements of a job a session does not meet, all of them.
+type ErrPreflight struct {
+	Failures []error
+}
+
+func (e *ErrPreflight) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, err := range e.Failures {
+		msgs[i] = err.Error()
+	}
+	return "Preflight failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ErrPreflight) Unwrap() []error {
+	return e.Failures
+}
+
+// Preflight checks, right after Login, that the session meets the requirements of a job,
+// so that the job fails before any data moves rather than midway. All the requirements are
+// checked and the unmet ones reported together as *ErrPreflight. FEAT is sent if not yet.
+func (ftp *FTP) Preflight(req Requirements) error {
+	var failures []error
+	fail := func(err error) {
+		ftp.writeInfo("Preflight:", err)
+		failures = append(failures, err)
+	}
+
+	if req.Protection == ProtPrivate && (!ftp.Secured() || ftp.Protection() != ProtPrivate) {
+		fail(errors.New("The session is not protected by TLS, see Secure"))
+	}
+
+	features := req.Features
+	if req.Resume {
+		features = append([]string{"REST STREAM"}, features...)
+	}
+	if len(features) > 0 && ftp.features == nil {
+		if _, err := ftp.Feat(); err != nil {
+			if replyCode(err) < 500 {
+				return err
+			}
+			ftp.features = map[string]string{}
+		}
+	}
+	for _, feature := range features {
+		if !ftp.HasFeature(feature) {
+			fail(&ErrFeatureUnavailable{Feature: feature, Operation: "The job"})
+		}
+	}
+
+	if req.WritableDir != "" {
+		if err := ftp.checkWritableDir(req.WritableDir); err != nil {
+			fail(err)
+		}
+	}
+	if req.MinFree > 0 {
+		avail, err := ftp.Avbl(req.WritableDir)
+		switch {
+		case err != nil:
+			fail(fmt.Errorf("Cannot check the space available on the server: %w", err))
+		case avail < req.MinFree:
+			fail(fmt.Errorf("Insufficient space on the server: %d bytes needed, %d available", req.MinFree, avail))
+		}
+	}
+
+	if len(failures) > 0 {
+		return &ErrPreflight{Failures: failures}
+	}
+	return nil
+}
+
+// checkWritableDir uploads an empty probe file to dir and deletes it.
+func (ftp *FTP) checkWritableDir(dir string) error {
+	b := make([]byte, 4)
+	rand.Read(b)
+	probe := path.Join(dir, ".ftp4go-preflight-"+hex.EncodeToString(b))
+	if err := ftp.Store(probe, strings.NewReader(""), nil); err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	if _, err := ftp.Delete(probe); err != nil {
+		return fmt.Errorf("Cannot delete the probe file %s: %w", probe, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProbeStrategy selects how Exists and IsDir probe a remote path, each way misbehaving
+// on some servers.
+type ProbeStrategy int
+
+const (
+	// ProbeAuto uses MLST if advertised by FEAT, else SIZE if advertised, else LIST.
+	ProbeAuto ProbeStrategy = iota
+	// ProbeMLST sends MLST, whose type fact tells folders apart (RFC 3659).
+	ProbeMLST
+	// ProbeSize sends SIZE, succeeding for files, then CWD and back for folders.
+	ProbeSize
+	// ProbeCwd sends CWD and back, succeeding for folders, then SIZE for files;
+	// for the servers answering SIZE for folders too.
+	ProbeCwd
+	// ProbeList lists the parent folder and looks for the name: the slowest probe,
+	// but the one servers misreporting SIZE or CWD get right.
+	ProbeList
+)
+
+var probeNames = []string{"auto", "mlst", "size", "cwd", "list"}
+
+// String returns the lower case name of the strategy, as written in partner profiles.
+func (s ProbeStrategy) String() string {
+	if s < 0 || int(s) >= len(probeNames) {
+		return fmt.Sprintf("ProbeStrategy(%d)", int(s))
+	}
+	return probeNames[s]
+}
+
+func (s ProbeStrategy) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *ProbeStrategy) UnmarshalText(b []byte) error {
+	for i, name := range probeNames {
+		if strings.EqualFold(string(b), name) {
+			*s = ProbeStrategy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown probe strategy %q", b)
+}
+
+// SetProbeStrategy sets how Exists and IsDir probe paths, to suit a server quirk.
+// The default ProbeAuto chooses according to the features of the server.
+func (ftp *FTP) SetProbeStrategy(strategy ProbeStrategy) {
+	ftp.probe = strategy
+}
+
+// Exists reports whether the remote file or folder exists, see SetProbeStrategy.
+// A path reported unavailable by the server, with a 550 or 450 reply, does not exist;
+// any other failure of the probe is returned.
+func (ftp *FTP) Exists(p string) (bool, error) {
+	exists, _, err := ftp.probePath(p)
+	return exists, err
+}
+
+// IsDir reports whether the remote path exists and is a folder, see Exists.
+func (ftp *FTP) IsDir(p string) (bool, error) {
+	_, dir, err := ftp.probePath(p)
+	return dir, err
+}
+
+func (ftp *FTP) probePath(p string) (exists bool, dir bool, err error) {
+	strategy, err := ftp.probeStrategy()
+	if err != nil {
+		return false, false, err
+	}
+	switch strategy {
+	case ProbeMLST:
+		return ftp.probeMlst(p)
+	case ProbeSize:
+		if exists, err = ftp.probeSize(p); exists || err != nil {
+			return exists, false, err
+		}
+		dir, err = ftp.probeCwd(p)
+		return dir, dir, err
+	case ProbeCwd:
+		if dir, err = ftp.probeCwd(p); dir || err != nil {
+			return dir, dir, err
+		}
+		exists, err = ftp.probeSize(p)
+		return exists, false, err
+	default:
+		fi, err := NewFS(ftp).Stat(p)
+		if errors.Is(err, os.ErrNotExist) || ftp.absent(err) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, fi.IsDir(), nil
+	}
+}
+
+// probeStrategy resolves ProbeAuto, sending FEAT if not done yet.
+func (ftp *FTP) probeStrategy() (ProbeStrategy, error) {
+	if ftp.probe != ProbeAuto {
+		return ftp.probe, nil
+	}
+	if ftp.features == nil {
+		if _, err := ftp.Feat(); err != nil {
+			if replyCode(err) < 500 {
+				return ProbeAuto, err
+			}
+			ftp.features = map[string]string{}
+		}
+	}
+	switch {
+	case ftp.HasFeature("MLST"):
+		return ProbeMLST, nil
+	case ftp.HasFeature("SIZE"):
+		return ProbeSize, nil
+	}
+	return ProbeList, nil
+}
+
+// absent reports whether the probe failed with err because the path is unavailable.
+func (ftp *FTP) absent(err error) bool {
+	code := replyCode(err)
+	return code == StatusFileUnavailable || code == StatusFileActionIgnored
+}
+
+func (ftp *FTP) probeMlst(p string) (exists bool, dir bool, err error) {
+	resp, err := ftp.SendAndRead(MLST_FTP_CMD, p)
+	if ftp.absent(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	// the facts line is the only one starting with a space: " type=dir;modify=...; /path"
+	for _, l := range strings.Split(resp.Message, "\n") {
+		if !strings.HasPrefix(l, " ") {
+			continue
+		}
+		facts, _, _ := strings.Cut(strings.TrimSpace(l), " ")
+		for _, f := range strings.Split(facts, ";") {
+			if k, v, ok := strings.Cut(f, "="); ok && strings.EqualFold(k, "type") {
+				switch strings.ToLower(v) {
+				case "dir", "cdir", "pdir":
+					return true, true, nil
+				}
+			}
+		}
+		return true, false, nil
+	}
+	return true, false, ftp.quirk("MLST reply without facts: %s", resp.Message)
+}
+
+func (ftp *FTP) probeSize(p string) (bool, error) {
+	_, err := ftp.Size(p)
+	if ftp.absent(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (ftp *FTP) probeCwd(p string) (bool, error) {
+	if err := ftp.PushD(p); err != nil {
+		if ftp.absent(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, ftp.PopD()
+}
@@ -0,0 +1,222 @@
+package ftp4go
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// PartnerProfile describes a partner endpoint declaratively: how to reach and log on to it,
+// which folders are exchanged, how the files are named, when and how hard to retry. Services
+// exchanging files with many partners load them with LoadPartnerProfiles and turn each into
+// the options of SessionConfig, Pool, DeliverFile, CollectFiles and SyncDirs.
+type PartnerProfile struct {
+	Name  string `json:"name"`
+	Host  string `json:"host"`
+	Port  int    `json:"port,omitempty"`
+	Proxy string `json:"proxy,omitempty"` // URL of a SOCKS5 proxy
+	User  string `json:"user,omitempty"`
+	// Password references the password rather than holding it: "env:NAME" reads the
+	// environment variable NAME, "file:PATH" the first line of the file PATH.
+	Password string `json:"password,omitempty"`
+	Acct     string `json:"acct,omitempty"`
+	// TLS is "none", the default, or "explicit" for explicit FTPS; ServerName overrides the
+	// name verified in the server certificate and is sent with HOST, see SetServerName.
+	TLS        string `json:"tls,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+
+	RemoteDir  string `json:"remote_dir,omitempty"`
+	LocalDir   string `json:"local_dir,omitempty"`
+	ArchiveDir string `json:"archive_dir,omitempty"` // remote folder collected files are moved to
+
+	Naming   PartnerNaming   `json:"naming"`
+	Schedule PartnerSchedule `json:"schedule"`
+	Retry    PartnerRetry    `json:"retry"`
+	// Conflicts is the sync conflict policy, "keep", the default, "local" or "remote".
+	Conflicts string `json:"conflicts,omitempty"`
+	// Quirks work around the deviations of the server, as reported by CheckConformance.
+	Quirks Quirks `json:"quirks"`
+}
+
+// PartnerNaming are the naming conventions of a partner, see DeliverOptions and CollectOptions.
+type PartnerNaming struct {
+	TempPrefix   string `json:"temp_prefix,omitempty"`
+	TempSuffix   string `json:"temp_suffix,omitempty"`
+	MarkerSuffix string `json:"marker_suffix,omitempty"`
+	NoMarker     bool   `json:"no_marker,omitempty"`
+	Pattern      string `json:"pattern,omitempty"` // path.Match pattern of the files collected
+}
+
+// PartnerSchedule says when to exchange files with a partner, it is up to the caller to honor it.
+type PartnerSchedule struct {
+	Interval ConfigDuration `json:"interval,omitempty"` // time between two runs
+}
+
+// PartnerRetry is the retry policy of a partner, see SetTreeRetries.
+type PartnerRetry struct {
+	Attempts int            `json:"attempts,omitempty"` // retries of a failed file
+	Delay    ConfigDuration `json:"delay,omitempty"`
+}
+
+// ConfigDuration is a time.Duration written in configuration files as a string such as "90s"
+// or "1h30m", or as a number of seconds.
+type ConfigDuration time.Duration
+
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *ConfigDuration) UnmarshalJSON(b []byte) error {
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err == nil {
+		*d = ConfigDuration(secs * float64(time.Second))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("Invalid duration %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ConfigDuration(v)
+	return nil
+}
+
+// LoadPartnerProfiles reads the JSON array of partner profiles of the file name and validates
+// them. Unknown fields are rejected so that a misspelled option does not go unnoticed.
+// YAML files can be loaded once converted to JSON, the field names being the same.
+func LoadPartnerProfiles(name string) ([]*PartnerProfile, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := DecodePartnerProfiles(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return profiles, nil
+}
+
+// DecodePartnerProfiles is LoadPartnerProfiles reading from r.
+func DecodePartnerProfiles(r io.Reader) ([]*PartnerProfile, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var profiles []*PartnerProfile
+	if err := dec.Decode(&profiles); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(profiles))
+	for i, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("Profile %d: %w", i, err)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("Partner %q is defined twice", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return profiles, nil
+}
+
+// Validate checks the profile for missing or invalid values, without resolving the password.
+func (p *PartnerProfile) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("The partner has no name")
+	case p.Host == "":
+		return fmt.Errorf("Partner %q has no host", p.Name)
+	case p.TLS != "" && p.TLS != "none" && p.TLS != "explicit":
+		return fmt.Errorf("Partner %q has an unknown TLS policy %q", p.Name, p.TLS)
+	case p.Password != "" && !strings.HasPrefix(p.Password, "env:") && !strings.HasPrefix(p.Password, "file:"):
+		return fmt.Errorf("Partner %q: the password must be a reference, env:NAME or file:PATH", p.Name)
+	case p.Retry.Attempts < 0 || p.Retry.Delay < 0 || p.Schedule.Interval < 0:
+		return fmt.Errorf("Partner %q has negative retry or schedule values", p.Name)
+	}
+	if _, err := p.conflictPolicy(); err != nil {
+		return fmt.Errorf("Partner %q: %w", p.Name, err)
+	}
+	return nil
+}
+
+// password resolves the password reference.
+func (p *PartnerProfile) password() (string, error) {
+	switch {
+	case p.Password == "":
+		return "", nil
+	case strings.HasPrefix(p.Password, "env:"):
+		name := strings.TrimPrefix(p.Password, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("Partner %q: the environment variable %s is not set", p.Name, name)
+		}
+		return v, nil
+	case strings.HasPrefix(p.Password, "file:"):
+		b, err := os.ReadFile(strings.TrimPrefix(p.Password, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("Partner %q: %w", p.Name, err)
+		}
+		line, _, _ := strings.Cut(string(b), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	}
+	return "", fmt.Errorf("Partner %q: the password must be a reference, env:NAME or file:PATH", p.Name)
+}
+
+func (p *PartnerProfile) conflictPolicy() (ConflictPolicy, error) {
+	switch p.Conflicts {
+	case "", "keep":
+		return ConflictKeep, nil
+	case "local":
+		return ConflictLocalWins, nil
+	case "remote":
+		return ConflictRemoteWins, nil
+	}
+	return ConflictKeep, fmt.Errorf("Unknown conflict policy %q", p.Conflicts)
+}
+
+// SessionConfig returns the configuration of a session to the partner, its password resolved,
+// see WithSession and SessionConfig.Dial. The retry policy is applied by its Setup.
+func (p *PartnerProfile) SessionConfig() (*SessionConfig, error) {
+	password, err := p.password()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &SessionConfig{Host: p.Host, Port: p.Port, Proxy: p.Proxy, ServerName: p.ServerName, User: p.User, Password: password, Acct: p.Acct}
+	if p.TLS == "explicit" {
+		cfg.TLS = true
+		if p.ServerName != "" {
+			cfg.TLSConfig = &tls.Config{ServerName: p.ServerName}
+		}
+	}
+	retry, quirks := p.Retry, p.Quirks
+	cfg.Setup = func(ftp *FTP) error {
+		ftp.SetTreeRetries(retry.Attempts, time.Duration(retry.Delay))
+		return quirks.Apply(ftp)
+	}
+	return cfg, nil
+}
+
+// DeliverOptions returns the options of DeliverFile following the naming conventions of the partner.
+func (p *PartnerProfile) DeliverOptions() *DeliverOptions {
+	n := p.Naming
+	return &DeliverOptions{TempPrefix: n.TempPrefix, TempSuffix: n.TempSuffix, MarkerSuffix: n.MarkerSuffix, NoMarker: n.NoMarker}
+}
+
+// CollectOptions returns the options of CollectFiles following the naming conventions of the partner.
+func (p *PartnerProfile) CollectOptions() *CollectOptions {
+	n := p.Naming
+	return &CollectOptions{MarkerSuffix: n.MarkerSuffix, NoMarker: n.NoMarker, Pattern: n.Pattern, ArchiveDir: p.ArchiveDir}
+}
+
+// SyncOptions returns the options of SyncDirs with the conflict policy of the partner.
+func (p *PartnerProfile) SyncOptions() *SyncOptions {
+	policy, _ := p.conflictPolicy()
+	return &SyncOptions{Conflicts: policy}
+}
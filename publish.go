@@ -0,0 +1,175 @@
+package ftp4go
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// PublishSwap selects how PublishDir puts the staged folder in place of the previous release.
+type PublishSwap int
+
+const (
+	// PublishRename renames the staged folder to the final path, which must not exist.
+	PublishRename PublishSwap = iota
+	// PublishReplace renames the previous release out of the way first, to a hidden backup
+	// next to it, then the staged folder in place, and removes the backup unless kept.
+	// Between the two renames the final path is briefly missing, never partial.
+	PublishReplace
+	// PublishSymlink keeps the releases side by side, named after the final path and the
+	// time, and flips the final path, a symbolic link, to the new one with SITE SYMLINK,
+	// see Symlink. The link is briefly missing, between its deletion and its creation.
+	PublishSymlink
+)
+
+// PublishOptions configures PublishDir, the zero value renames into a new final path.
+type PublishOptions struct {
+	Swap         PublishSwap
+	KeepPrevious bool     // PublishReplace: keep the previous release as the backup instead of removing it
+	Callback     Callback // progress of the uploads
+}
+
+// PublishResult describes a release published by PublishDir.
+type PublishResult struct {
+	Path     string // the folder holding the release: the final path, or the release folder it links to
+	Previous string // the backup kept by KeepPrevious, or the release the link pointed to before, if any
+	Files    int    // files uploaded
+}
+
+// PublishDir uploads the contents of localDir as the remote folder remoteFinalPath, so that
+// consumers never observe a partial release: everything is uploaded like UploadDirTree into a
+// staging folder created with MkTempRemote next to the final path, then swapped in according to
+// opts, which may be nil. A failed upload removes the staging folder and leaves the previous
+// release untouched.
+func (ftp *FTP) PublishDir(localDir string, remoteFinalPath string, opts *PublishOptions) (res *PublishResult, err error) {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	remoteFinalPath = path.Clean(remoteFinalPath)
+	parent, name := path.Split(remoteFinalPath)
+	if parent == "" {
+		parent = "."
+	}
+	if opts.Swap == PublishSymlink {
+		// fail before uploading anything
+		if err = ftp.symlinkSupported(); err != nil {
+			return nil, err
+		}
+	}
+
+	stage, err := ftp.MkTempRemote(parent, "."+name+".stage-")
+	if err != nil {
+		return nil, err
+	}
+	res = &PublishResult{}
+	// UploadDirTree creates the local folder itself in the stage
+	staged := path.Join(stage, filepath.Base(filepath.Clean(localDir)))
+	defer func() {
+		if err != nil {
+			ftp.writeInfo("Publishing", remoteFinalPath, "failed, removing the staging folder:", err)
+			if _, err1 := ftp.RemoveRemoteTree(stage, nil); err1 != nil {
+				ftp.writeInfo("Unable to clean up", stage, ":", err1)
+			}
+			return
+		}
+		if _, err1 := ftp.Rmd(stage); err1 != nil {
+			ftp.writeInfo("Unable to clean up", stage, ":", err1)
+		}
+	}()
+	if res.Files, err = ftp.UploadDirTree(localDir, stage, 1, nil, opts.Callback); err != nil {
+		return nil, err
+	}
+
+	switch opts.Swap {
+	case PublishReplace:
+		err = ftp.publishReplace(staged, remoteFinalPath, opts.KeepPrevious, res)
+	case PublishSymlink:
+		err = ftp.publishSymlink(staged, remoteFinalPath, res)
+	default:
+		if _, err = ftp.Rename(staged, remoteFinalPath); err == nil {
+			res.Path = remoteFinalPath
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	ftp.writeInfo("Published", res.Files, "files to", res.Path)
+	return res, nil
+}
+
+// publishReplace swaps the staged folder with the previous release at final.
+func (ftp *FTP) publishReplace(staged string, final string, keep bool, res *PublishResult) error {
+	exists, err := ftp.Exists(final)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err = ftp.Rename(staged, final); err != nil {
+			return err
+		}
+		res.Path = final
+		return nil
+	}
+	parent, name := path.Split(final)
+	backup := path.Join(parent, fmt.Sprintf(".%s.previous-%s", name, time.Now().UTC().Format("20060102T150405Z")))
+	if _, err = ftp.Rename(final, backup); err != nil {
+		return err
+	}
+	if _, err = ftp.Rename(staged, final); err != nil {
+		// put the previous release back
+		if _, err1 := ftp.Rename(backup, final); err1 != nil {
+			ftp.writeInfo("Unable to restore", final, "from", backup, ":", err1)
+		}
+		return err
+	}
+	res.Path = final
+	if keep {
+		res.Previous = backup
+		return nil
+	}
+	if _, err = ftp.RemoveRemoteTree(backup, nil); err != nil {
+		// the release is published, a leftover backup is not a failure
+		ftp.writeInfo("Unable to remove the previous release", backup, ":", err)
+	}
+	return nil
+}
+
+// publishSymlink moves the staged folder next to the link final and flips the link to it.
+// On failure the release is moved back into the staging folder, which PublishDir removes.
+func (ftp *FTP) publishSymlink(staged string, final string, res *PublishResult) error {
+	parent, name := path.Split(final)
+	release := path.Join(parent, name+"-"+time.Now().UTC().Format("20060102T150405Z"))
+	if _, err := ftp.Rename(staged, release); err != nil {
+		return err
+	}
+	unstage := func() {
+		if _, err := ftp.Rename(release, staged); err == nil {
+			return
+		}
+		if _, err := ftp.RemoveRemoteTree(release, nil); err != nil {
+			ftp.writeInfo("Unable to clean up", release, ":", err)
+		}
+	}
+	if fi, err := NewFS(ftp).Stat(final); err == nil {
+		if e := fi.Sys().(*Entry); e.Type == EntryTypeLink {
+			res.Previous = e.Target
+		}
+		if _, err = ftp.Delete(final); err != nil {
+			unstage()
+			return err
+		}
+	}
+	// relative, the releases stay valid if the tree is moved
+	if err := ftp.Symlink(path.Base(release), final); err != nil {
+		if res.Previous != "" {
+			if err1 := ftp.Symlink(res.Previous, final); err1 != nil {
+				ftp.writeInfo("Unable to restore the link", final, "to", res.Previous, ":", err1)
+			}
+		}
+		unstage()
+		return err
+	}
+	res.Path = release
+	return nil
+}
@@ -0,0 +1,80 @@
+package ftp4go
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateGroup caps the combined rate of all the transfers sharing it, whatever the number
+// of sessions running them, for instance to bound the egress of an application mirroring
+// to several servers at once. It is safe for concurrent use.
+type RateGroup struct {
+	mu   sync.Mutex
+	rate int64     // bytes per second, <= 0 for no limit
+	next time.Time // when the bytes accounted for so far are due
+}
+
+// NewRateGroup returns a group limited to rate bytes per second, <= 0 for no limit.
+func NewRateGroup(rate int64) *RateGroup {
+	return &RateGroup{rate: rate}
+}
+
+// SetRate changes the limit of the group, it applies to the running transfers too.
+func (rg *RateGroup) SetRate(rate int64) {
+	rg.mu.Lock()
+	rg.rate = rate
+	rg.mu.Unlock()
+}
+
+// limit returns the rate of the group, 0 for a nil group.
+func (rg *RateGroup) limit() int64 {
+	if rg == nil {
+		return 0
+	}
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	return rg.rate
+}
+
+// reserve accounts for n bytes and returns how long their transfer must wait.
+// A group idle for a while does not build up credit for a burst.
+func (rg *RateGroup) reserve(n int) time.Duration {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	if rg.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if rg.next.Before(now) {
+		rg.next = now
+	}
+	rg.next = rg.next.Add(time.Duration(int64(n) * int64(time.Second) / rg.rate))
+	return rg.next.Sub(now)
+}
+
+// SetRateGroups makes the uploads and the downloads of the session share the limits of
+// the given groups, on top of their own TransferOptions.RateLimit; nil for no group.
+// The same group may be set for both directions and on any number of sessions.
+func (ftp *FTP) SetRateGroups(upload, download *RateGroup) {
+	ftp.upGroup, ftp.downGroup = upload, download
+}
+
+// sleep waits for d, or until ctx is done if it is not nil.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-t.C:
+		return nil
+	case <-done:
+		return ctx.Err()
+	}
+}
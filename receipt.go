@@ -0,0 +1,109 @@
+package ftp4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Receipt lists the files delivered by an UploadDirTree call, for downstream consumers.
+type Receipt struct {
+	LocalRoot  string         `json:"local_root"`
+	RemoteRoot string         `json:"remote_root"`
+	Started    time.Time      `json:"started"`
+	Finished   time.Time      `json:"finished"`
+	Files      []*ReceiptFile `json:"files"`
+	Error      string         `json:"error,omitempty"`   // set if the upload failed, the files listed were delivered nonetheless
+	Failure    *ErrFileFailed `json:"failure,omitempty"` // the file the upload failed on, if any
+	Skipped    []*ReceiptSkip `json:"skipped,omitempty"` // the files and folders left out, see SetTreeSkipPolicy
+}
+
+// ReceiptSkip describes a file or folder UploadDirTree left out.
+type ReceiptSkip struct {
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+	Reason     string `json:"reason"`          // see SkipReason
+	Error      string `json:"error,omitempty"` // why an unreadable file could not be read
+}
+
+// ReceiptFile describes a delivered file.
+type ReceiptFile struct {
+	RemotePath string    `json:"remote_path"`
+	LocalPath  string    `json:"local_path"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"` // sha256 of the local file, hex encoded
+	Time       time.Time `json:"time"`     // end of the upload
+
+	// DuplicateOf is the remote path of the identical file delivered first, for a duplicate
+	// copied on the server or only recorded, see SetTreeDedup.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// ReceiptOptions configures the receipts of UploadDirTree, see SetUploadReceipt.
+type ReceiptOptions struct {
+	Writer     io.Writer // receives the JSON receipt of every UploadDirTree call, if set
+	RemoteName string    // the receipt is uploaded under this name, relative to the remote root folder, as the last file of a successful upload, if set
+}
+
+// SetUploadReceipt makes UploadDirTree produce a Receipt of the files it delivers, written
+// and uploaded as configured by opts; the last one is also available from LastReceipt.
+// A nil opts turns the receipts off.
+func (ftp *FTP) SetUploadReceipt(opts *ReceiptOptions) {
+	ftp.receiptOpts = opts
+}
+
+// LastReceipt returns the receipt of the last UploadDirTree call, nil if SetUploadReceipt is not set.
+func (ftp *FTP) LastReceipt() *Receipt {
+	return ftp.receipt
+}
+
+// addToReceipt records a delivered file in the running receipt, if any, duplicateOf is
+// the remote path of the file it duplicates, see SetTreeDedup.
+func (ftp *FTP) addToReceipt(remotepath string, localpath string, duplicateOf string) error {
+	if ftp.receipt == nil {
+		return nil
+	}
+	size, sum, err := ftp.fileChecksum(localpath)
+	if err != nil {
+		return err
+	}
+	ftp.receipt.Files = append(ftp.receipt.Files, &ReceiptFile{
+		RemotePath:  remotepath,
+		LocalPath:   localpath,
+		Size:        size,
+		Checksum:    sum,
+		Time:        time.Now().UTC(),
+		DuplicateOf: duplicateOf,
+	})
+	return nil
+}
+
+// finishReceipt completes the running receipt with the outcome of the upload, writes it and,
+// if the upload succeeded, uploads it to the current remote folder.
+func (ftp *FTP) finishReceipt(uploadErr error) error {
+	r := ftp.receipt
+	if r == nil {
+		return uploadErr
+	}
+	r.Finished = time.Now().UTC()
+	if uploadErr != nil {
+		r.Error = uploadErr.Error()
+		errors.As(uploadErr, &r.Failure)
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if w := ftp.receiptOpts.Writer; w != nil {
+		if _, err = w.Write(b); err != nil && uploadErr == nil {
+			return err
+		}
+	}
+	if uploadErr != nil || ftp.receiptOpts.RemoteName == "" {
+		return uploadErr
+	}
+	return ftp.Store(ftp.receiptOpts.RemoteName, bytes.NewReader(b), nil)
+}
@@ -0,0 +1,59 @@
+package ftp4go
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ReplyError returns the error the client reports for a reply, nil for a positive one:
+// *ErrStorage for 452 and 552, *ErrFileName for 553, an *Error with the code and text of
+// the other 4yz and 5yz replies, and a protocol error for any other code.
+// ReplyCode is its inverse, for the servers built on the package.
+func ReplyError(code int, msg string) error {
+	switch {
+	case code >= 100 && code < 400:
+		return nil
+	case code == Status452 || code == StatusExceededStorage:
+		return &ErrStorage{Code: code, Msg: msg}
+	case code == StatusBadFileName:
+		return &ErrFileName{Msg: msg}
+	case code >= 400 && code < 600:
+		return &Error{Code: code, Msg: msg}
+	}
+	return errors.New("Protocol error: " + msg)
+}
+
+// ReplyCode returns the negative reply a server sends for err, which ReplyError maps back
+// to an error of the same class: the code of an *Error or *ErrStorage, 553 for *ErrFileName,
+// 502 for *ErrFeatureUnavailable, 426 for a stopped transfer, 550 for a missing file, a
+// file existing already or a denied permission, 501 for an invalid argument, and 451, a
+// local error worth retrying, for any other error. It returns 0 for a nil error.
+func ReplyCode(err error) int {
+	var (
+		replyErr    *Error
+		storageErr  *ErrStorage
+		fileNameErr *ErrFileName
+		featureErr  *ErrFeatureUnavailable
+		stoppedErr  *ErrTransferStopped
+		partialErr  *ErrPartialTransfer
+	)
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &replyErr) && replyErr.Code >= 400 && replyErr.Code < 600:
+		return replyErr.Code
+	case errors.As(err, &storageErr):
+		return storageErr.Code
+	case errors.As(err, &fileNameErr):
+		return StatusBadFileName
+	case errors.As(err, &featureErr):
+		return StatusNotImplemented
+	case errors.As(err, &stoppedErr), errors.As(err, &partialErr):
+		return StatusTransfertAborted
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrExist), errors.Is(err, fs.ErrPermission):
+		return StatusFileUnavailable
+	case errors.Is(err, fs.ErrInvalid):
+		return StatusBadArguments
+	}
+	return StatusActionAborted
+}
@@ -0,0 +1,191 @@
+// Package replyparse parses the text of FTP replies: the data addresses of PASV replies,
+// the sizes announced by 150 and 125 replies, the quoted names of 257 replies,
+// the directories some servers name in 250 replies to CWD, the feature lists
+// of FEAT replies, the subcommands of SITE HELP replies and the time values of MDTM replies.
+// It is the parser used by ftp4go, exported for proxies, test servers and log analyzers
+// handling the same replies.
+//
+// The functions take the reply text without its code, they do not check the code.
+package replyparse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformed is wrapped by the errors about a reply text not holding the expected value.
+	ErrMalformed = errors.New("replyparse: malformed reply")
+	// ErrUnquoted is returned by Dirname for a 257 reply whose text does not start with
+	// a quoted name, as sent by some UNIX servers in violation of RFC 959.
+	ErrUnquoted = errors.New("replyparse: unquoted directory name")
+)
+
+var (
+	rePasv       = regexp.MustCompile(`([0-9]+) *, *([0-9]+) *, *([0-9]+) *, *([0-9]+) *, *([0-9]+) *, *([0-9]+)`)
+	rePasvStrict = regexp.MustCompile(`\(([0-9]{1,3}),([0-9]{1,3}),([0-9]{1,3}),([0-9]{1,3}),([0-9]{1,3}),([0-9]{1,3})\)`)
+	reSize       = regexp.MustCompile(`\(([0-9]+) bytes\)`)
+	reSiteCmd    = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+)
+
+// Pasv returns the host and port of the h1,h2,h3,h4,p1,p2 address of a 227 reply to PASV,
+// e.g. "Entering Passive Mode (192,168,1,2,19,137)". As RFC 1123 advises, the address is
+// scanned for anywhere in the text: enclosed in parentheses or not, after any leading text
+// and with spaces around the commas, as nonconforming servers send it.
+func Pasv(msg string) (host string, port int, err error) {
+	return pasv(rePasv, msg)
+}
+
+// PasvStrict is Pasv only accepting the address in the RFC 959 form: in parentheses,
+// without spaces. It serves to detect the servers Pasv works around.
+func PasvStrict(msg string) (host string, port int, err error) {
+	return pasv(rePasvStrict, msg)
+}
+
+func pasv(re *regexp.Regexp, msg string) (host string, port int, err error) {
+	m := re.FindStringSubmatch(msg)
+	if m == nil {
+		return "", 0, fmt.Errorf("%w: no address in %q", ErrMalformed, msg)
+	}
+	numbers := m[1:]
+	for _, n := range numbers {
+		if v, err := strconv.Atoi(n); err != nil || v > 255 {
+			return "", 0, fmt.Errorf("%w: invalid address in %q", ErrMalformed, msg)
+		}
+	}
+	host = strings.Join(numbers[:4], ".")
+	p1, _ := strconv.Atoi(numbers[4])
+	p2, _ := strconv.Atoi(numbers[5])
+	return host, p1<<8 + p2, nil
+}
+
+// FormatPasv formats an IPv4 host and a port as the h1,h2,h3,h4,p1,p2 address of PASV
+// replies and PORT commands.
+func FormatPasv(host string, port int) (string, error) {
+	ip := net.ParseIP(host).To4()
+	if ip == nil || port < 0 || port > 0xffff {
+		return "", fmt.Errorf("%w: %s:%d has no PASV form", ErrMalformed, host, port)
+	}
+	return fmt.Sprintf("%d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff), nil
+}
+
+// ReplacePasv returns the text of a 227 reply with its address replaced by host and port,
+// as a proxy relaying the data connections does.
+func ReplacePasv(msg string, host string, port int) (string, error) {
+	loc := rePasv.FindStringIndex(msg)
+	if loc == nil {
+		return "", fmt.Errorf("%w: no address in %q", ErrMalformed, msg)
+	}
+	addr, err := FormatPasv(host, port)
+	if err != nil {
+		return "", err
+	}
+	return msg[:loc[0]] + addr + msg[loc[1]:], nil
+}
+
+// TransferSize returns the size announced by a 150 or 125 reply to RETR, e.g.
+// "Opening BINARY mode data connection for file (1024 bytes)"; ok is false if there is none,
+// as the size is optional.
+func TransferSize(msg string) (size int64, ok bool) {
+	m := reSize.FindStringSubmatch(msg)
+	if m == nil {
+		return -1, false
+	}
+	size, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return -1, false
+	}
+	return size, true
+}
+
+// Dirname returns the directory name of a 257 reply to PWD or MKD: it is enclosed in double
+// quotes, a quote inside the name being doubled as per RFC 959, and followed by free text.
+func Dirname(msg string) (string, error) {
+	msg = strings.TrimLeft(msg, " ")
+	if !strings.HasPrefix(msg, "\"") {
+		return "", ErrUnquoted
+	}
+	var b strings.Builder
+	for i := 1; i < len(msg); i++ {
+		c := msg[i]
+		if c == '"' {
+			if i+1 < len(msg) && msg[i+1] == '"' {
+				i++ // quoted pair
+			} else {
+				return b.String(), nil
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", fmt.Errorf("%w: unterminated directory name in %q", ErrMalformed, msg)
+}
+
+// reCwd matches the unquoted directory of a 250 reply, e.g. "Directory changed to /a b" or
+// "OK. Current directory is /a b".
+var reCwd = regexp.MustCompile(`(?i)(?:directory is|changed to|directory now)\s+(/.*?)\.?\s*$`)
+
+// CwdDirname returns the directory named by a 250 reply to CWD, which RFC 959 leaves free
+// text: a quoted name is read as by Dirname, otherwise an absolute path ending the reply
+// after words such as "changed to". ok is false if the reply names no directory.
+func CwdDirname(msg string) (dir string, ok bool) {
+	if i := strings.IndexByte(msg, '"'); i >= 0 {
+		dir, err := Dirname(msg[i:])
+		return dir, err == nil && dir != ""
+	}
+	if m := reCwd.FindStringSubmatch(msg); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// Features returns the feature lines of a 211 reply to FEAT, e.g. "MDTM" or "REST STREAM",
+// trimmed and without the lines carrying the reply code.
+func Features(msg string) []string {
+	var list []string
+	for _, l := range strings.Split(msg, "\n") {
+		l = strings.TrimSpace(l)
+		if len(l) > 0 && !strings.HasPrefix(l, "211") {
+			list = append(list, l)
+		}
+	}
+	return list
+}
+
+// SiteCommands returns the SITE subcommands listed by a 214 reply to SITE HELP, in upper
+// case, e.g. CHMOD and UTIME. Both the single line list of vsftpd, "CHMOD UMASK HELP", and
+// the multiline tables of wu-ftpd, ProFTPD and Pure-FTPd, between a header and a trailer
+// line, are recognized. Commands marked unimplemented with a trailing * are left out.
+func SiteCommands(msg string) []string {
+	lines := strings.Split(strings.ReplaceAll(msg, "\r", ""), "\n")
+	if len(lines) > 2 {
+		lines = lines[1 : len(lines)-1]
+	}
+	var list []string
+	for _, l := range lines {
+		for _, f := range strings.Fields(l) {
+			if reSiteCmd.MatchString(f) {
+				list = append(list, f)
+			}
+		}
+	}
+	return list
+}
+
+// ModTime parses the YYYYMMDDHHMMSS[.sss] time value of MDTM replies and MLSD modify
+// facts, in UTC. The fraction of a second is dropped.
+func ModTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = s[:i]
+	}
+	t, err := time.Parse("20060102150405", s)
+	if err != nil {
+		return t, fmt.Errorf("%w: invalid time value %q", ErrMalformed, s)
+	}
+	return t, nil
+}
@@ -0,0 +1,156 @@
+package replyparse
+
+import (
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasv(t *testing.T) {
+	tests := []struct {
+		msg  string
+		host string
+		port int
+		ok   bool
+	}{
+		{"Entering Passive Mode (192,168,1,2,19,137)", "192.168.1.2", 19<<8 + 137, true},
+		{"Entering Passive Mode 10,0,0,1,4,1.", "10.0.0.1", 1025, true},
+		{"=127,0,0,1,0,21", "127.0.0.1", 21, true},
+		{"Entering Passive Mode", "", 0, false},
+		{"Entering Passive Mode (300,0,0,1,4,1)", "", 0, false},
+	}
+	for _, tt := range tests {
+		host, port, err := Pasv(tt.msg)
+		if (err == nil) != tt.ok || host != tt.host || port != tt.port {
+			t.Errorf("Pasv(%q) = %q, %d, %v", tt.msg, host, port, err)
+		}
+		if err != nil && !errors.Is(err, ErrMalformed) {
+			t.Errorf("Pasv(%q) error %v does not wrap ErrMalformed", tt.msg, err)
+		}
+	}
+
+	got, err := ReplacePasv("227 Entering Passive Mode (10,0,0,1,4,1).", "127.0.0.1", 40000)
+	if want := "227 Entering Passive Mode (127,0,0,1,156,64)."; err != nil || got != want {
+		t.Errorf("ReplacePasv = %q, %v, want %q", got, err, want)
+	}
+	if _, err := FormatPasv("::1", 21); !errors.Is(err, ErrMalformed) {
+		t.Errorf("FormatPasv of an IPv6 host should fail, got %v", err)
+	}
+}
+
+func TestTransferSize(t *testing.T) {
+	if size, ok := TransferSize("Opening BINARY mode data connection for a.txt (1024 bytes)"); !ok || size != 1024 {
+		t.Errorf("TransferSize = %d, %v", size, ok)
+	}
+	if size, ok := TransferSize("Here comes the file"); ok || size != -1 {
+		t.Errorf("TransferSize without size = %d, %v", size, ok)
+	}
+}
+
+func TestDirname(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+		err  error
+	}{
+		{`"/home/user" is the current directory`, "/home/user", nil},
+		{` "/a ""quoted"" dir" created`, `/a "quoted" dir`, nil},
+		{`"/unterminated`, "", ErrMalformed},
+		{`/home/user`, "", ErrUnquoted},
+	}
+	for _, tt := range tests {
+		got, err := Dirname(tt.msg)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Dirname(%q) = %q, %v, want %q, %v", tt.msg, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestCwdDirname(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+		ok   bool
+	}{
+		{`"/a b" is the current directory`, "/a b", true},
+		{`CWD command successful. "/x ""y""" is current directory.`, `/x "y"`, true},
+		{`Directory changed to /a b`, "/a b", true},
+		{`OK. Current directory is /a b.`, "/a b", true},
+		{`Directory successfully changed.`, "", false},
+		{`CWD command successful`, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := CwdDirname(tt.msg); got != tt.want || ok != tt.ok {
+			t.Errorf("CwdDirname(%q) = %q, %v, want %q, %v", tt.msg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	got := Features("211-Features:\r\n MDTM\r\n REST STREAM\r\n SIZE\r\n211 End")
+	if want := []string{"MDTM", "REST STREAM", "SIZE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Features = %q, want %q", got, want)
+	}
+}
+
+func TestSiteCommands(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want []string
+	}{
+		{"CHMOD UMASK HELP", []string{"CHMOD", "UMASK", "HELP"}}, // vsftpd
+		{"The following SITE commands are recognized (* =>'s unimplemented)\n CHMOD\n CHGRP\n UTIME\n SYMLINK\n HELP\nDirect comments to root@localhost", []string{"CHMOD", "CHGRP", "UTIME", "SYMLINK", "HELP"}},                                               // ProFTPD
+		{"The following SITE commands are recognized (* =>'s unimplemented).\n   UMASK           GROUP           INDEX*\n   IDLE            CHMOD           HELP\nDirect comments to ftp-bugs@localhost.", []string{"UMASK", "GROUP", "IDLE", "CHMOD", "HELP"}}, // wu-ftpd
+		{"Direct comments to root@localhost", nil},
+	}
+	for _, tt := range tests {
+		if got := SiteCommands(tt.msg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SiteCommands(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestModTime(t *testing.T) {
+	got, err := ModTime("20240102030405.123")
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); err != nil || !got.Equal(want) {
+		t.Errorf("ModTime = %v, %v, want %v", got, err, want)
+	}
+	if _, err := ModTime("yesterday"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ModTime of an invalid value should fail, got %v", err)
+	}
+}
+
+func TestPasvCorpus(t *testing.T) {
+	data, err := os.ReadFile("testdata/pasv.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.SplitN(line, "\t", 3)
+		want, strict, msg := f[0], f[1] == "y", f[2]
+		got := "-"
+		if host, port, err := Pasv(msg); err == nil {
+			got = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if !errors.Is(err, ErrMalformed) {
+			t.Errorf("Pasv(%q) error %v does not wrap ErrMalformed", msg, err)
+		}
+		if got != want {
+			t.Errorf("Pasv(%q) = %s, want %s", msg, got, want)
+		}
+		host, port, err := PasvStrict(msg)
+		if (err == nil) != strict {
+			t.Errorf("PasvStrict(%q) = %q, %d, %v", msg, host, port, err)
+		}
+		if err == nil && net.JoinHostPort(host, strconv.Itoa(port)) != want {
+			t.Errorf("PasvStrict(%q) = %s:%d, want %s", msg, host, port, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	// DefaultSegments is the number of parts of a segmented download.
+	DefaultSegments = 4
+	// DefaultMinSegment is the smallest part of a segmented download, smaller files take fewer parts.
+	DefaultMinSegment = 8 << 20
+)
+
+// SegmentedOptions configures DownloadSegmented, the zero value picks the defaults.
+type SegmentedOptions struct {
+	Segments   int   // parts downloaded in parallel, DefaultSegments if 0
+	MinSegment int64 // smallest part, DefaultMinSegment if 0
+	// Mmap writes the parts straight into a memory mapping of the local file, on the platforms
+	// supporting it, rather than through WriteAt: the data is read from the data connections
+	// into the page cache with no intermediate buffer. Elsewhere it is ignored. The local file
+	// system must have room for the whole file up front, a full disk failing the part written.
+	Mmap bool
+}
+
+// DownloadSegmented downloads a remote file to a local path in parts transferred in parallel
+// over sessions of pool, each part restarting the download at its offset with REST and aborting
+// it at its end: multi-GB files go faster over links where a single connection is throttled.
+// The local file is replaced, sized to the remote one up front. The sessions aborting their
+// transfer are discarded rather than handed back, some servers sending a late reply. A failed
+// part fails the download, leaving the local file incomplete.
+func DownloadSegmented(pool *Pool, remotename string, localpath string, opts *SegmentedOptions) (err error) {
+	if opts == nil {
+		opts = &SegmentedOptions{}
+	}
+	ftp, err := pool.Get()
+	if err != nil {
+		return err
+	}
+	size, err := ftp.Size(remotename)
+	if err != nil {
+		pool.Put(ftp)
+		return err
+	}
+	parts := segments(int64(size), opts)
+
+	os.Remove(localpath)
+	f, err := os.OpenFile(localpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		pool.Put(ftp)
+		return err
+	}
+	defer func() {
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+	}()
+	if err = f.Truncate(int64(size)); err != nil || size == 0 {
+		pool.Put(ftp)
+		return err
+	}
+
+	var data []byte
+	if opts.Mmap {
+		// the file is sparse, writing a page the disk has no room for would fault
+		if err = CheckLocalSpace(filepath.Dir(localpath), int64(size)); err != nil {
+			pool.Put(ftp)
+			return err
+		}
+		var unmap func() error
+		if data, unmap, err = mmapFile(f, int64(size)); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			pool.Put(ftp)
+			return err
+		}
+		if unmap != nil {
+			defer func() {
+				if err1 := unmap(); err == nil {
+					err = err1
+				}
+			}()
+		}
+	}
+
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		session := ftp
+		if i > 0 {
+			if session, err = pool.Get(); err != nil {
+				errs[i] = err
+				break
+			}
+		}
+		wg.Add(1)
+		go func(i int, session *FTP, part [2]int64) {
+			defer wg.Done()
+			var dst []byte
+			if data != nil {
+				dst = data[part[0]:part[1]]
+			}
+			errs[i] = downloadSegment(pool, session, remotename, part[0], part[1], int64(size), dst, f)
+		}(i, session, part)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// segments splits size bytes into the parts of a segmented download, as [start, end) pairs.
+func segments(size int64, opts *SegmentedOptions) [][2]int64 {
+	n, smallest := int64(opts.Segments), opts.MinSegment
+	if n <= 0 {
+		n = DefaultSegments
+	}
+	if smallest <= 0 {
+		smallest = DefaultMinSegment
+	}
+	if size/smallest < n {
+		n = size / smallest
+	}
+	if n < 1 {
+		n = 1
+	}
+	parts := make([][2]int64, n)
+	for i := range parts {
+		parts[i] = [2]int64{size * int64(i) / n, size * int64(i+1) / n}
+	}
+	return parts
+}
+
+// downloadSegment downloads the bytes [start, end) of the remote file with session into dst,
+// the mapping of the part, or else at their offset in f. The session is then handed back to
+// the pool or discarded.
+func downloadSegment(pool *Pool, session *FTP, remotename string, start, end, size int64, dst []byte, f *os.File) error {
+	r, err := NewFS(session).OpenAt(remotename, start)
+	if err != nil {
+		pool.Put(session)
+		return err
+	}
+	var n int64
+	if dst != nil {
+		var m int
+		m, err = readMapped(r, dst)
+		n = int64(m)
+	} else {
+		n, err = io.CopyN(io.NewOffsetWriter(f, start), r, end-start)
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = fmt.Errorf("Segment %d-%d of %s ended after %d bytes", start, end, remotename, n)
+	}
+	err1 := r.Close()
+	switch {
+	case end < size:
+		// aborted, answered with 426 or 226, maybe both
+		pool.Discard(session)
+	case err1 != nil && replyCode(err1) < 400:
+		pool.Discard(session)
+	default:
+		pool.Put(session)
+	}
+	if err == nil && end == size {
+		err = err1
+	}
+	return err
+}
+
+// readMapped fills dst, a part of a memory mapping, from r. A page the file system can not
+// back, the disk being full, fails with an error rather than crashing the program.
+func readMapped(r io.Reader, dst []byte) (n int, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if p := recover(); p != nil {
+			fault, ok := p.(interface{ Addr() uintptr })
+			if !ok {
+				panic(p)
+			}
+			err = fmt.Errorf("Unable to write the mapped file at address %#x: %v", fault.Addr(), p)
+		}
+	}()
+	return io.ReadFull(r, dst)
+}
@@ -0,0 +1,659 @@
+package ftp4go
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer is a minimal in-memory FTP server used by the unit tests and benchmarks.
+// Each verb can be overridden via handle to mimic the quirks of a specific server.
+type testServer struct {
+	t        testing.TB
+	ln       net.Listener
+	mu       sync.Mutex
+	files    map[string][]byte    // absolute path -> content
+	mtimes   map[string]time.Time // absolute path -> last modification
+	dirs     map[string]bool      // absolute path -> exists
+	feats    []string
+	greeting string // raw greeting sent instead of the 220 reply, if set
+	handlers map[string]testHandler
+	wg       sync.WaitGroup
+}
+
+// testHandler handles a single command on a test server connection.
+type testHandler func(c *testServerConn, arg string)
+
+// testServerConn is the state of a single control connection.
+type testServerConn struct {
+	s      *testServer
+	conn   net.Conn
+	tp     *textproto.Conn
+	cwd    string
+	pasv   net.Listener
+	port   string
+	offset int64
+	rnfr   string
+	modeZ  bool
+	prot   string // data protection level set by PROT
+}
+
+func newTestServer(t testing.TB) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start the test server: %v", err)
+	}
+	s := &testServer{
+		t:        t,
+		ln:       ln,
+		files:    make(map[string][]byte),
+		mtimes:   make(map[string]time.Time),
+		dirs:     map[string]bool{"/": true},
+		handlers: make(map[string]testHandler),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c := &testServerConn{s: s, conn: conn, tp: textproto.NewConn(conn), cwd: "/"}
+			c.run()
+		}()
+	}
+}
+
+// Close stops the server and waits for all connections to end.
+func (s *testServer) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// addr returns the host and port the server listens on.
+func (s *testServer) addr() (string, int) {
+	a := s.ln.Addr().(*net.TCPAddr)
+	return a.IP.String(), a.Port
+}
+
+// handle overrides the handling of a verb.
+func (s *testServer) handle(verb string, h testHandler) {
+	s.mu.Lock()
+	s.handlers[verb] = h
+	s.mu.Unlock()
+}
+
+// putFile stores a file, creating its parent folders.
+func (s *testServer) putFile(name string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = content
+	s.mtimes[name] = time.Now().UTC()
+	for d := path.Dir(name); !s.dirs[d]; d = path.Dir(d) {
+		s.dirs[d] = true
+	}
+}
+
+// setGreeting replaces the 220 greeting by raw text.
+func (s *testServer) setGreeting(greeting string) {
+	s.mu.Lock()
+	s.greeting = greeting
+	s.mu.Unlock()
+}
+
+// touch sets the modification time of a stored file.
+func (s *testServer) touch(name string, t time.Time) {
+	s.mu.Lock()
+	s.mtimes[name] = t.UTC()
+	s.mu.Unlock()
+}
+
+// file returns the content of a stored file.
+func (s *testServer) file(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.files[name]
+	return b, ok
+}
+
+// dial connects and logs in a new client.
+func (s *testServer) dial() *FTP {
+	host, port := s.addr()
+	ftp := NewFTP(0)
+	if _, err := ftp.Connect(host, port, ""); err != nil {
+		s.t.Fatalf("Connect error: %v", err)
+	}
+	if _, err := ftp.Login("test", "test", ""); err != nil {
+		s.t.Fatalf("Login error: %v", err)
+	}
+	return ftp
+}
+
+func (c *testServerConn) reply(code int, format string, args ...interface{}) {
+	c.tp.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (c *testServerConn) abs(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = path.Join(c.cwd, name)
+	}
+	return path.Clean(name)
+}
+
+func (c *testServerConn) run() {
+	defer c.conn.Close()
+	defer func() {
+		if c.pasv != nil {
+			c.pasv.Close()
+		}
+	}()
+
+	c.s.mu.Lock()
+	greeting := c.s.greeting
+	c.s.mu.Unlock()
+	if greeting != "" {
+		io.WriteString(c.conn, greeting)
+	} else {
+		c.reply(StatusReady, "ftp4go test server ready")
+	}
+	for {
+		line, err := c.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+		verb = strings.ToUpper(verb)
+
+		c.s.mu.Lock()
+		h, ok := c.s.handlers[verb]
+		c.s.mu.Unlock()
+		if !ok {
+			h, ok = testHandlers[verb]
+		}
+		if !ok {
+			c.reply(StatusNotImplemented, "%s not implemented", verb)
+			continue
+		}
+		h(c, arg)
+		if verb == "QUIT" {
+			return
+		}
+	}
+}
+
+// openData opens the data connection negotiated by the last PASV or PORT command.
+func (c *testServerConn) openData() (net.Conn, error) {
+	dc, err := c.dialData()
+	if err == nil && c.prot == "P" {
+		dc = tls.Server(dc, testTLSConfig())
+	}
+	return dc, err
+}
+
+func (c *testServerConn) dialData() (net.Conn, error) {
+	if c.pasv != nil {
+		defer func() { c.pasv.Close(); c.pasv = nil }()
+		c.pasv.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+		return c.pasv.Accept()
+	}
+	if c.port != "" {
+		defer func() { c.port = "" }()
+		return net.DialTimeout("tcp", c.port, 5*time.Second)
+	}
+	return nil, fmt.Errorf("no data connection negotiated")
+}
+
+var (
+	testCertOnce sync.Once
+	testCert     tls.Certificate
+	testCertPool *x509.CertPool
+)
+
+// testTLSConfig returns the server configuration, with a self-signed certificate for 127.0.0.1.
+func testTLSConfig() *tls.Config {
+	testCertOnce.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "ftp4go test server"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+			DNSNames:              []string{"ftp.test.example"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			panic(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			panic(err)
+		}
+		testCert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+		testCertPool = x509.NewCertPool()
+		testCertPool.AddCert(cert)
+	})
+	return &tls.Config{Certificates: []tls.Certificate{testCert}}
+}
+
+// testClientTLSConfig returns a client configuration trusting the test server certificate.
+func testClientTLSConfig() *tls.Config {
+	testTLSConfig()
+	return &tls.Config{RootCAs: testCertPool}
+}
+
+// sendData writes data over a new data connection framed by the 150 and 226 replies.
+func (c *testServerConn) sendData(data []byte) {
+	c.reply(StatusAboutToSend, "Opening BINARY mode data connection (%d bytes)", len(data))
+	dc, err := c.openData()
+	if err != nil {
+		c.reply(StatusCanNotOpenDataConnection, "Can't open data connection")
+		return
+	}
+	if c.modeZ {
+		zw := zlib.NewWriter(dc)
+		zw.Write(data)
+		zw.Close()
+	} else {
+		dc.Write(data)
+	}
+	dc.Close()
+	c.reply(StatusClosingDataConnection, "Transfer complete")
+}
+
+// listing returns the sorted names and "ls -l" lines of a folder.
+func (c *testServerConn) listing(dir string) (names []string, lines []string) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	now := time.Now().UTC()
+	entries := make(map[string]string)
+	for d := range c.s.dirs {
+		if d != dir && path.Dir(d) == dir {
+			entries[path.Base(d)] = fmt.Sprintf("drwxr-xr-x 1 ftp ftp %12d %s %s", 0, now.Format("Jan _2 15:04"), path.Base(d))
+		}
+	}
+	for f, b := range c.s.files {
+		if path.Dir(f) == dir {
+			layout, t := "Jan _2 15:04", c.s.mtimes[f]
+			if now.Sub(t) > 180*24*time.Hour {
+				layout = "Jan _2  2006"
+			}
+			entries[path.Base(f)] = fmt.Sprintf("-rw-r--r-- 1 ftp ftp %12d %s %s", len(b), t.Format(layout), path.Base(f))
+		}
+	}
+	for n := range entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		lines = append(lines, entries[n])
+	}
+	return
+}
+
+var testHandlers = map[string]testHandler{
+	"USER": func(c *testServerConn, arg string) { c.reply(StatusUserOK, "Password required") },
+	"PASS": func(c *testServerConn, arg string) { c.reply(StatusLoggedIn, "Logged in") },
+	"REIN": func(c *testServerConn, arg string) { c.reply(StatusReady, "Service ready for new user") },
+	"TYPE": func(c *testServerConn, arg string) { c.reply(StatusCommandOK, "Type set to %s", arg) },
+	"MODE": func(c *testServerConn, arg string) {
+		switch strings.ToUpper(arg) {
+		case "S":
+			c.modeZ = false
+		case "Z":
+			c.modeZ = true
+		default:
+			c.reply(StatusNotImplementedParameter, "Unsupported mode %s", arg)
+			return
+		}
+		c.reply(StatusCommandOK, "Mode set to %s", arg)
+	},
+	"OPTS": func(c *testServerConn, arg string) { c.reply(StatusCommandOK, "OK") },
+	"NOOP": func(c *testServerConn, arg string) { c.reply(StatusCommandOK, "OK") },
+	"QUIT": func(c *testServerConn, arg string) { c.reply(StatusClosing, "Goodbye") },
+	"PWD": func(c *testServerConn, arg string) {
+		c.reply(StatusPathCreated, "\"%s\" is the current directory", strings.Replace(c.cwd, "\"", "\"\"", -1))
+	},
+	"FEAT": func(c *testServerConn, arg string) {
+		var b bytes.Buffer
+		b.WriteString("211-Features:\r\n")
+		for _, f := range c.s.feats {
+			b.WriteString(" " + f + "\r\n")
+		}
+		b.WriteString("211 End")
+		c.tp.PrintfLine("%s", b.String())
+	},
+	"PASV": func(c *testServerConn, arg string) {
+		if c.pasv != nil {
+			c.pasv.Close()
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			c.reply(StatusCanNotOpenDataConnection, "Can't open passive listener")
+			return
+		}
+		c.pasv = ln
+		p := ln.Addr().(*net.TCPAddr).Port
+		c.reply(StatusPassiveMode, "Entering Passive Mode (127,0,0,1,%d,%d)", p>>8, p&0xff)
+	},
+	"PORT": func(c *testServerConn, arg string) {
+		n := strings.Split(arg, ",")
+		if len(n) != 6 {
+			c.reply(StatusBadArguments, "Bad PORT")
+			return
+		}
+		p1, _ := strconv.Atoi(n[4])
+		p2, _ := strconv.Atoi(n[5])
+		c.port = fmt.Sprintf("%s:%d", strings.Join(n[:4], "."), p1<<8+p2)
+		c.reply(StatusCommandOK, "PORT command successful")
+	},
+	"CWD": func(c *testServerConn, arg string) {
+		d := c.abs(arg)
+		c.s.mu.Lock()
+		ok := c.s.dirs[d]
+		c.s.mu.Unlock()
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such directory", arg)
+			return
+		}
+		c.cwd = d
+		c.reply(StatusRequestedFileActionOK, "Directory changed to %s", d)
+	},
+	"CDUP": func(c *testServerConn, arg string) {
+		c.cwd = path.Dir(c.cwd)
+		c.reply(StatusRequestedFileActionOK, "Directory changed to %s", c.cwd)
+	},
+	"MKD": func(c *testServerConn, arg string) {
+		d := c.abs(arg)
+		c.s.mu.Lock()
+		exists, parent := c.s.dirs[d], c.s.dirs[path.Dir(d)]
+		if !exists && parent {
+			c.s.dirs[d] = true
+		}
+		c.s.mu.Unlock()
+		if exists || !parent {
+			c.reply(StatusFileUnavailable, "%s: Cannot create directory", arg)
+			return
+		}
+		c.reply(StatusPathCreated, "\"%s\" created", strings.Replace(d, "\"", "\"\"", -1))
+	},
+	"RMD": func(c *testServerConn, arg string) {
+		d := c.abs(arg)
+		c.s.mu.Lock()
+		ok := c.s.dirs[d]
+		delete(c.s.dirs, d)
+		c.s.mu.Unlock()
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such directory", arg)
+			return
+		}
+		c.reply(StatusRequestedFileActionOK, "Directory removed")
+	},
+	"DELE": func(c *testServerConn, arg string) {
+		f := c.abs(arg)
+		c.s.mu.Lock()
+		_, ok := c.s.files[f]
+		delete(c.s.files, f)
+		c.s.mu.Unlock()
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such file", arg)
+			return
+		}
+		c.reply(StatusRequestedFileActionOK, "File deleted")
+	},
+	"RNFR": func(c *testServerConn, arg string) {
+		c.s.mu.Lock()
+		isDir := c.s.dirs[c.abs(arg)]
+		c.s.mu.Unlock()
+		if _, ok := c.s.file(c.abs(arg)); !ok && !isDir {
+			c.reply(StatusFileUnavailable, "%s: No such file", arg)
+			return
+		}
+		c.rnfr = c.abs(arg)
+		c.reply(StatusRequestFilePending, "Ready for RNTO")
+	},
+	"RNTO": func(c *testServerConn, arg string) {
+		to := c.abs(arg)
+		c.s.mu.Lock()
+		defer c.s.mu.Unlock()
+		if _, ok := c.s.files[c.rnfr]; ok {
+			c.s.files[to] = c.s.files[c.rnfr]
+			delete(c.s.files, c.rnfr)
+			c.reply(StatusRequestedFileActionOK, "Rename successful")
+			return
+		}
+		if c.s.dirs[to] {
+			c.reply(StatusFileUnavailable, "%s: Directory exists", arg)
+			return
+		}
+		// move the folder with its contents
+		prefix := c.rnfr + "/"
+		for d := range c.s.dirs {
+			if d == c.rnfr || strings.HasPrefix(d, prefix) {
+				delete(c.s.dirs, d)
+				c.s.dirs[to+strings.TrimPrefix(d, c.rnfr)] = true
+			}
+		}
+		for f, b := range c.s.files {
+			if strings.HasPrefix(f, prefix) {
+				delete(c.s.files, f)
+				c.s.files[to+strings.TrimPrefix(f, c.rnfr)] = b
+				if t, ok := c.s.mtimes[f]; ok {
+					delete(c.s.mtimes, f)
+					c.s.mtimes[to+strings.TrimPrefix(f, c.rnfr)] = t
+				}
+			}
+		}
+		c.reply(StatusRequestedFileActionOK, "Rename successful")
+	},
+	"HASH": func(c *testServerConn, arg string) {
+		b, ok := c.s.file(c.abs(arg))
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such file", arg)
+			return
+		}
+		sum := sha256.Sum256(b)
+		c.reply(StatusFile, "SHA-256 0-%d %x %s", len(b), sum, arg)
+	},
+	"SIZE": func(c *testServerConn, arg string) {
+		b, ok := c.s.file(c.abs(arg))
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such file", arg)
+			return
+		}
+		c.reply(StatusFile, "%d", len(b))
+	},
+	"MDTM": func(c *testServerConn, arg string) {
+		c.s.mu.Lock()
+		t, ok := c.s.mtimes[c.abs(arg)]
+		c.s.mu.Unlock()
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such file", arg)
+			return
+		}
+		c.reply(StatusFile, "%s", t.Format("20060102150405"))
+	},
+	"MLSD": func(c *testServerConn, arg string) {
+		dir := c.abs(arg)
+		names, _ := c.listing(dir)
+		c.s.mu.Lock()
+		lines := make([]string, 0, len(names)+1)
+		for _, n := range names {
+			p := path.Join(dir, n)
+			if b, ok := c.s.files[p]; ok {
+				lines = append(lines, fmt.Sprintf("type=file;size=%d;modify=%s; %s", len(b), c.s.mtimes[p].Format("20060102150405"), n))
+			} else {
+				lines = append(lines, "type=dir; "+n)
+			}
+		}
+		c.s.mu.Unlock()
+		c.sendData([]byte(strings.Join(append(lines, ""), "\r\n")))
+	},
+	"MLST": func(c *testServerConn, arg string) {
+		p := c.abs(arg)
+		c.s.mu.Lock()
+		b, isFile := c.s.files[p]
+		isDir := c.s.dirs[p] || p == "/"
+		c.s.mu.Unlock()
+		switch {
+		case isFile:
+			c.tp.PrintfLine("250-Listing %s\r\n type=file;size=%d; %s\r\n250 End", arg, len(b), p)
+		case isDir:
+			c.tp.PrintfLine("250-Listing %s\r\n type=dir; %s\r\n250 End", arg, p)
+		default:
+			c.reply(StatusFileUnavailable, "%s: No such file or directory", arg)
+		}
+	},
+	"REST": func(c *testServerConn, arg string) {
+		c.offset, _ = strconv.ParseInt(arg, 10, 64)
+		c.reply(StatusRequestFilePending, "Restarting at %d", c.offset)
+	},
+	"AUTH": func(c *testServerConn, arg string) {
+		if a := strings.ToUpper(arg); a != "TLS" && a != "SSL" {
+			c.reply(StatusBadArguments, "AUTH %s not supported", arg)
+			return
+		}
+		c.reply(StatusSecurityDataExchanged, "Proceed with negotiation")
+		conn := tls.Server(c.conn, testTLSConfig())
+		if err := conn.Handshake(); err != nil {
+			c.conn.Close()
+			return
+		}
+		c.conn = conn
+		c.tp = textproto.NewConn(conn)
+	},
+	"PBSZ": func(c *testServerConn, arg string) {
+		if _, ok := c.conn.(*tls.Conn); !ok {
+			c.reply(StatusBadSequence, "PBSZ needs AUTH first")
+			return
+		}
+		c.reply(StatusCommandOK, "PBSZ=0")
+	},
+	"PROT": func(c *testServerConn, arg string) {
+		switch arg = strings.ToUpper(arg); arg {
+		case "C", "P":
+			c.prot = arg
+			c.reply(StatusCommandOK, "Protection set to %s", arg)
+		default:
+			c.reply(StatusBadArguments, "PROT %s not supported", arg)
+		}
+	},
+	"RETR": func(c *testServerConn, arg string) {
+		b, ok := c.s.file(c.abs(arg))
+		offset := c.offset
+		c.offset = 0
+		if !ok {
+			c.reply(StatusFileUnavailable, "%s: No such file", arg)
+			return
+		}
+		if offset > int64(len(b)) {
+			offset = int64(len(b))
+		}
+		c.sendData(b[offset:])
+	},
+	"STOR": func(c *testServerConn, arg string) {
+		c.s.mu.Lock()
+		parent := c.s.dirs[path.Dir(c.abs(arg))]
+		c.s.mu.Unlock()
+		if !parent {
+			c.reply(StatusFileUnavailable, "%s: No such file or directory", arg)
+			return
+		}
+		c.reply(StatusAboutToSend, "Ok to send data")
+		dc, err := c.openData()
+		if err != nil {
+			c.reply(StatusCanNotOpenDataConnection, "Can't open data connection")
+			return
+		}
+		var r io.Reader = dc
+		if c.modeZ {
+			if r, err = zlib.NewReader(dc); err != nil {
+				r = strings.NewReader("")
+			}
+		}
+		b, _ := io.ReadAll(r)
+		dc.Close()
+		if offset := c.offset; offset > 0 {
+			c.offset = 0
+			old, _ := c.s.file(c.abs(arg))
+			if offset > int64(len(old)) {
+				offset = int64(len(old))
+			}
+			b = append(old[:offset:offset], b...)
+		}
+		c.s.putFile(c.abs(arg), b)
+		c.reply(StatusClosingDataConnection, "Transfer complete")
+	},
+	"LIST": func(c *testServerConn, arg string) {
+		_, lines := c.listing(c.abs(strings.TrimSpace(strings.TrimPrefix(arg, "-a"))))
+		c.sendData([]byte(strings.Join(append(lines, ""), "\r\n")))
+	},
+	"NLST": func(c *testServerConn, arg string) {
+		names, _ := c.listing(c.abs(arg))
+		c.sendData([]byte(strings.Join(append(names, ""), "\r\n")))
+	},
+}
+
+func TestTestServerRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	ftp := s.dial()
+	defer ftp.Quit()
+
+	content := bytes.Repeat([]byte("0123456789"), 5000)
+	if err := ftp.StoreBytes(STORE_FTP_CMD, bytes.NewReader(content), BLOCK_SIZE, "data.bin", "", nil); err != nil {
+		t.Fatalf("StoreBytes error: %v", err)
+	}
+	if b, _ := s.file("/data.bin"); !bytes.Equal(b, content) {
+		t.Fatalf("The stored file differs, got %d bytes", len(b))
+	}
+
+	var buf bytes.Buffer
+	if err := ftp.GetBytes(RETR_FTP_CMD, &buf, BLOCK_SIZE, "data.bin"); err != nil {
+		t.Fatalf("GetBytes error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("The retrieved file differs, got %d bytes", buf.Len())
+	}
+
+	names, err := ftp.Nlst()
+	if err != nil || len(names) != 1 || names[0] != "data.bin" {
+		t.Fatalf("Unexpected NLST result %v, error: %v", names, err)
+	}
+}
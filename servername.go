@@ -0,0 +1,34 @@
+package ftp4go
+
+// SetServerName sets the name of the server when Connect is given one of its addresses,
+// e.g. to reach the staging address of a partner or with split-horizon DNS: the name is
+// presented in the TLS SNI, verified in the server certificate and sent with HOST right
+// after the greeting (RFC 7151), so that virtual hosts pick the right site. Empty, the
+// default, uses the host given to Connect and sends no HOST.
+func (ftp *FTP) SetServerName(name string) {
+	ftp.serverName = name
+}
+
+// Hostname sends HOST with the name of the virtual host to log on to, before Login.
+func (ftp *FTP) Hostname(name string) (response *Response, err error) {
+	return ftp.SendAndRead(HOST_FTP_CMD, name)
+}
+
+// tlsServerName returns the name the server certificate is verified against.
+func (ftp *FTP) tlsServerName() string {
+	if ftp.serverName != "" {
+		return ftp.serverName
+	}
+	return ftp.Host
+}
+
+// sendHost sends the server name set by SetServerName with HOST. Servers predating HOST
+// refuse it, which is only logged: they serve a single site.
+func (ftp *FTP) sendHost() {
+	if ftp.serverName == "" {
+		return
+	}
+	if _, err := ftp.Hostname(ftp.serverName); err != nil {
+		ftp.writeInfo("HOST refused, continuing without it:", err)
+	}
+}
@@ -0,0 +1,109 @@
+package ftp4go
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+)
+
+// SessionConfig describes the session opened by WithSession and Dial.
+type SessionConfig struct {
+	Host     string
+	Port     int    // 0 for DefaultFtpPort
+	Proxy    string // URL of a SOCKS5 proxy, empty for the one of the environment, see Connect
+	User     string
+	Password string
+	Acct     string
+	Debug    int // debug level of NewFTP
+
+	// ServerName is the name of the server when Host is one of its addresses, see SetServerName.
+	ServerName string
+
+	// TLS switches the session to explicit FTPS with Secure before logging in, TLSConfig
+	// being passed to it.
+	TLS       bool
+	TLSConfig *tls.Config
+
+	// Setup is called before connecting, to apply the Set* options of the session.
+	Setup func(ftp *FTP) error
+}
+
+// Dial opens a connected and logged in session as configured, it serves as the DialFunc
+// of a Pool.
+func (cfg *SessionConfig) Dial() (*FTP, error) {
+	ftp, err := cfg.connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.login(ftp); err != nil {
+		ftp.Quit()
+		return nil, err
+	}
+	return ftp, nil
+}
+
+// connect opens the connection of a new session.
+func (cfg *SessionConfig) connect(ctx context.Context) (*FTP, error) {
+	ftp := NewFTP(cfg.Debug)
+	if cfg.Setup != nil {
+		if err := cfg.Setup(ftp); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ServerName != "" {
+		ftp.SetServerName(cfg.ServerName)
+	}
+	if _, err := ftp.ConnectContext(ctx, cfg.Host, cfg.Port, cfg.Proxy); err != nil {
+		return nil, err
+	}
+	return ftp, nil
+}
+
+// login secures the session if required and logs in.
+func (cfg *SessionConfig) login(ftp *FTP) error {
+	if cfg.TLS {
+		if err := ftp.Secure(cfg.TLSConfig); err != nil {
+			return err
+		}
+	}
+	_, err := ftp.Login(cfg.User, cfg.Password, cfg.Acct)
+	return err
+}
+
+// WithSession connects and logs in as configured, runs fn with the session and always ends
+// it, with QUIT if the connection is still usable. The error of fn comes first, joined with
+// the one of QUIT if both failed. Cancelling ctx interrupts the connection, fn included,
+// by closing the control connection.
+func WithSession(ctx context.Context, cfg *SessionConfig, fn func(ftp *FTP) error) (err error) {
+	ftp, err := cfg.connect(ctx)
+	if err != nil {
+		return err
+	}
+	// the watcher closes the connection of the moment, fn may reconnect
+	stop := watchContext(ctx, ftp.interrupt)
+	defer func() {
+		stop()
+		if ctx.Err() != nil {
+			// the connection is closed already, QUIT would only fail
+			if ftp.conn != nil {
+				ftp.conn.Close()
+				ftp.setConn(nil)
+			}
+			if err != nil && !errors.Is(err, ctx.Err()) {
+				err = errors.Join(err, ctx.Err())
+			}
+			return
+		}
+		if ftp.conn == nil {
+			// fn quit the session
+			return
+		}
+		if _, _, err1 := ftp.QuitTimeout(DefaultQuitTimeout); err1 != nil {
+			err = errors.Join(err, err1)
+		}
+	}()
+	if err = cfg.login(ftp); err != nil {
+		return err
+	}
+	return fn(ftp)
+}
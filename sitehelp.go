@@ -0,0 +1,34 @@
+package ftp4go
+
+import (
+	"strings"
+
+	"github.com/shenshouer/ftp4go/replyparse"
+)
+
+// SiteHelp sends SITE HELP and returns the vendor SITE subcommands the server lists, in upper
+// case, e.g. CHMOD, UTIME or SYMLINK. They are remembered as capabilities: HasFeature then
+// reports "SITE CHMOD" for a listed CHMOD, and Capabilities reports them, so that tools use
+// the extensions only when present. A server refusing SITE HELP is not an error, it lists none.
+func (ftp *FTP) SiteHelp() ([]string, error) {
+	resp, err := ftp.SendAndRead(SITE_FTP_CMD, "HELP")
+	if err != nil {
+		if replyCode(err) >= 500 {
+			ftp.writeInfo("SITE HELP not supported:", err)
+			ftp.siteCmds = map[string]bool{}
+			return nil, nil
+		}
+		return nil, err
+	}
+	cmds := replyparse.SiteCommands(resp.Message)
+	ftp.siteCmds = make(map[string]bool, len(cmds))
+	for _, c := range cmds {
+		ftp.siteCmds[c] = true
+	}
+	return cmds, nil
+}
+
+// hasSiteCommand reports whether SITE HELP listed the subcommand.
+func (ftp *FTP) hasSiteCommand(name string) bool {
+	return ftp.siteCmds[strings.ToUpper(name)]
+}
@@ -0,0 +1,116 @@
+package ftp4go
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// SkipPolicy selects the files UploadDirTree and DownloadDirTree leave alone, see SetTreeSkipPolicy.
+type SkipPolicy int
+
+const (
+	// SkipIfSameSize skips a file whose target exists with the same size.
+	SkipIfSameSize SkipPolicy = 1 << iota
+	// SkipIfTargetNewer skips a file whose target was modified after it, for instance
+	// an upload whose remote copy is newer than the local file.
+	SkipIfTargetNewer
+	// SkipIfUnreadable skips the local files UploadDirTree cannot stat or open, whose permissions
+	// deny it or which vanished, instead of failing the upload; they are reported as SkipUnreadable.
+	SkipIfUnreadable
+)
+
+// compareSkips are the policies comparing the files to their targets.
+const compareSkips = SkipIfSameSize | SkipIfTargetNewer
+
+// SkipReason tells why a tree operation did not transfer a file or folder.
+type SkipReason int
+
+const (
+	SkipExcluded    SkipReason = iota // the folder is in the excluded list
+	SkipSameSize                      // the target has the same size, see SkipIfSameSize
+	SkipTargetNewer                   // the target is newer, see SkipIfTargetNewer
+	SkipDuplicate                     // an identical file was uploaded already, see DedupRecord
+	SkipUnreadable                    // the local file cannot be read, see SkipIfUnreadable
+)
+
+func (r SkipReason) String() string {
+	switch r {
+	case SkipExcluded:
+		return "excluded"
+	case SkipSameSize:
+		return "same size"
+	case SkipTargetNewer:
+		return "target newer"
+	case SkipDuplicate:
+		return "duplicate"
+	case SkipUnreadable:
+		return "unreadable"
+	}
+	return "unknown"
+}
+
+// SkipEvent reports a file or folder left out by a tree operation.
+type SkipEvent struct {
+	Op     string // "upload" or "download"
+	Path   string // the local path of an upload, the remote path of a download
+	Target string // the path it would have been transferred to
+	Reason SkipReason
+	Err    error // why the file could not be read, for SkipUnreadable
+}
+
+// SkipFunc receives the SkipEvents, it is called synchronously.
+type SkipFunc func(ev *SkipEvent)
+
+// SetTreeSkipPolicy sets which files UploadDirTree and DownloadDirTree skip, by default none.
+// The policies can be combined, e.g. SkipIfSameSize|SkipIfTargetNewer.
+func (ftp *FTP) SetTreeSkipPolicy(policy SkipPolicy) {
+	ftp.skipPolicy = policy
+}
+
+// SetSkipCallback sets the function told about every file or folder skipped by
+// UploadDirTree and DownloadDirTree, nil to stop reporting them.
+func (ftp *FTP) SetSkipCallback(fn SkipFunc) {
+	ftp.onSkip = fn
+}
+
+// skipReason applies the skip policy to a source of the given size and time and its
+// target, nil if it does not exist.
+func (ftp *FTP) skipReason(size int64, mtime time.Time, target os.FileInfo) (SkipReason, bool) {
+	if target == nil || target.IsDir() {
+		return 0, false
+	}
+	if ftp.skipPolicy&SkipIfSameSize != 0 && target.Size() == size {
+		return SkipSameSize, true
+	}
+	if ftp.skipPolicy&SkipIfTargetNewer != 0 && !target.ModTime().IsZero() && target.ModTime().After(mtime) {
+		return SkipTargetNewer, true
+	}
+	return 0, false
+}
+
+// skipped logs and reports a skipped file or folder, err is the failure of a SkipUnreadable.
+func (ftp *FTP) skipped(op string, p string, target string, reason SkipReason, err error) {
+	ftp.writeInfo("Skipping", p, "reason:", reason)
+	if op == "upload" && ftp.receipt != nil {
+		rs := &ReceiptSkip{LocalPath: p, RemotePath: target, Reason: reason.String()}
+		if err != nil {
+			rs.Error = err.Error()
+		}
+		ftp.receipt.Skipped = append(ftp.receipt.Skipped, rs)
+	}
+	if ftp.onSkip != nil {
+		ftp.onSkip(&SkipEvent{Op: op, Path: p, Target: target, Reason: reason, Err: err})
+	}
+}
+
+// skipUnreadable skips the local file p of an upload if err tells it cannot be stat'ed or
+// opened and the policy is SkipIfUnreadable.
+func (ftp *FTP) skipUnreadable(p string, target string, err error) bool {
+	var pe *os.PathError
+	if ftp.skipPolicy&SkipIfUnreadable == 0 || !errors.As(err, &pe) || pe.Path != p || (pe.Op != "stat" && pe.Op != "open") {
+		return false
+	}
+	ftp.skipped("upload", p, target, SkipUnreadable, err)
+	return true
+}
@@ -0,0 +1,233 @@
+package ftp4go
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplyStats counts the replies read from the server by class.
+type ReplyStats struct {
+	PositivePreliminary  int64 // 1yz
+	PositiveCompletion   int64 // 2yz
+	PositiveIntermediate int64 // 3yz
+	TransientNegative    int64 // 4yz
+	PermanentNegative    int64 // 5yz
+}
+
+// Stats are the cumulative counters of a client, since it was created.
+type Stats struct {
+	Commands        int64 // command lines sent on the control connection
+	Replies         ReplyStats
+	BytesUp         int64 // payload bytes written to data connections
+	BytesDown       int64 // payload bytes read from data connections, listings included
+	TransfersOK     int64 // data transfers completed with a positive final reply
+	TransfersFailed int64
+	Reconnects      int64 // successful Connect calls after the first one
+}
+
+// TransferStats describe a single data transfer.
+type TransferStats struct {
+	Command    string        // the transfer command line, e.g. "RETR name"
+	TotalBytes int64         // size announced by the server in its 150 or 125 reply, -1 if unknown
+	Bytes      int64         // payload bytes transferred so far over the data connection
+	Start      time.Time     // when the server accepted the command
+	Duration   time.Duration // set once the transfer ended
+	BlockSize  int           // size of the blocks of a binary transfer, the current one if tuned, see SetBlockTuning
+	Err        error         // the cause of a failed transfer
+}
+
+// Percent returns the completion of a transfer in percent, -1 if the total is unknown.
+func (ts *TransferStats) Percent() float64 {
+	if ts.TotalBytes <= 0 {
+		return -1
+	}
+	return float64(ts.Bytes) * 100 / float64(ts.TotalBytes)
+}
+
+// HostUsage are the cumulative counters of a remote host, over all the clients of the process.
+type HostUsage struct {
+	BytesUp   int64 // payload bytes written to data connections
+	BytesDown int64 // payload bytes read from data connections, listings included
+	FilesUp   int64 // STOR, STOU and APPE transfers completed with a positive final reply
+	FilesDown int64 // RETR transfers completed with a positive final reply
+}
+
+// hostUsage is the registry of UsageByHost.
+var hostUsage = struct {
+	mu sync.Mutex
+	m  map[string]*HostUsage
+}{m: map[string]*HostUsage{}}
+
+// UsageByHost returns a snapshot of the usage of each remote host the clients of the
+// process transferred data with, keyed by the Host of the clients, e.g. for usage-based
+// reporting of a transfer service. It is safe to call from any goroutine.
+func UsageByHost() map[string]HostUsage {
+	hostUsage.mu.Lock()
+	defer hostUsage.mu.Unlock()
+	m := make(map[string]HostUsage, len(hostUsage.m))
+	for host, u := range hostUsage.m {
+		m[host] = *u
+	}
+	return m
+}
+
+// ResetUsageByHost clears the counters of UsageByHost, e.g. at the start of a billing period.
+func ResetUsageByHost() {
+	hostUsage.mu.Lock()
+	hostUsage.m = map[string]*HostUsage{}
+	hostUsage.mu.Unlock()
+}
+
+func addHostUsage(host string, f func(u *HostUsage)) {
+	hostUsage.mu.Lock()
+	u := hostUsage.m[host]
+	if u == nil {
+		u = &HostUsage{}
+		hostUsage.m[host] = u
+	}
+	f(u)
+	hostUsage.mu.Unlock()
+}
+
+// sessionStats guards the counters, which may be read while a transfer runs.
+type sessionStats struct {
+	mu        sync.Mutex
+	s         Stats
+	connected bool
+	host      string         // the key of the session in UsageByHost
+	last      *TransferStats // the running or last transfer
+}
+
+// Stats returns a snapshot of the cumulative session counters.
+// It is safe to call from another goroutine, for instance to export them.
+func (ftp *FTP) Stats() Stats {
+	ftp.stats.mu.Lock()
+	defer ftp.stats.mu.Unlock()
+	return ftp.stats.s
+}
+
+// LastTransfer returns a snapshot of the running or last data transfer, nil if there was none.
+// It is safe to call from another goroutine, for instance to render the progress of a download.
+func (ftp *FTP) LastTransfer() *TransferStats {
+	ftp.stats.mu.Lock()
+	defer ftp.stats.mu.Unlock()
+	if ftp.stats.last == nil {
+		return nil
+	}
+	ts := *ftp.stats.last
+	return &ts
+}
+
+func (st *sessionStats) begin(line string, size int) *TransferStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.last = &TransferStats{Command: line, TotalBytes: int64(size), Start: time.Now()}
+	return st.last
+}
+
+// end completes the running transfer and returns a snapshot of it, nil if there is none.
+func (st *sessionStats) end(err error) *TransferStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.last == nil || st.last.Duration != 0 {
+		return nil
+	}
+	st.last.Duration = time.Since(st.last.Start)
+	st.last.Err = err
+	ts := *st.last
+	if err == nil {
+		verb, _, _ := strings.Cut(ts.Command, " ")
+		switch strings.ToUpper(verb) {
+		case "RETR":
+			addHostUsage(st.host, func(u *HostUsage) { u.FilesDown++ })
+		case "STOR", "STOU", "APPE":
+			addHostUsage(st.host, func(u *HostUsage) { u.FilesUp++ })
+		}
+	}
+	return &ts
+}
+
+func (st *sessionStats) setBlockSize(size int) {
+	st.mu.Lock()
+	if st.last != nil {
+		st.last.BlockSize = size
+	}
+	st.mu.Unlock()
+}
+
+func (st *sessionStats) update(f func(s *Stats)) {
+	st.mu.Lock()
+	f(&st.s)
+	st.mu.Unlock()
+}
+
+func (st *sessionStats) connect(host string) {
+	st.update(func(s *Stats) {
+		if st.connected {
+			s.Reconnects++
+		}
+		st.connected = true
+		st.host = host
+	})
+}
+
+func (st *sessionStats) reply(r *Response) {
+	st.update(func(s *Stats) {
+		switch {
+		case r.IsPositivePreliminary():
+			s.Replies.PositivePreliminary++
+		case r.IsPositiveCompletion():
+			s.Replies.PositiveCompletion++
+		case r.IsPositiveIntermediate():
+			s.Replies.PositiveIntermediate++
+		case r.IsTransientNegative():
+			s.Replies.TransientNegative++
+		case r.IsPermanentNegative():
+			s.Replies.PermanentNegative++
+		}
+	})
+}
+
+func (st *sessionStats) transfer(err error) {
+	st.update(func(s *Stats) {
+		if err != nil {
+			s.TransfersFailed++
+		} else {
+			s.TransfersOK++
+		}
+	})
+}
+
+// statsConn counts the payload bytes of a data connection.
+type statsConn struct {
+	net.Conn
+	st   *sessionStats
+	ts   *TransferStats
+	host string
+}
+
+func (c *statsConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if n > 0 {
+		c.st.update(func(s *Stats) {
+			s.BytesDown += int64(n)
+			c.ts.Bytes += int64(n)
+		})
+		addHostUsage(c.host, func(u *HostUsage) { u.BytesDown += int64(n) })
+	}
+	return
+}
+
+func (c *statsConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	if n > 0 {
+		c.st.update(func(s *Stats) {
+			s.BytesUp += int64(n)
+			c.ts.Bytes += int64(n)
+		})
+		addHostUsage(c.host, func(u *HostUsage) { u.BytesUp += int64(n) })
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package ftp4go
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// StopReason tells why a transfer ended early, so that retry logic can pick its response:
+// retry a network error or a stall, give up on a server abort, respect a user cancel.
+type StopReason int
+
+const (
+	StopNone        StopReason = iota // the transfer did not stop early
+	StopUser                          // stopped by FTP.Stop
+	StopCanceled                      // the Context of the transfer was canceled
+	StopDeadline                      // the Context deadline or the MaxDuration of the transfer passed
+	StopStalled                       // the data connection or the final reply timed out
+	StopServerAbort                   // the server ended the transfer with a negative reply, such as 426
+	StopNetwork                       // the data connection failed
+	StopOther                         // any other failure, such as writing the local file
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopNone:
+		return "none"
+	case StopUser:
+		return "user"
+	case StopCanceled:
+		return "canceled"
+	case StopDeadline:
+		return "deadline"
+	case StopStalled:
+		return "stalled"
+	case StopServerAbort:
+		return "server abort"
+	case StopNetwork:
+		return "network"
+	}
+	return "other"
+}
+
+// An ErrTransferStopped is returned for a transfer which ended early once its data
+// connection was open, it wraps the cause and keeps its message.
+type ErrTransferStopped struct {
+	Reason StopReason
+	Code   int   // the final reply of a StopServerAbort, such as 426
+	Err    error // the cause
+}
+
+func (e *ErrTransferStopped) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ErrTransferStopped) Unwrap() error {
+	return e.Err
+}
+
+// ErrStoppedAfterCurrent is returned by a tree or sync job wound down by StopAfterCurrent.
+var ErrStoppedAfterCurrent = errors.New("Stopped after the current file")
+
+// StopAfterCurrent winds down the running UploadDirTree, DownloadDirTree, SyncDirs or
+// RemoveRemoteTree from another goroutine: the file in flight is finished, then the job
+// returns ErrStoppedAfterCurrent instead of starting the next one. Unlike Stop, nothing is
+// left half transferred, so the job can be run again later to complete it. Called while no
+// job runs, it has no effect.
+func (ftp *FTP) StopAfterCurrent() {
+	if ftp.jobs.Load() > 0 {
+		ftp.afterCurrent.Store(true)
+	}
+}
+
+// beginStoppable marks the start of a transfer or a job, which Stop interrupts, and forgets
+// a request left over by a Stop racing with the end of the previous one. The returned
+// function marks its end.
+func (ftp *FTP) beginStoppable() (end func()) {
+	if ftp.running.Add(1) == 1 {
+		select {
+		case <-ftp.stop:
+		default:
+		}
+	}
+	return func() { ftp.running.Add(-1) }
+}
+
+// beginJob is beginStoppable for the tree and sync jobs, which StopAfterCurrent winds down too.
+func (ftp *FTP) beginJob() (end func()) {
+	if ftp.jobs.Add(1) == 1 {
+		ftp.afterCurrent.Store(false)
+	}
+	endStoppable := ftp.beginStoppable()
+	return func() {
+		endStoppable()
+		ftp.jobs.Add(-1)
+	}
+}
+
+// StopReasonOf returns why the transfer which failed with err stopped, StopNone for a nil err.
+// Errors not returned by a transfer are classified as well as possible.
+func StopReasonOf(err error) StopReason {
+	var st *ErrTransferStopped
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return StopNone
+	case errors.As(err, &st):
+		return st.Reason
+	case errors.Is(err, NewErrStop), errors.Is(err, ErrStoppedAfterCurrent):
+		return StopUser
+	case errors.Is(err, context.Canceled):
+		return StopCanceled
+	case errors.Is(err, ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return StopDeadline
+	case errors.Is(err, ErrNoFinalReply), errors.As(err, &netErr) && netErr.Timeout():
+		return StopStalled
+	case errors.As(err, &netErr):
+		return StopNetwork
+	}
+	var cut *errDataClosed
+	if errors.As(err, &cut) {
+		return StopNetwork
+	}
+	return StopOther
+}
+
+// transferStopped wraps the error of a transfer which ended early, fromReply tells that
+// the final reply of the server is the cause.
+func (ftp *FTP) transferStopped(err error, fromReply bool) error {
+	if _, ok := err.(*ErrTransferStopped); ok {
+		return err
+	}
+	st := &ErrTransferStopped{Reason: StopReasonOf(err), Err: err}
+	if code := replyCode(err); fromReply && code >= 400 {
+		st.Reason, st.Code = StopServerAbort, code
+	}
+	return st
+}
@@ -0,0 +1,67 @@
+package ftp4go
+
+import (
+	"path"
+	"strings"
+)
+
+// TreeMapping pairs a source folder with its destination, for DownloadDirTrees and UploadDirTrees.
+type TreeMapping struct {
+	Source string // remote folder of a download, local folder of an upload
+	Target string // local folder of a download, remote root folder of an upload
+}
+
+// DownloadDirTrees downloads several remote subtrees, each into its own local folder, in a
+// single job on this session, see DownloadDirTree. The sources are absolute remote paths
+// and may overlap, e.g. "/data" and "/data/2024" mapped to different folders: the folders
+// shared by several sources are only listed once. The excluded folders, the skip policy,
+// the flattening and the journal apply to all of them.
+// Returns the number of files downloaded and the first error, which stops the job.
+func (ftp *FTP) DownloadDirTrees(mappings []TreeMapping, excludedDirs []string) (n int, err error) {
+	exDirs := excludedSet(excludedDirs)
+	sources := make([]string, len(mappings))
+	for i, m := range mappings {
+		sources[i] = path.Clean(m.Source)
+	}
+	listings := make(map[string][]*Entry) // listings of the folders below several sources
+	list := func(p string) ([]*Entry, error) {
+		if entries, ok := listings[p]; ok {
+			return entries, nil
+		}
+		entries, err := ftp.List(p)
+		if err == nil && sharedBy(p, sources) > 1 {
+			listings[p] = entries
+		}
+		return entries, err
+	}
+	for i, m := range mappings {
+		if err = ftp.downloadDirTree(sources[i], m.Target, exDirs, list, &n); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// sharedBy returns the number of sources at or above the remote folder p.
+func sharedBy(p string, sources []string) (k int) {
+	for _, s := range sources {
+		if p == s || s == "/" || strings.HasPrefix(p, s+"/") {
+			k++
+		}
+	}
+	return k
+}
+
+// UploadDirTrees uploads several local folders, each below its own remote root folder, in a
+// single job on this session, see UploadDirTree; with SetUploadReceipt each of them gets
+// its receipt. Returns the number of files uploaded and the first error, which stops the job.
+func (ftp *FTP) UploadDirTrees(mappings []TreeMapping, excludedDirs []string, callback Callback) (n int, err error) {
+	for _, m := range mappings {
+		k, err := ftp.UploadDirTree(m.Source, m.Target, 0, excludedDirs, callback)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported is returned for a non-standard command the server does not provide.
+// It matches errors.ErrUnsupported.
+type ErrUnsupported struct {
+	Command string // e.g. "SITE SYMLINK"
+}
+
+func (e *ErrUnsupported) Error() string {
+	return fmt.Sprintf("%s is not supported by the server", e.Command)
+}
+
+// Is makes errors.Is(err, errors.ErrUnsupported) hold.
+func (e *ErrUnsupported) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// Symlink creates the symbolic link linkname to target on the server with SITE SYMLINK,
+// the command of ProFTPD's mod_site_misc. The command is used when advertised by FEAT or
+// listed by SiteHelp, both consulted first if not done yet, otherwise *ErrUnsupported is
+// returned. The server refuses to replace an existing link: to flip a "current" link to
+// another release folder, Delete it then create it again.
+func (ftp *FTP) Symlink(target string, linkname string) error {
+	if err := ftp.symlinkSupported(); err != nil {
+		return err
+	}
+	_, err := ftp.SendAndRead(SITE_FTP_CMD, "SYMLINK", target, linkname)
+	switch replyCode(err) {
+	case StatusBadCommand, StatusNotImplemented, StatusNotImplementedParameter:
+		return &ErrUnsupported{Command: "SITE SYMLINK"}
+	}
+	return err
+}
+
+// symlinkSupported returns *ErrUnsupported unless FEAT or SITE HELP list SITE SYMLINK.
+func (ftp *FTP) symlinkSupported() error {
+	if ftp.features == nil {
+		if _, err := ftp.Feat(); err != nil {
+			if replyCode(err) < 500 {
+				return err
+			}
+			ftp.features = map[string]string{}
+		}
+	}
+	if !ftp.HasFeature("SITE SYMLINK") && ftp.siteCmds == nil {
+		if _, err := ftp.SiteHelp(); err != nil {
+			return err
+		}
+	}
+	if !ftp.HasFeature("SITE SYMLINK") {
+		return &ErrUnsupported{Command: "SITE SYMLINK"}
+	}
+	return nil
+}
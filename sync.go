@@ -0,0 +1,531 @@
+package ftp4go
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncState is the base of a two-way sync: the files of both sides as they were after the
+// last sync, which tells a file deleted on one side from a file created on the other, and
+// the journal of the conflicts left unresolved. Persist it between runs with Save and LoadSyncState.
+type SyncState struct {
+	Files     map[string]*SyncFileState `json:"files"`             // by path relative to the synced folders, slash separated
+	Folders   []string                  `json:"folders,omitempty"` // the folders on both sides, with SyncOptions.Folders
+	Conflicts []SyncConflict            `json:"conflicts,omitempty"`
+}
+
+// SyncFileState is the last seen state of a file on both sides.
+type SyncFileState struct {
+	Local  FileStamp `json:"local"`
+	Remote FileStamp `json:"remote"`
+}
+
+// FileStamp identifies a version of a file by its size and modification time.
+type FileStamp struct {
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+}
+
+func (s FileStamp) equal(o FileStamp) bool {
+	return s.Size == o.Size && s.Time.Equal(o.Time)
+}
+
+// SyncConflict is a file changed on both sides since the last sync.
+type SyncConflict struct {
+	Path   string    `json:"path"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"` // when the conflict was first found
+}
+
+// ConflictPolicy selects how SyncDirs resolves the conflicts.
+type ConflictPolicy int
+
+const (
+	ConflictKeep       ConflictPolicy = iota // leave both sides untouched and journal the conflict, the default
+	ConflictLocalWins                        // the local side overwrites or deletes the remote one
+	ConflictRemoteWins                       // the remote side overwrites or deletes the local one
+)
+
+// SyncOptions configures SyncDirs.
+type SyncOptions struct {
+	Conflicts ConflictPolicy
+	// Folders syncs the folders too, empty ones included: a folder created on one side is
+	// created on the other, a folder deleted on one side is removed from the other if empty.
+	Folders bool
+}
+
+// SyncResult lists what SyncDirs did, by relative path, the paths of folders ending with a slash.
+type SyncResult struct {
+	Uploaded      []string
+	Downloaded    []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	Conflicts     []SyncConflict // the conflicts left unresolved
+	Failure       *ErrFileFailed // the file the sync stopped on, if any
+}
+
+// NewSyncState returns the empty state of a first sync.
+func NewSyncState() *SyncState {
+	return &SyncState{Files: make(map[string]*SyncFileState)}
+}
+
+// LoadSyncState reads a state written by Save, the empty state if the file does not exist.
+func LoadSyncState(name string) (*SyncState, error) {
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return NewSyncState(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	s := NewSyncState()
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the state as JSON, replacing the file atomically.
+func (s *SyncState) Save(name string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, b)
+}
+
+// writeFileAtomic writes a file through a synced temporary file renamed over it.
+func writeFileAtomic(name string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// syncAction is what SyncDirs does with a file.
+type syncAction int
+
+const (
+	syncNone syncAction = iota
+	syncUpload
+	syncDownload
+	syncDeleteLocal
+	syncDeleteRemote
+	syncConflict
+)
+
+// syncDecide merges the local and remote versions of a file, nil if missing, with their
+// base, nil if the file was not synced yet. A conflict comes with a reason and the actions
+// of the local and remote side winning it. A file on both sides without base is a conflict,
+// which SyncDirs drops if the two turn out identical, see sameContent.
+func syncDecide(l, r *FileStamp, b *SyncFileState) (action syncAction, reason string, localWins, remoteWins syncAction) {
+	if b == nil {
+		switch {
+		case l != nil && r != nil:
+			return syncConflict, "created on both sides", syncUpload, syncDownload
+		case l != nil:
+			return syncUpload, "", 0, 0
+		case r != nil:
+			return syncDownload, "", 0, 0
+		}
+		return syncNone, "", 0, 0
+	}
+	localChanged := l != nil && !l.equal(b.Local)
+	remoteChanged := r != nil && !r.equal(b.Remote)
+	switch {
+	case l == nil && r == nil:
+		return syncNone, "", 0, 0
+	case l == nil && remoteChanged:
+		return syncConflict, "deleted locally, modified remotely", syncDeleteRemote, syncDownload
+	case l == nil:
+		return syncDeleteRemote, "", 0, 0
+	case r == nil && localChanged:
+		return syncConflict, "deleted remotely, modified locally", syncUpload, syncDeleteLocal
+	case r == nil:
+		return syncDeleteLocal, "", 0, 0
+	case localChanged && remoteChanged:
+		return syncConflict, "modified on both sides", syncUpload, syncDownload
+	case localChanged:
+		return syncUpload, "", 0, 0
+	case remoteChanged:
+		return syncDownload, "", 0, 0
+	}
+	return syncNone, "", 0, 0
+}
+
+// SyncDirs synchronizes a local folder and a remote one, an absolute path, in both directions:
+// the files created or modified on one side since the last sync are copied to the other,
+// and the files deleted on one side are deleted on the other, provided they did not change there.
+// Files changed on both sides are conflicts, resolved according to opts, which may be nil,
+// as are the files found on both sides without base, unless HASH shows them identical.
+// state is the base of the last sync, NewSyncState for a first sync, and is updated on return,
+// also when an error stops the sync; save it for the next run.
+//
+// Only regular files are synced, folders are created as needed but never removed
+// unless SyncOptions.Folders is set.
+// The remote times come from the listings, see FingerprintRemote for their precision.
+func (ftp *FTP) SyncDirs(localDir string, remoteDir string, state *SyncState, opts *SyncOptions) (res *SyncResult, err error) {
+	defer ftp.beginJob()()
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*SyncFileState)
+	}
+	defer ftp.startHeartbeat("sync", remoteDir)()
+	local, remote, err := ftp.syncTrees(localDir, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	res = &SyncResult{}
+	conflicts := make(map[string]string)
+	// the files whose base may be updated: synced by this run, or found in sync
+	handled := make(map[string]bool)
+	complete := false
+	defer func() {
+		if err1 := ftp.updateSyncState(localDir, remoteDir, state, conflicts, handled, complete, opts, res); err == nil {
+			err = err1
+		}
+	}()
+
+	if opts.Folders {
+		if err = ftp.createSyncFolders(localDir, remoteDir, local, remote, state, res); err != nil {
+			return res, err
+		}
+	}
+	for _, p := range syncPaths(local.files, remote.files, state.Files) {
+		action, reason, localWins, remoteWins := syncDecide(local.files[p], remote.files[p], state.Files[p])
+		if action == syncConflict && state.Files[p] == nil && ftp.sameContent(localDir, remoteDir, p, local.files[p], remote.files[p]) {
+			action = syncNone // e.g. synced by an interrupted run
+		}
+		if action == syncConflict {
+			switch opts.Conflicts {
+			case ConflictLocalWins:
+				action = localWins
+			case ConflictRemoteWins:
+				action = remoteWins
+			default:
+				ftp.writeInfo("Sync conflict:", p, reason)
+				conflicts[p] = reason
+				continue
+			}
+		}
+		if action == syncDeleteLocal {
+			if why, ok := remote.truncatedAt(p); ok {
+				reason = "the remote listing looks truncated, " + why
+				ftp.writeInfo("Sync conflict:", p, reason)
+				conflicts[p] = reason
+				continue
+			}
+		}
+		if err = ftp.treeAttempt(p, func() error { return ftp.syncFile(localDir, remoteDir, p, action, res) }); err != nil {
+			errors.As(err, &res.Failure)
+			return res, err
+		}
+		handled[p] = true
+	}
+	if opts.Folders {
+		ftp.removeSyncFolders(localDir, remoteDir, local, remote, state, res)
+	}
+	complete = true
+	return res, nil
+}
+
+// sameContent reports whether the local and remote versions of the file p are identical:
+// the same size and, the transfers not keeping the modification times, the same checksum.
+// Without HASH on the server they are taken as different.
+func (ftp *FTP) sameContent(localDir string, remoteDir string, p string, l, r *FileStamp) bool {
+	if l.Size != r.Size {
+		return false
+	}
+	if ftp.features == nil {
+		if _, err := ftp.Feat(); err != nil {
+			ftp.writeInfo("Unable to compare the checksums of", p, "error:", err)
+			return false
+		}
+	}
+	if !ftp.HasFeature("HASH SHA-256") {
+		return false
+	}
+	remoteSum, err := ftp.Hash(path.Join(remoteDir, p))
+	if err != nil {
+		ftp.writeInfo("Unable to compare the checksums of", p, "error:", err)
+		return false
+	}
+	_, localSum, err := ftp.fileChecksum(filepath.Join(localDir, filepath.FromSlash(p)))
+	if err != nil {
+		ftp.writeInfo("Unable to compare the checksums of", p, "error:", err)
+		return false
+	}
+	return localSum == remoteSum
+}
+
+// syncFile applies the action to the file p and records it in res once done.
+func (ftp *FTP) syncFile(localDir string, remoteDir string, p string, action syncAction, res *SyncResult) (err error) {
+	lp, rp := filepath.Join(localDir, filepath.FromSlash(p)), path.Join(remoteDir, p)
+	done := &res.Uploaded
+	switch action {
+	case syncUpload:
+		err = ftp.UploadFileWithOptions(rp, lp, &TransferOptions{CreateDirs: true})
+	case syncDownload:
+		done = &res.Downloaded
+		if err = os.MkdirAll(filepath.Dir(lp), 0755); err == nil {
+			err = ftp.DownloadFileWithOptions(rp, lp, nil)
+		}
+	case syncDeleteLocal:
+		done = &res.DeletedLocal
+		err = os.Remove(lp)
+	case syncDeleteRemote:
+		done = &res.DeletedRemote
+		_, err = ftp.Delete(rp)
+	default:
+		return nil
+	}
+	if err == nil {
+		*done = append(*done, p)
+	}
+	return err
+}
+
+// createSyncFolders creates the folders created on one side since the last sync on the other.
+func (ftp *FTP) createSyncFolders(localDir string, remoteDir string, local, remote *syncTree, state *SyncState, res *SyncResult) error {
+	base := state.folderSet()
+	for _, p := range syncPaths(folderStamps(local.dirs), folderStamps(remote.dirs), nil) {
+		if base[p] || local.dirs[p] == remote.dirs[p] {
+			continue
+		}
+		if local.dirs[p] {
+			if err := ftp.MkdirAll(path.Join(remoteDir, p)); err != nil {
+				return err
+			}
+			res.Uploaded = append(res.Uploaded, p+"/")
+		} else {
+			if err := os.MkdirAll(filepath.Join(localDir, filepath.FromSlash(p)), 0755); err != nil {
+				return err
+			}
+			res.Downloaded = append(res.Downloaded, p+"/")
+		}
+	}
+	return nil
+}
+
+// removeSyncFolders removes the folders deleted on one side since the last sync from the
+// other, deepest first, unless they are not empty, e.g. holding a conflict.
+func (ftp *FTP) removeSyncFolders(localDir string, remoteDir string, local, remote *syncTree, state *SyncState, res *SyncResult) {
+	paths := state.Folders
+	for i := len(paths) - 1; i >= 0; i-- {
+		p := paths[i]
+		switch {
+		case local.dirs[p] && !remote.dirs[p]:
+			if why, ok := remote.truncatedAt(p); ok {
+				ftp.writeInfo("Keeping the local folder", p, "missing from a truncated remote listing:", why)
+				continue
+			}
+			if err := os.Remove(filepath.Join(localDir, filepath.FromSlash(p))); err != nil {
+				ftp.writeInfo("Keeping the local folder", p, "deleted remotely:", err)
+				continue
+			}
+			res.DeletedLocal = append(res.DeletedLocal, p+"/")
+		case remote.dirs[p] && !local.dirs[p]:
+			if _, err := ftp.Rmd(path.Join(remoteDir, p)); err != nil {
+				ftp.writeInfo("Keeping the remote folder", p, "deleted locally:", err)
+				continue
+			}
+			res.DeletedRemote = append(res.DeletedRemote, p+"/")
+		}
+	}
+}
+
+// folderSet returns the folders of the base as a set.
+func (s *SyncState) folderSet() map[string]bool {
+	set := make(map[string]bool, len(s.Folders))
+	for _, p := range s.Folders {
+		set[p] = true
+	}
+	return set
+}
+
+// folderStamps returns a folder set as the map syncPaths takes.
+func folderStamps(dirs map[string]bool) map[string]*FileStamp {
+	m := make(map[string]*FileStamp, len(dirs))
+	for p := range dirs {
+		m[p] = nil
+	}
+	return m
+}
+
+// updateSyncState sets the base of the files handled by the sync, found on both sides
+// after it, and journals the unresolved conflicts. The other files keep their base, so that
+// the changes of a sync stopped early, and the conflicts, are found again by the next one;
+// for the same reason the folders of the base are only dropped once the sync is complete.
+func (ftp *FTP) updateSyncState(localDir string, remoteDir string, state *SyncState, conflicts map[string]string, handled map[string]bool, complete bool, opts *SyncOptions, res *SyncResult) error {
+	local, remote, err := ftp.syncTrees(localDir, remoteDir)
+	if err != nil {
+		return err
+	}
+	for p := range handled {
+		if l, r := local.files[p], remote.files[p]; l != nil && r != nil {
+			state.Files[p] = &SyncFileState{Local: *l, Remote: *r}
+		} else {
+			delete(state.Files, p)
+		}
+	}
+	folders := make(map[string]bool)
+	if !complete {
+		folders = state.folderSet()
+	}
+	if opts.Folders {
+		for p := range local.dirs {
+			if remote.dirs[p] {
+				folders[p] = true
+			}
+		}
+	}
+	state.Folders = nil
+	for p := range folders {
+		state.Folders = append(state.Folders, p)
+	}
+	sort.Strings(state.Folders)
+
+	since := make(map[string]time.Time)
+	for _, c := range state.Conflicts {
+		since[c.Path] = c.Since
+	}
+	state.Conflicts = nil
+	for p, reason := range conflicts {
+		c := SyncConflict{Path: p, Reason: reason, Since: since[p]}
+		if c.Since.IsZero() {
+			c.Since = time.Now().UTC()
+		}
+		state.Conflicts = append(state.Conflicts, c)
+	}
+	sort.Slice(state.Conflicts, func(i, j int) bool { return state.Conflicts[i].Path < state.Conflicts[j].Path })
+	res.Conflicts = state.Conflicts
+	return nil
+}
+
+// syncPaths returns the sorted union of the paths of both sides and of the base.
+func syncPaths(local, remote map[string]*FileStamp, base map[string]*SyncFileState) []string {
+	seen := make(map[string]bool)
+	for p := range local {
+		seen[p] = true
+	}
+	for p := range remote {
+		seen[p] = true
+	}
+	for p := range base {
+		seen[p] = true
+	}
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// syncTree holds the files and folders of a side by slash separated relative path.
+type syncTree struct {
+	files     map[string]*FileStamp
+	dirs      map[string]bool
+	truncated map[string]string // the folders whose listing looks truncated, "" for the root, see ListTruncated
+}
+
+func newSyncTree() *syncTree {
+	return &syncTree{files: make(map[string]*FileStamp), dirs: make(map[string]bool), truncated: make(map[string]string)}
+}
+
+// truncatedAt reports whether the listing of a folder above p looks truncated and why, in
+// which case p missing from the tree does not mean it has been deleted.
+func (t *syncTree) truncatedAt(p string) (string, bool) {
+	for p != "" {
+		if p = path.Dir(p); p == "." {
+			p = ""
+		}
+		if why, ok := t.truncated[p]; ok {
+			return why, true
+		}
+	}
+	return "", false
+}
+
+func (t *syncTree) add(p string, e *Entry) {
+	switch e.Type {
+	case EntryTypeFile:
+		t.files[p] = &FileStamp{Size: e.Size, Time: e.Time}
+	case EntryTypeFolder:
+		t.dirs[p] = true
+	}
+}
+
+// syncTrees returns the trees of both sides, the remote paths differing only in case from
+// local ones spelt like them if the server ignores the case, see SetCaseFolding.
+func (ftp *FTP) syncTrees(localDir string, remoteDir string) (local, remote *syncTree, err error) {
+	if local, err = syncLocalTree(localDir); err != nil {
+		return nil, nil, err
+	}
+	if remote, err = ftp.syncRemoteTree(remoteDir); err != nil {
+		return nil, nil, err
+	}
+	fold, err := ftp.foldsCase()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fold {
+		remote.foldCase(local)
+	}
+	return local, remote, nil
+}
+
+// syncLocalTree returns the regular files and the folders below dir.
+func syncLocalTree(dir string) (*syncTree, error) {
+	t := newSyncTree()
+	err := WalkLocal(dir, func(p string, e *Entry, err error) error {
+		if err != nil || (e.Type == EntryTypeFile && !strings.HasPrefix(e.Perm, "-")) {
+			return err
+		}
+		t.add(p, e)
+		return nil
+	})
+	return t, err
+}
+
+// syncRemoteTree returns the files and folders below dir.
+func (ftp *FTP) syncRemoteTree(dir string) (*syncTree, error) {
+	t := newSyncTree()
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	list := func(p string) ([]*Entry, error) {
+		entries, err := ftp.List(p)
+		if truncated, why := ftp.ListTruncated(); err == nil && truncated {
+			t.truncated[strings.TrimSuffix(strings.TrimPrefix(p+"/", prefix), "/")] = why
+		}
+		return entries, err
+	}
+	err := ftp.walkRemoteWith(dir, list, func(p string, e *Entry, err error) error {
+		if err != nil || ftp.isHeartbeat(p) {
+			return err
+		}
+		t.add(strings.TrimPrefix(p, prefix), e)
+		return nil
+	})
+	return t, err
+}
@@ -0,0 +1,98 @@
+package ftp4go
+
+import "time"
+
+// adaptiveTimeout derives the reply timeout from the observed reply latencies, the way TCP
+// derives its retransmission timeout from the round trip times (RFC 6298): the timeout is
+// the smoothed latency plus four times its mean deviation, bounded by min and max.
+type adaptiveTimeout struct {
+	min, max time.Duration
+	srtt     time.Duration // smoothed latency, 0 until the first sample
+	rttvar   time.Duration // mean deviation of the latency
+	sent     time.Time     // when the command awaiting its first reply was sent
+	untimed  bool          // the next reply is not bounded, see beginRead
+}
+
+// SetAdaptiveTimeout bounds the wait for every reply by a timeout adapted to the latency
+// of the server, measured from the first reply to each command: fast servers get short
+// timeouts, slow links long ones, always between min and max. Until the first reply is
+// measured max applies. A max of 0 turns the reply timeouts off, the default.
+// A reply not received in time fails with a net.Error whose Timeout method returns true,
+// the session is out of step with the server then and needs reconnecting.
+func (ftp *FTP) SetAdaptiveTimeout(min, max time.Duration) {
+	if min > max {
+		min = max
+	}
+	ftp.timeouts = adaptiveTimeout{min: min, max: max}
+}
+
+// AdaptiveTimeout returns the reply timeout currently applied, 0 if they are turned off.
+func (ftp *FTP) AdaptiveTimeout() time.Duration {
+	return ftp.timeouts.timeout()
+}
+
+func (a *adaptiveTimeout) timeout() time.Duration {
+	if a.max <= 0 {
+		return 0
+	}
+	if a.srtt == 0 {
+		return a.max
+	}
+	t := a.srtt + 4*a.rttvar
+	if t < a.min {
+		return a.min
+	}
+	if t > a.max {
+		return a.max
+	}
+	return t
+}
+
+// sample accounts for the latency of a first reply.
+func (a *adaptiveTimeout) sample(rtt time.Duration) {
+	if a.srtt == 0 {
+		a.srtt = rtt
+		a.rttvar = rtt / 2
+		return
+	}
+	d := a.srtt - rtt
+	if d < 0 {
+		d = -d
+	}
+	a.rttvar = (3*a.rttvar + d) / 4
+	a.srtt = (7*a.srtt + rtt) / 8
+}
+
+// beginRead applies the timeout to the control connection before reading a reply, unless
+// the reply is untimed: the caller set its own deadline, or the reply is slow by nature,
+// as the final reply to a transfer or the reply to a command hashing or copying a file.
+func (ftp *FTP) beginRead() {
+	if ftp.timeouts.untimed {
+		return
+	}
+	if t := ftp.timeouts.timeout(); t > 0 && ftp.conn != nil {
+		ftp.conn.SetReadDeadline(time.Now().Add(t))
+	}
+}
+
+// endRead clears the timeout and samples the latency if the reply is the first to its command.
+func (ftp *FTP) endRead(err error) {
+	a := &ftp.timeouts
+	if a.max <= 0 {
+		a.untimed = false
+		return
+	}
+	if a.untimed {
+		// the caller clears its own deadline, and the latency says nothing of the server
+		a.untimed = false
+		a.sent = time.Time{}
+		return
+	}
+	if ftp.conn != nil {
+		ftp.conn.SetReadDeadline(time.Time{})
+	}
+	if err == nil && !a.sent.IsZero() {
+		a.sample(time.Since(a.sent))
+	}
+	a.sent = time.Time{}
+}
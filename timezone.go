@@ -0,0 +1,73 @@
+package ftp4go
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"time"
+)
+
+// SetServerTimezone sets the offset of the server's local time from UTC, e.g. +2h for a
+// server running in CEST, by which the times of the LIST listings are corrected: those are
+// written in the server's local time, unlike the ones of MDTM and MLSD which are in UTC.
+// 0, the default, takes the LIST times as UTC. See DetectServerTimezone.
+func (ftp *FTP) SetServerTimezone(offset time.Duration) {
+	ftp.tzOffset = offset
+}
+
+// ServerTimezone returns the offset set by SetServerTimezone or found by DetectServerTimezone.
+func (ftp *FTP) ServerTimezone() time.Duration {
+	return ftp.tzOffset
+}
+
+// DetectServerTimezone infers the offset of the server's local time from UTC and sets it
+// with SetServerTimezone, so that the LIST times compared by SyncDirs and the like are in
+// UTC. It uploads an empty probe file to the current folder, lists it and compares its
+// LIST time with its MDTM time if the server supports MDTM, or else with the time of the
+// upload, then deletes the probe. The offset is rounded to 15 minutes: LIST times have a
+// minute resolution at best and, without MDTM, the clocks of the client and the server
+// must agree within a few minutes.
+func (ftp *FTP) DetectServerTimezone() (offset time.Duration, err error) {
+	b := make([]byte, 4)
+	if _, err = rand.Read(b); err != nil {
+		return 0, err
+	}
+	name := ".ftp4go-tz-" + hex.EncodeToString(b)
+	uploaded := time.Now().UTC()
+	if err = ftp.StoreBytes(STORE_FTP_CMD, bytes.NewReader(nil), BLOCK_SIZE, name, "", nil); err != nil {
+		return 0, err
+	}
+	defer ftp.cleanup(name)
+
+	// some servers only list folders, the current one then
+	var listed time.Time
+	for _, dir := range []string{name, ""} {
+		lines, err := ftp.Dir(dir)
+		if err != nil {
+			return 0, err
+		}
+		for _, l := range lines {
+			// parsed as is, in the server's local time
+			if e, err1 := ParseListLine(l); err1 == nil && path.Base(e.Name) == name {
+				listed = e.Time
+			}
+		}
+		if !listed.IsZero() {
+			break
+		}
+	}
+	if listed.IsZero() {
+		return 0, fmt.Errorf("The probe %s was not listed", name)
+	}
+	if t, err1 := ftp.Mdtm(name); err1 == nil {
+		uploaded = t
+	} else {
+		ftp.writeInfo("No MDTM time for the timezone probe, comparing with the upload time:", err1)
+	}
+	offset = listed.Sub(uploaded).Round(15 * time.Minute)
+	ftp.writeInfo("Server timezone offset:", offset)
+	ftp.tzOffset = offset
+	return offset, nil
+}
@@ -0,0 +1,172 @@
+package ftp4go
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// ProtLevel is the data channel protection level set by PROT, RFC 2228.
+type ProtLevel byte
+
+const (
+	ProtClear   ProtLevel = 'C' // data connections are not protected
+	ProtPrivate ProtLevel = 'P' // data connections are wrapped in TLS
+)
+
+// DefaultPbszFallback are the buffer sizes tried by Secure, in order. RFC 4217 mandates
+// PBSZ 0 for TLS, the nonzero sizes are for the servers which reject it.
+var DefaultPbszFallback = []uint32{0, 16384, 4096, 1024}
+
+// ErrSequence is returned when the RFC 2228 commands are not sent in the order AUTH, PBSZ, PROT.
+var ErrSequence = errors.New("Security commands out of order, expected AUTH, PBSZ then PROT")
+
+// secState is the step reached in the RFC 2228 command sequence.
+type secState int
+
+const (
+	secNone secState = iota
+	secAuth          // the control connection is protected
+	secPbsz          // the protection buffer size is agreed
+	secProt          // the data protection level is set
+)
+
+// security is the RFC 2228 state of a control connection.
+type security struct {
+	state    secState
+	config   *tls.Config // shared by the data connections, to resume the control session
+	pbsz     uint32
+	prot     ProtLevel
+	fallback []uint32
+}
+
+// SetPbszFallback sets the buffer sizes Secure tries with PBSZ, in order,
+// DefaultPbszFallback if none are given.
+func (ftp *FTP) SetPbszFallback(sizes ...uint32) {
+	ftp.sec.fallback = sizes
+}
+
+// Secured reports whether the control connection is protected by TLS.
+func (ftp *FTP) Secured() bool {
+	return ftp.sec.state >= secAuth
+}
+
+// Protection returns the data protection level, ProtClear until PROT P is accepted.
+func (ftp *FTP) Protection() ProtLevel {
+	if ftp.sec.prot == 0 {
+		return ProtClear
+	}
+	return ftp.sec.prot
+}
+
+// Secure switches the session to explicit FTPS: AUTH TLS, PBSZ and PROT P, in this order.
+// It is meant to be called after Connect and before Login, so that the credentials are encrypted.
+// The buffer size is negotiated from the sizes of SetPbszFallback. A nil config
+// verifies the server certificate against the host name given to Connect, or the
+// name set by SetServerName.
+func (ftp *FTP) Secure(config *tls.Config) (err error) {
+	if err = ftp.AuthTLS(config); err != nil {
+		return err
+	}
+	if _, err = ftp.negotiatePbsz(); err != nil {
+		return err
+	}
+	return ftp.Prot(ProtPrivate)
+}
+
+// AuthTLS sends AUTH TLS, falling back to AUTH SSL for older servers, and performs
+// the TLS handshake on the control connection.
+func (ftp *FTP) AuthTLS(config *tls.Config) (err error) {
+	if ftp.sec.state != secNone {
+		return fmt.Errorf("%w: AUTH already accepted", ErrSequence)
+	}
+
+	if _, err = ftp.SendAndRead(AUTH_FTP_CMD, "TLS"); err != nil {
+		ftp.writeInfo("AUTH TLS refused, trying AUTH SSL:", err)
+		if _, err1 := ftp.SendAndRead(AUTH_FTP_CMD, "SSL"); err1 != nil {
+			return err
+		}
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = ftp.tlsServerName()
+	}
+	if config.ClientSessionCache == nil {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	conn := tls.Client(ftp.conn, config)
+	if err = conn.Handshake(); err != nil {
+		return err
+	}
+	ftp.setConn(conn)
+	ftp.textprotoConn = textproto.NewConn(conn)
+	ftp.sec.config = config
+	ftp.sec.state = secAuth
+	return nil
+}
+
+// Pbsz sends PBSZ with the given protection buffer size. Servers may answer with a
+// smaller size as "PBSZ=n", which is returned as granted.
+func (ftp *FTP) Pbsz(size uint32) (granted uint32, err error) {
+	if ftp.sec.state < secAuth {
+		return 0, fmt.Errorf("%w: PBSZ before AUTH", ErrSequence)
+	}
+
+	var resp *Response
+	if resp, err = ftp.SendAndRead(PBSZ_FTP_CMD, strconv.FormatUint(uint64(size), 10)); err != nil {
+		return 0, err
+	}
+	granted = size
+	if i := strings.Index(strings.ToUpper(resp.Message), "PBSZ="); i >= 0 {
+		f := strings.FieldsFunc(resp.Message[i+5:], func(r rune) bool { return r < '0' || r > '9' })
+		if len(f) > 0 {
+			if n, err1 := strconv.ParseUint(f[0], 10, 32); err1 == nil && uint32(n) <= size {
+				granted = uint32(n)
+			}
+		}
+	}
+	ftp.sec.pbsz = granted
+	ftp.sec.state = secPbsz
+	return granted, nil
+}
+
+// negotiatePbsz tries the fallback sizes in order until one is accepted.
+func (ftp *FTP) negotiatePbsz() (granted uint32, err error) {
+	sizes := ftp.sec.fallback
+	if len(sizes) == 0 {
+		sizes = DefaultPbszFallback
+	}
+	for _, size := range sizes {
+		if granted, err = ftp.Pbsz(size); err == nil {
+			return granted, nil
+		}
+		ftp.writeInfo("PBSZ", size, "refused:", err)
+	}
+	return 0, err
+}
+
+// Prot sets the data protection level, it needs a successful PBSZ first.
+func (ftp *FTP) Prot(level ProtLevel) (err error) {
+	if ftp.sec.state < secPbsz {
+		return fmt.Errorf("%w: PROT before PBSZ", ErrSequence)
+	}
+	if level != ProtClear && level != ProtPrivate {
+		return fmt.Errorf("Unsupported protection level %q", rune(level))
+	}
+
+	if _, err = ftp.SendAndRead(PROT_FTP_CMD, string(rune(level))); err != nil {
+		return err
+	}
+	ftp.sec.prot = level
+	ftp.sec.state = secProt
+	return nil
+}
@@ -0,0 +1,611 @@
+package ftp4go
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TransferMode selects how the contents of a file are transferred.
+type TransferMode int
+
+const (
+	// Binary transfers the bytes as they are (TYPE I).
+	Binary TransferMode = iota
+	// ASCII transfers text line by line (TYPE A), the line endings are converted.
+	ASCII
+	// Auto picks ASCII for the file names with a text extension, see SetTextExtensions, Binary otherwise.
+	Auto
+	// AutoType sniffs the first KB of an upload and picks ASCII for text, Binary otherwise.
+	// Downloads, which cannot be sniffed before TYPE is sent, fall back to Auto.
+	AutoType
+)
+
+// sniffSize is the number of leading bytes examined by AutoType.
+const sniffSize = 1024
+
+// looksLikeText tells text from binary contents the way Git does, text has no NUL byte,
+// and also rejects contents made of control characters for a good part.
+// Empty contents are binary, so that they are not converted.
+func looksLikeText(head []byte) bool {
+	if len(head) == 0 {
+		return false
+	}
+	control := 0
+	for _, b := range head {
+		switch {
+		case b == 0:
+			return false
+		case b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\b' && b != 0x1b, b == 0x7f:
+			control++
+		}
+	}
+	return control*10 < len(head)
+}
+
+func (m TransferMode) String() string {
+	switch m {
+	case ASCII:
+		return "ascii"
+	case Auto:
+		return "auto"
+	case AutoType:
+		return "autotype"
+	}
+	return "binary"
+}
+
+// lineMode maps the useLineMode flag of the older APIs to a TransferMode.
+func lineMode(useLineMode bool) TransferMode {
+	if useLineMode {
+		return ASCII
+	}
+	return Binary
+}
+
+// DefaultTextExtensions are the extensions transferred in ASCII by the Auto mode by default.
+var DefaultTextExtensions = []string{".txt", ".csv", ".tsv", ".log", ".xml", ".json", ".htm", ".html", ".ini", ".cfg", ".sql", ".md"}
+
+// SetTextExtensions sets the file extensions, such as ".txt", transferred in ASCII by the Auto
+// mode, they are compared case insensitively. No extensions means DefaultTextExtensions.
+func (ftp *FTP) SetTextExtensions(exts ...string) {
+	ftp.textExts = make(map[string]bool, len(exts))
+	for _, e := range exts {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		ftp.textExts[strings.ToLower(e)] = true
+	}
+}
+
+// resolveMode returns the mode to transfer name with, Auto resolved by its extension
+// and AutoType by the leading bytes head, or like Auto if they are not known.
+func (ftp *FTP) resolveMode(mode TransferMode, name string, head []byte) TransferMode {
+	if mode == AutoType && head != nil {
+		if looksLikeText(head) {
+			return ASCII
+		}
+		return Binary
+	}
+	if mode != Auto && mode != AutoType {
+		return mode
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if len(ftp.textExts) == 0 {
+		for _, e := range DefaultTextExtensions {
+			if e == ext {
+				return ASCII
+			}
+		}
+		return Binary
+	}
+	if ftp.textExts[ext] {
+		return ASCII
+	}
+	return Binary
+}
+
+// TransferOptions configures DownloadFileWithOptions, UploadFileWithOptions, Retrieve and Store.
+// The zero value transfers in binary mode without any limit.
+type TransferOptions struct {
+	Mode      TransferMode    // Binary by default
+	BlockSize int             // binary block size, 0 picks one from the file size
+	Offset    int64           // restart the transfer at this offset with REST, binary mode only
+	Verify    bool            // compare the size, and the SHA-256 checksum if the server supports HASH, of a file transferred in binary mode
+	RateLimit int64           // maximum number of bytes per second, 0 for no limit
+	Callback  Callback        // reports the progress
+	Context   context.Context // cancels the transfer, checked between blocks
+
+	// Preallocate sizes the local file of a binary download to the remote size before writing to it,
+	// the size is asked with SIZE, or else taken from the 150 reply. Failed downloads are cut back
+	// to the bytes received.
+	Preallocate bool
+	// CheckSpace asks the size of a download with SIZE and fails with ErrInsufficientSpace before
+	// transferring anything if it does not fit in the local folder, see CheckLocalSpace.
+	CheckSpace bool
+	// CreateDirs creates the missing parent folders of the remote file with MkdirAll before uploading it.
+	CreateDirs bool
+	// Dirs coordinates the folders created by CreateDirs with the other workers of a job sharing
+	// it, nil to create them independently.
+	Dirs *DirCoordinator
+	// MaxDuration aborts a transfer still running after it with ErrDeadlineExceeded, 0 for no limit.
+	MaxDuration time.Duration
+	// DurationPerMB extends MaxDuration by as much per MiB of the file once its size is known:
+	// the size of the local file of an upload, the size announced by the 150 reply of a download,
+	// or asked with SIZE for Preallocate or CheckSpace. Without a MaxDuration it only bounds the
+	// transfers of a known size.
+	DurationPerMB time.Duration
+	// DeadlineRetries is the number of times DownloadFileWithOptions and UploadFileWithOptions
+	// start over a transfer aborted by MaxDuration, halving the block size each time.
+	DeadlineRetries int
+	// DataConn opens the data connection of this transfer in passive or active mode, regardless
+	// of SetPassive, e.g. for a server whose passive mode is broken for some files only.
+	DataConn DataConnMode
+
+	announced  func(size int64) // receives the size of the 150 reply
+	remoteSize int64            // size of a download asked with SIZE, -1 if not asked
+}
+
+// DataConnMode selects how the data connection of a transfer is opened.
+type DataConnMode int
+
+const (
+	DataConnSession DataConnMode = iota // as set by SetPassive, the default
+	DataConnPassive                     // the client connects to the server, after PASV
+	DataConnActive                      // the server connects to the client, after PORT
+)
+
+// passive reports whether a data connection opened with mode is opened in passive mode.
+func (ftp *FTP) passive(mode DataConnMode) bool {
+	switch mode {
+	case DataConnPassive:
+		return true
+	case DataConnActive:
+		return false
+	}
+	return ftp.passiveserver
+}
+
+var (
+	// ErrRestartASCII is returned for a restart offset given with the ASCII mode.
+	ErrRestartASCII = errors.New("Transfers can only be restarted in binary mode")
+	// ErrDeadlineExceeded is returned for a transfer aborted by its MaxDuration.
+	ErrDeadlineExceeded = errors.New("Transfer exceeded its maximum duration")
+)
+
+// minRetryBlockSize bounds the block size of the DeadlineRetries.
+const minRetryBlockSize = 1024
+
+// resolve returns a copy of the options, defaults if nil, with the Auto modes resolved
+// for name and the leading bytes head, nil if unknown.
+func (ftp *FTP) resolve(opts *TransferOptions, name string, head []byte) (*TransferOptions, error) {
+	o := TransferOptions{remoteSize: -1}
+	if opts != nil {
+		o = *opts
+		o.remoteSize = -1
+	}
+	o.Mode = ftp.resolveMode(o.Mode, name, head)
+	if o.Mode == ASCII && o.Offset != 0 {
+		return nil, ErrRestartASCII
+	}
+	return &o, nil
+}
+
+func (o *TransferOptions) blockSize(size int64) int {
+	if o.BlockSize > 0 {
+		return o.BlockSize
+	}
+	return adaptiveBlockSize(size)
+}
+
+// newGate returns the gate applying the context, deadline, rate limit and rate group,
+// nil if there are none.
+func (o *TransferOptions) newGate(group *RateGroup) *gate {
+	if o.Context == nil && o.RateLimit <= 0 && o.MaxDuration <= 0 && o.DurationPerMB <= 0 && group == nil {
+		return nil
+	}
+	g := &gate{ctx: o.Context, rate: o.RateLimit, group: group, begin: time.Now(), max: o.MaxDuration, perMB: o.DurationPerMB}
+	if o.MaxDuration > 0 {
+		g.deadline = g.begin.Add(o.MaxDuration)
+	}
+	return g
+}
+
+// gate checks the context and deadline of a transfer and holds it back to its rate limit.
+type gate struct {
+	ctx      context.Context
+	rate     int64
+	deadline time.Time
+	start    time.Time
+	n        int64
+	group    *RateGroup
+	begin    time.Time     // of the transfer, the deadline being MaxDuration later
+	max      time.Duration // MaxDuration
+	perMB    time.Duration // DurationPerMB
+}
+
+// scale extends the deadline by DurationPerMB for a transfer of size bytes, -1 if unknown.
+func (g *gate) scale(size int64) {
+	if g.perMB <= 0 || size < 0 {
+		return
+	}
+	extra := time.Duration(float64(g.perMB) * float64(size) / (1 << 20))
+	g.deadline = g.begin.Add(g.max + extra)
+}
+
+func (g *gate) check() error {
+	if g.expired() {
+		return ErrDeadlineExceeded
+	}
+	if g.ctx != nil {
+		return g.ctx.Err()
+	}
+	return nil
+}
+
+func (g *gate) expired() bool {
+	return !g.deadline.IsZero() && !time.Now().Before(g.deadline)
+}
+
+// open applies the deadline to the data connection of the transfer, so that a stalled
+// connection is aborted too; finish reports the failure of an expired transfer as ErrDeadlineExceeded.
+func (g *gate) open(ftp *FTP) {
+	ftp.dataDeadline = g.deadline
+}
+
+func (g *gate) finish(ftp *FTP, err *error) {
+	ftp.dataDeadline = time.Time{}
+	if *err != nil && g.expired() {
+		ftp.writeInfo("Transfer aborted after its maximum duration:", *err)
+		*err = &ErrTransferStopped{Reason: StopDeadline, Err: ErrDeadlineExceeded}
+	}
+}
+
+// pass accounts for n transferred bytes and sleeps as long as the transfer is ahead of
+// its rate or its group of its own.
+func (g *gate) pass(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	var d time.Duration
+	if g.rate > 0 {
+		if g.start.IsZero() {
+			g.start = time.Now()
+		}
+		g.n += int64(n)
+		d = time.Duration(g.n*int64(time.Second)/g.rate) - time.Since(g.start)
+	}
+	if g.group != nil {
+		if gd := g.group.reserve(n); gd > d {
+			d = gd
+		}
+	}
+	return sleep(g.ctx, d)
+}
+
+type gatedReader struct {
+	r io.Reader
+	g *gate
+}
+
+func (gr *gatedReader) Read(p []byte) (int, error) {
+	if err := gr.g.check(); err != nil {
+		return 0, err
+	}
+	n, err := gr.r.Read(p)
+	if err1 := gr.g.pass(n); err1 != nil {
+		return n, err1
+	}
+	return n, err
+}
+
+type gatedWriter struct {
+	w io.Writer
+	g *gate
+}
+
+func (gw *gatedWriter) Write(p []byte) (int, error) {
+	if err := gw.g.check(); err != nil {
+		return 0, err
+	}
+	n, err := gw.w.Write(p)
+	if err1 := gw.g.pass(n); err == nil {
+		err = err1
+	}
+	return n, err
+}
+
+// Retrieve downloads a remote file into w.
+func (ftp *FTP) Retrieve(remotename string, w io.Writer, opts *TransferOptions) error {
+	opts, err := ftp.resolve(opts, remotename, nil)
+	if err != nil {
+		return err
+	}
+	cw := NewCountingWriter(w, remotename, "", opts.Callback)
+	if err = ftp.retrieve(remotename, cw, opts); err != nil {
+		cw.fail(err)
+	}
+	return err
+}
+
+func (ftp *FTP) retrieve(remotename string, cw *CountingWriter, opts *TransferOptions) (err error) {
+	var g *gate
+	ftp.onSize = func(size int64) {
+		cw.expect(size)
+		if g != nil && opts.remoteSize < 0 {
+			// applied to the data connection once open
+			g.scale(size)
+			g.open(ftp)
+		}
+		if opts.announced != nil {
+			opts.announced(size)
+		}
+	}
+	defer func() { ftp.onSize = nil }()
+	restore, err := ftp.useCompression(remotename, nil)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	var w io.Writer = cw
+	if g = opts.newGate(ftp.downGroup); g != nil {
+		w = &gatedWriter{w, g}
+		g.scale(opts.remoteSize)
+		g.open(ftp)
+		defer g.finish(ftp, &err)
+	}
+	if opts.Mode == ASCII {
+		tw := newTextFileWriter(w)
+		err = ftp.getLines(RETR_FTP_CMD, RETR_FTP_CMD.AppendParameters(remotename), tw, opts.DataConn)
+		if err1 := tw.bw.Flush(); err == nil {
+			err = err1
+		}
+		return err
+	}
+	blocksize := opts.BlockSize
+	if blocksize <= 0 {
+		blocksize = BLOCK_SIZE
+	}
+	return ftp.getBytes(RETR_FTP_CMD, RETR_FTP_CMD.AppendParameters(remotename), w, blocksize, opts.Offset, opts.DataConn)
+}
+
+// Store uploads the contents of r as a remote file.
+func (ftp *FTP) Store(remotename string, r io.Reader, opts *TransferOptions) error {
+	var head []byte
+	if opts != nil && opts.Mode == AutoType {
+		br := bufio.NewReaderSize(r, sniffSize)
+		head, _ = br.Peek(sniffSize)
+		if head == nil {
+			head = []byte{}
+		}
+		r = br
+	}
+	opts, err := ftp.resolve(opts, remotename, head)
+	if err != nil {
+		return err
+	}
+	return ftp.store(remotename, "", r, -1, opts)
+}
+
+// store uploads r, of the given size or -1 if unknown.
+func (ftp *FTP) store(remotename string, localpath string, r io.Reader, size int64, opts *TransferOptions) (err error) {
+	if opts.CreateDirs {
+		if opts.Dirs != nil {
+			err = opts.Dirs.MkdirAll(ftp, path.Dir(remotename))
+		} else {
+			err = ftp.MkdirAll(path.Dir(remotename))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var sample []byte
+	if ftp.modeZ && ftp.zPolicy == CompressSample {
+		br := bufio.NewReaderSize(r, compressionSample)
+		sample, _ = br.Peek(compressionSample)
+		r = br
+	}
+	restore, err := ftp.useCompression(remotename, sample)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	if g := opts.newGate(ftp.upGroup); g != nil {
+		r = &gatedReader{r, g}
+		g.scale(size)
+		g.open(ftp)
+		defer g.finish(ftp, &err)
+	}
+	if opts.Mode == ASCII {
+		return ftp.storeLines(STORE_FTP_CMD, r, remotename, localpath, opts.Callback, opts.DataConn)
+	}
+	ftp.preAnnounce(size)
+	return ftp.storeBytes(STORE_FTP_CMD, STORE_FTP_CMD.AppendParameters(remotename), r, opts.blockSize(size), opts.Offset, opts.DataConn, remotename, localpath, opts.Callback)
+}
+
+// DownloadFileWithOptions downloads a remote file to a local path, configured by opts, which may be nil.
+// With an Offset the local file is truncated to it and the download restarted there,
+// otherwise it is replaced. A failed download is reported as *ErrPartialTransfer.
+func (ftp *FTP) DownloadFileWithOptions(remotename string, localpath string, opts *TransferOptions) error {
+	return ftp.retryDeadline(opts, func(opts *TransferOptions) error {
+		return ftp.downloadFile(remotename, localpath, opts)
+	})
+}
+
+func (ftp *FTP) downloadFile(remotename string, localpath string, opts *TransferOptions) (err error) {
+	if opts, err = ftp.resolve(opts, remotename, nil); err != nil {
+		return
+	}
+	ck := ftp.checkpointDownload(remotename, localpath, opts)
+	defer func() { ck.finish(err) }()
+	if opts.CheckSpace {
+		var size int
+		if size, err = ftp.Size(remotename); err != nil {
+			return
+		}
+		if err = CheckLocalSpace(filepath.Dir(localpath), int64(size)-opts.Offset); err != nil {
+			return
+		}
+		opts.remoteSize = int64(size) - opts.Offset
+	}
+
+	var f *os.File
+	if opts.Offset > 0 {
+		if f, err = os.OpenFile(localpath, os.O_WRONLY|os.O_CREATE, 0644); err != nil {
+			return
+		}
+		if err = f.Truncate(opts.Offset); err == nil {
+			_, err = f.Seek(opts.Offset, io.SeekStart)
+		}
+		if err != nil {
+			f.Close()
+			return
+		}
+	} else {
+		// remove local file
+		os.Remove(localpath)
+		if f, err = os.OpenFile(localpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			return
+		}
+	}
+	defer f.Close()
+
+	if ck != nil {
+		ck.sync = f.Sync
+	}
+	cw := NewCountingWriter(ck.writer(f), remotename, localpath, opts.Callback)
+	preallocated := false
+	if opts.Preallocate && opts.Mode == Binary {
+		preallocate := func(size int64) {
+			if err := f.Truncate(opts.Offset + size); err != nil {
+				ftp.writeInfo("Unable to preallocate the local file:", err)
+				return
+			}
+			preallocated = true
+		}
+		if size, err1 := ftp.Size(remotename); err1 == nil && int64(size) >= opts.Offset {
+			opts.remoteSize = int64(size) - opts.Offset
+			preallocate(opts.remoteSize)
+		} else if opts.Offset == 0 {
+			// the 150 reply of a restarted download may give the total or the remaining size
+			opts.announced = preallocate
+		}
+	}
+	err = ftp.retrieve(remotename, cw, opts)
+	if preallocated {
+		// drop what was allocated but not received
+		if err1 := f.Truncate(opts.Offset + cw.Count()); err == nil {
+			err = err1
+		}
+	}
+	if err != nil {
+		cw.fail(err)
+		return ftp.partialDownload(f, remotename, localpath, cw.Count(), err)
+	}
+	cw.Done()
+
+	if opts.Verify && opts.Mode == Binary {
+		return ftp.verifyDelivery(localpath, remotename, opts.Offset+cw.Count(), ftp.HasFeature("HASH SHA-256"))
+	}
+	return nil
+}
+
+// UploadFileWithOptions uploads a local file to the current folder (see Cwd too) on the FTP server,
+// configured by opts, which may be nil.
+// With an Offset the upload restarts there, in the local file and on the server.
+func (ftp *FTP) UploadFileWithOptions(remotename string, localpath string, opts *TransferOptions) error {
+	return ftp.retryDeadline(opts, func(opts *TransferOptions) error {
+		return ftp.uploadFile(remotename, localpath, opts)
+	})
+}
+
+func (ftp *FTP) uploadFile(remotename string, localpath string, opts *TransferOptions) (err error) {
+	je := &JournalEntry{Op: "STOR", Path: remotename}
+	defer ftp.record(je, time.Now(), &err)
+
+	var f *os.File
+	if f, err = os.Open(localpath); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var head []byte
+	if opts != nil && opts.Mode == AutoType {
+		head = make([]byte, sniffSize)
+		n, _ := f.ReadAt(head, 0)
+		head = head[:n]
+	}
+	if opts, err = ftp.resolve(opts, localpath, head); err != nil {
+		return
+	}
+
+	size := int64(-1)
+	fi, err1 := f.Stat()
+	if err1 == nil {
+		size = fi.Size()
+	}
+	ck := ftp.checkpointUpload(remotename, localpath, fi, opts)
+	defer func() { ck.finish(err) }()
+	if opts.Offset > 0 {
+		if _, err = f.Seek(opts.Offset, io.SeekStart); err != nil {
+			return
+		}
+		size -= opts.Offset
+	}
+
+	// count and hash what is read for the journal
+	reader := ck.reader(f)
+	if ftp.journal != nil {
+		h := sha256.New()
+		cr := NewCountingReader(io.TeeReader(reader, h), remotename, localpath, nil)
+		reader = cr
+		defer func() {
+			je.Size = cr.Count()
+			je.Checksum = hex.EncodeToString(h.Sum(nil))
+		}()
+	}
+
+	if err = ftp.store(remotename, localpath, reader, size, opts); err != nil {
+		return
+	}
+
+	if opts.Verify && opts.Mode == Binary {
+		if err = ftp.verifyDelivery(localpath, remotename, opts.Offset+size, ftp.HasFeature("HASH SHA-256")); err != nil {
+			return
+		}
+	}
+	return ftp.applyPermissions(localpath, remotename, fi)
+}
+
+// retryDeadline runs transfer, again with half the block size as long as it exceeds
+// its MaxDuration and DeadlineRetries are left.
+func (ftp *FTP) retryDeadline(opts *TransferOptions, transfer func(opts *TransferOptions) error) error {
+	if opts == nil || (opts.MaxDuration <= 0 && opts.DurationPerMB <= 0) || opts.DeadlineRetries <= 0 {
+		return transfer(opts)
+	}
+	o := *opts
+	for i := 0; ; i++ {
+		err := transfer(&o)
+		if i == opts.DeadlineRetries || !errors.Is(err, ErrDeadlineExceeded) {
+			return err
+		}
+		bs := o.BlockSize
+		if bs <= 0 {
+			bs = BLOCK_SIZE
+		}
+		if o.BlockSize = bs / 2; o.BlockSize < minRetryBlockSize {
+			o.BlockSize = minRetryBlockSize
+		}
+		ftp.writeInfo("Halving the block size to", o.BlockSize)
+		ftp.retrying(&RetryEvent{Op: "deadline", Attempt: i + 1, Reason: StopDeadline.String(), Err: err})
+	}
+}
@@ -0,0 +1,127 @@
+package ftp4go
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// An ErrFileFailed reports a file or folder a tree operation failed on, with the number of
+// attempts it took and the final reply code, so that a persistent refusal, such as a 550
+// permission denied failing at once, is told apart from a flaky network failing every retry.
+type ErrFileFailed struct {
+	Path     string `json:"path"` // local for an upload, remote for a download or removal, relative for SyncDirs
+	Attempts int    `json:"attempts"`
+	Code     int    `json:"code,omitempty"` // the final negative reply, 0 for a network or local failure
+	Err      error  `json:"-"`
+}
+
+func (e *ErrFileFailed) Error() string {
+	s := fmt.Sprintf("%s failed after %d attempt", e.Path, e.Attempts)
+	if e.Attempts > 1 {
+		s += "s"
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *ErrFileFailed) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON adds the error message to the JSON of receipts and reports.
+func (e *ErrFileFailed) MarshalJSON() ([]byte, error) {
+	type fields ErrFileFailed
+	return json.Marshal(struct {
+		*fields
+		Error string `json:"error"`
+	}{(*fields)(e), e.Err.Error()})
+}
+
+// SetTreeRetries sets how many times UploadDirTree, DownloadDirTree, SyncDirs and
+// RemoveRemoteTree retry a file, after waiting delay, when it failed with a transient
+// 4xx reply or a network failure; permanent 5xx replies are not retried. 0 by default.
+// The failures are reported as *ErrFileFailed.
+func (ftp *FTP) SetTreeRetries(retries int, delay time.Duration) {
+	ftp.treeRetries = retries
+	ftp.treeRetryWait = delay
+}
+
+// RetryEvent reports an operation about to be retried after a failure, so that monitoring can
+// tell a flapping server from a slow job.
+type RetryEvent struct {
+	Host    string        // the server, as given to Connect
+	Op      string        // "tree" for a file of a tree operation, "deadline" for a transfer exceeding its MaxDuration
+	Path    string        // the file retried, see ErrFileFailed.Path; empty for a "deadline" retry
+	Attempt int           // the attempt which failed, from 1
+	Code    int           // the negative reply of the failure, 0 for a network or local failure
+	Reason  string        // the reply code, or the StopReason of a transfer, e.g. "421" or "network"
+	Backoff time.Duration // the wait before the next attempt
+	Err     error
+}
+
+// RetryFunc receives the RetryEvents, it is called synchronously before the backoff.
+type RetryFunc func(ev *RetryEvent)
+
+// SetRetryCallback sets the function told about every retry of SetTreeRetries and
+// TransferOptions.DeadlineRetries, nil to stop reporting them.
+func (ftp *FTP) SetRetryCallback(fn RetryFunc) {
+	ftp.onRetry = fn
+}
+
+// retrying logs and reports a retry.
+func (ftp *FTP) retrying(ev *RetryEvent) {
+	ev.Host = ftp.Host
+	if ev.Reason == "" {
+		if ev.Code != 0 {
+			ev.Reason = strconv.Itoa(ev.Code)
+		} else {
+			ev.Reason = StopReasonOf(ev.Err).String()
+		}
+	}
+	ftp.writeInfo("Retrying", ev.Op, ev.Path, "attempt", ev.Attempt+1, "in", ev.Backoff, "after:", ev.Err)
+	if ftp.onRetry != nil {
+		ftp.onRetry(ev)
+	}
+}
+
+// treeAttempt runs op on the tree entry p, again as long as it fails transiently and retries
+// are left, returning its failure as *ErrFileFailed. Once StopAfterCurrent has been called,
+// op is not run and ErrStoppedAfterCurrent is returned.
+func (ftp *FTP) treeAttempt(p string, op func() error) error {
+	if ftp.afterCurrent.CompareAndSwap(true, false) {
+		ftp.writeInfo("Stopping before", p)
+		return ErrStoppedAfterCurrent
+	}
+	ftp.beat(p)
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		code := replyCode(err)
+		if attempt > ftp.treeRetries || !transient(err, code) {
+			return &ErrFileFailed{Path: p, Attempts: attempt, Code: code, Err: err}
+		}
+		ftp.retrying(&RetryEvent{Op: "tree", Path: p, Attempt: attempt, Code: code, Backoff: ftp.treeRetryWait, Err: err})
+		time.Sleep(ftp.treeRetryWait)
+	}
+}
+
+// transient reports whether a failure with the reply code, 0 if none, may not happen again.
+func transient(err error, code int) bool {
+	if errors.Is(err, NewErrStop) || errors.Is(err, ErrStoppedAfterCurrent) {
+		return false
+	}
+	if code >= 400 && code < 500 {
+		return true
+	}
+	if code == 0 {
+		switch StopReasonOf(err) {
+		case StopNetwork, StopStalled:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package ftp4go
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultListLimits are the entry counts at which servers commonly cap their listings.
+var DefaultListLimits = []int{1000, 2000, 5000, 10000, 20000, 50000, 100000}
+
+// SetListLimits sets the entry counts at which a listing is suspected to be capped by the
+// server, see ListTruncated. Nil, the default, means DefaultListLimits, no limits at all
+// disable the check.
+func (ftp *FTP) SetListLimits(limits ...int) {
+	if limits == nil {
+		limits = []int{}
+	}
+	ftp.listLimits = limits
+}
+
+// ListTruncated reports whether the last LIST, NLST or MLSD listing shows signs of having
+// been truncated by the server, and why: its data ended within a line, its final reply
+// says so, or it holds exactly as many entries as a common server limit, see SetListLimits.
+// A listing is only ever flagged, not failed, since a folder may hold 1000 entries indeed;
+// SyncDirs keeps the local files missing from a flagged remote folder.
+func (ftp *FTP) ListTruncated() (truncated bool, reason string) {
+	return ftp.listTrunc != "", ftp.listTrunc
+}
+
+// checkListing flags the listing just read, of n entries and last data byte last.
+func (ftp *FTP) checkListing(n int, last byte) {
+	switch {
+	case n > 0 && last != '\n':
+		ftp.listTrunc = "the data ended within a line"
+	case strings.Contains(strings.ToLower(ftp.lastMsg), "truncat"):
+		ftp.listTrunc = "the final reply says " + ftp.lastMsg
+	default:
+		limits := ftp.listLimits
+		if limits == nil {
+			limits = DefaultListLimits
+		}
+		for _, l := range limits {
+			if n == l {
+				ftp.listTrunc = fmt.Sprintf("exactly %d entries, a common server limit", n)
+			}
+		}
+	}
+	if ftp.listTrunc != "" {
+		ftp.writeInfo("The listing looks truncated:", ftp.listTrunc)
+	}
+}
+
+// lastByteConn remembers the last byte read from a listing.
+type lastByteConn struct {
+	net.Conn
+	last byte
+}
+
+func (c *lastByteConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if n > 0 {
+		c.last = p[n-1]
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package ftp4go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MaxTunedMemory bounds the transfer buffers of all the tuned transfers of the process, see
+// SetBlockTuning: beyond it they stop growing, and shrink back while it is exceeded.
+var MaxTunedMemory int64 = 64 << 20
+
+// tuneAfter is the number of consecutive full blocks after which a tuned block size doubles.
+const tuneAfter = 8
+
+// tunedMemory is the size of the buffers of the running tuned transfers.
+var tunedMemory atomic.Int64
+
+// SetBlockTuning makes the binary transfers of the session tune their block size while they
+// run, starting from the size they would use otherwise, the BlockSize of TransferOptions or
+// the size adapted to the file: a download doubles it, up to MAX_BLOCK_SIZE, while the blocks
+// come full, the data arriving faster than it is written; an upload doubles it while that
+// raises the throughput of the writes to the data connection. Both halve it, down to the
+// starting size, while the buffers of all the tuned transfers exceed MaxTunedMemory.
+// TransferStats.BlockSize tells the size in use. Disabled by default.
+func (ftp *FTP) SetBlockTuning(enabled bool) {
+	ftp.blockTuning = enabled
+}
+
+// blockTuner tunes the block size of a transfer.
+type blockTuner struct {
+	size  int
+	start int // the size the transfer started with, the floor of the shrinking
+	full  int // consecutive full blocks, or blocks written at this size for an upload
+
+	// the writes of an upload at the current size
+	written int64
+	elapsed time.Duration
+	rate    float64 // bytes per second at the previous size, 0 until measured
+	plateau bool    // doubling stopped raising the throughput
+}
+
+// newBlockTuner returns the tuner of a transfer starting with blocks of size bytes, nil if
+// the session does not tune them.
+func (ftp *FTP) newBlockTuner(size int) *blockTuner {
+	if !ftp.blockTuning {
+		return nil
+	}
+	if size <= 0 {
+		size = BLOCK_SIZE
+	}
+	tunedMemory.Add(int64(size))
+	return &blockTuner{size: size, start: size}
+}
+
+// shrink halves the block size while the tuned buffers exceed MaxTunedMemory.
+func (t *blockTuner) shrink() bool {
+	if tunedMemory.Load() > MaxTunedMemory && t.size > t.start {
+		t.resize(t.size / 2)
+		return true
+	}
+	return false
+}
+
+// grows reports whether the block size may double within MaxTunedMemory.
+func (t *blockTuner) grows() bool {
+	return t.size < MAX_BLOCK_SIZE && tunedMemory.Load()+int64(t.size) <= MaxTunedMemory
+}
+
+// next returns the block size of a download following a block of n bytes read.
+func (t *blockTuner) next(n int) int {
+	switch {
+	case t.shrink():
+	case n < t.size:
+		t.full = 0
+	default:
+		if t.full++; t.full >= tuneAfter && t.grows() {
+			t.resize(t.size * 2)
+		}
+	}
+	return t.size
+}
+
+// wrote returns the block size of an upload following a block of n bytes written in d.
+// After tuneAfter blocks the size doubles if the throughput beats the one of the previous
+// size, and stays once it does not anymore.
+func (t *blockTuner) wrote(n int, d time.Duration) int {
+	if t.shrink() || t.plateau {
+		return t.size
+	}
+	t.written += int64(n)
+	t.elapsed += d
+	if t.full++; t.full < tuneAfter {
+		return t.size
+	}
+	rate := float64(t.written) / t.elapsed.Seconds()
+	switch {
+	case t.rate > 0 && rate <= t.rate:
+		t.plateau = true
+	case t.grows():
+		t.rate = rate
+		t.resize(t.size * 2)
+	}
+	t.full, t.written, t.elapsed = 0, 0, 0
+	return t.size
+}
+
+func (t *blockTuner) resize(size int) {
+	tunedMemory.Add(int64(size - t.size))
+	t.size, t.full = size, 0
+	t.written, t.elapsed = 0, 0
+}
+
+// done releases the buffer of the transfer from tunedMemory.
+func (t *blockTuner) done() {
+	tunedMemory.Add(-int64(t.size))
+}
+
+// tuneBuffer returns the buffer for a block of size bytes, buf or a new one.
+func (ftp *FTP) tuneBuffer(buf *[]byte, size int) (*[]byte, []byte) {
+	if size != len(*buf) {
+		putBuffer(buf)
+		buf = getBuffer(size)
+		ftp.stats.setBlockSize(size)
+	}
+	return buf, *buf
+}
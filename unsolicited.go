@@ -0,0 +1,105 @@
+package ftp4go
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrServiceClosing is returned instead of sending a command when the server announced
+// with an unsolicited 421 reply that it is closing the control connection.
+var ErrServiceClosing = errors.New("the server is closing the control connection")
+
+// UnsolicitedFunc receives the replies the server sent between commands, without being
+// asked, such as a "421 shutting down" notice. It is called synchronously.
+type UnsolicitedFunc func(resp *Response)
+
+// SetUnsolicitedCallback sets the function told about the unsolicited replies, nil to stop
+// reporting them. Such replies are read before sending the next command, which otherwise
+// would take them for its own reply; they are logged whether a function is set or not.
+func (ftp *FTP) SetUnsolicitedCallback(fn UnsolicitedFunc) {
+	ftp.onUnsolicited = fn
+}
+
+// SetUnsolicitedWait sets how long to wait for an unsolicited reply before sending each
+// command. By default, 0, only the replies already received along with the previous reply
+// are detected; a short wait also catches those still in flight, at the cost of the wait
+// for every command.
+func (ftp *FTP) SetUnsolicitedWait(wait time.Duration) {
+	ftp.unsolicited = wait
+}
+
+// readUnsolicited reads the replies pending on the control connection before a command is sent.
+func (ftp *FTP) readUnsolicited() error {
+	if ftp.textprotoConn == nil || ftp.conn == nil {
+		return nil
+	}
+	r := ftp.textprotoConn.R
+	wait := ftp.unsolicited
+	if ftp.lateReply > 0 {
+		// the final reply of the last transfer, see finishTransfer
+		if ftp.lateReply > wait {
+			wait = ftp.lateReply
+		}
+		ftp.lateReply = 0
+	}
+	if r.Buffered() == 0 {
+		if wait <= 0 {
+			return nil
+		}
+		ftp.conn.SetReadDeadline(time.Now().Add(wait))
+		_, err := r.Peek(1)
+		ftp.conn.SetReadDeadline(time.Time{})
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var closing *Response
+	for r.Buffered() > 0 {
+		// the rest of a multi-line reply may still be in flight
+		timeout := ftp.timeoutInMsec
+		if timeout <= 0 {
+			timeout = DefaultTimeoutInMsec
+		}
+		ftp.conn.SetReadDeadline(time.Now().Add(timeout))
+		code, msg, err := ftp.textprotoConn.ReadResponse(-1)
+		ftp.conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return err
+		}
+		resp := &Response{Code: code, Message: string(ftp.decode([]byte(msg)))}
+		ftp.replies.add(resp)
+		ftp.stats.reply(resp)
+		ftp.writeInfo(fmt.Sprintf("Unsolicited reply from the server: code=%d, message=%s", code, msg))
+		if ftp.onUnsolicited != nil {
+			ftp.onUnsolicited(resp)
+		}
+		if code == StatusNotAvailable {
+			closing = resp
+		}
+	}
+	if closing != nil {
+		return fmt.Errorf("%w: %s", ErrServiceClosing, closing.Message)
+	}
+	return nil
+}
+
+// replyPending reports whether a reply can be read on the control connection without waiting.
+func (ftp *FTP) replyPending() bool {
+	if ftp.textprotoConn == nil || ftp.conn == nil {
+		return false
+	}
+	r := ftp.textprotoConn.R
+	if r.Buffered() > 0 {
+		return true
+	}
+	ftp.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := r.Peek(1)
+	ftp.conn.SetReadDeadline(time.Time{})
+	return err == nil
+}
@@ -0,0 +1,5 @@
+package ftp4go
+
+// Version is the semantic version of the package. The APIs marked Deprecated are removed
+// at the next major version, see the ftp4go_nodeprecated build tag in the README.
+const Version = "0.9.0"
@@ -0,0 +1,62 @@
+package ftp4go
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalWalkFunc is called by WalkLocal for each entry below the root, with its path relative
+// to the root, slash separated as remote paths are. If reading a folder fails, it is called
+// once more for that folder with the error, and for the root with a nil entry.
+// Returning filepath.SkipDir for a folder skips its contents, any other error stops the walk.
+type LocalWalkFunc func(relpath string, entry *Entry, err error) error
+
+// WalkLocal walks the local tree rooted at root like WalkRemote walks a remote one, a folder
+// before its contents, describing the files, folders and symbolic links with the Entry of
+// the listings: times in UTC, permissions in the "ls -l" form and link targets unresolved.
+// The entries of both walks compare directly, e.g. by size and time.
+func WalkLocal(root string, fn LocalWalkFunc) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		rel, err1 := filepath.Rel(root, p)
+		if err1 != nil {
+			return err1
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			if err != nil {
+				return fn("", nil, err)
+			}
+			return nil
+		}
+		if err != nil {
+			// the folder was visited already, this is the failure to read it
+			e, _ := localEntry(p, d)
+			return fn(rel, e, err)
+		}
+		e, err := localEntry(p, d)
+		if err != nil {
+			return fn(rel, nil, err)
+		}
+		return fn(rel, e, nil)
+	})
+}
+
+// localEntry describes a local directory entry like a listing line.
+func localEntry(p string, d fs.DirEntry) (*Entry, error) {
+	fi, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Name: d.Name(), Size: fi.Size(), Time: fi.ModTime().UTC(), Perm: fi.Mode().String()}
+	switch {
+	case fi.IsDir():
+		e.Type = EntryTypeFolder
+		e.Size = 0
+	case fi.Mode()&os.ModeSymlink != 0:
+		e.Type = EntryTypeLink
+		e.Target, _ = os.Readlink(p)
+		e.Perm = "l" + e.Perm[1:] // Go writes L
+	}
+	return e, nil
+}